@@ -0,0 +1,120 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command eunomia-runner is the entrypoint of the template processor images.
+// It runs the pipeline of the jobs of GitOpsConfigs, configured by the
+// environment variables set by the job templates, and reports the outcome in
+// the termination message of the container.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/KohlsTechnology/eunomia/pkg/runner"
+	"github.com/KohlsTechnology/eunomia/version"
+	"github.com/operator-framework/operator-sdk/pkg/log/zap"
+	"github.com/spf13/pflag"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var log = logf.Log.WithName("eunomia-runner")
+
+func main() {
+	pflag.CommandLine.AddFlagSet(zap.FlagSet())
+	versionFlag := pflag.Bool("version", false, "print version information and exit")
+	terminationLog := pflag.String("termination-log", "/dev/termination-log", "path of the termination message of the container, to which the number of managed resources or the reason of the failure is written")
+	pflag.Parse()
+
+	logf.SetLogger(zap.Logger())
+	log.Info("Eunomia runner", "version", version.Version, "buildDate", version.BuildDate, "gitSHA1", version.GitSHA1)
+	if *versionFlag {
+		os.Exit(0)
+	}
+
+	ensurePasswdEntry()
+
+	config, err := runner.ConfigFromEnv(os.Getenv)
+	if err != nil {
+		exit(*terminationLog, &runner.Error{Reason: runner.ReasonInvalidConfig, Err: err})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	r := &runner.Runner{Config: config, Log: log, Stdout: os.Stdout, Stderr: os.Stderr}
+	result, err := r.Run(ctx)
+	if err != nil {
+		exit(*terminationLog, err)
+	}
+	if result.ManagedResources >= 0 {
+		writeTerminationMessage(*terminationLog, fmt.Sprintf("managedResources=%d", result.ManagedResources))
+	}
+	log.Info("Run succeeded")
+}
+
+// exit logs the failure of the run, writes its reason to the termination
+// message and exits with the corresponding code.
+func exit(terminationLog string, err error) {
+	reason := runner.ReasonOf(err)
+	log.Error(err, "Run failed", "reason", reason)
+	if reason != "" {
+		writeTerminationMessage(terminationLog, "exitReason="+string(reason))
+	}
+	os.Exit(reason.ExitCode())
+}
+
+// writeTerminationMessage writes message to the termination message of the
+// container, ignoring errors as the file only exists in Kubernetes.
+func writeTerminationMessage(path, message string) {
+	if err := ioutil.WriteFile(path, []byte(message+"\n"), 0644); err != nil {
+		log.V(1).Info("Unable to write the termination message", "path", path, "error", err.Error())
+	}
+}
+
+// ensurePasswdEntry adds the current user to /etc/passwd when it's run with
+// an arbitrary user ID, as on OpenShift, so that git and ssh can resolve it.
+// See: https://docs.openshift.com/container-platform/3.11/creating_images/guidelines.html#openshift-specific-guidelines
+func ensurePasswdEntry() {
+	uid := strconv.Itoa(os.Getuid())
+	if _, err := user.LookupId(uid); err == nil {
+		return
+	}
+	name := os.Getenv("USER_NAME")
+	if name == "" {
+		name = "gitopsjob"
+	}
+	entry := strings.Join([]string{name, "x", uid, strconv.Itoa(os.Getgid()), name + " user", os.Getenv("HOME"), "/sbin/nologin"}, ":")
+	passwd, err := os.OpenFile("/etc/passwd", os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	defer passwd.Close()
+	if _, err := passwd.WriteString(entry + "\n"); err != nil {
+		log.Info("Unable to add the user to /etc/passwd", "error", err.Error())
+	}
+}
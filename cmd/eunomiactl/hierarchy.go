@@ -0,0 +1,90 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/KohlsTechnology/eunomia/pkg/hierarchy"
+	"github.com/spf13/cobra"
+)
+
+type hierarchyFlags struct {
+	base             string
+	file             string
+	output           string
+	provenance       bool
+	variables        map[string]string
+	substituteValues bool
+	listStrategies   map[string]string
+}
+
+func newHierarchyCommand(c *cli) *cobra.Command {
+	flags := hierarchyFlags{}
+	cmd := &cobra.Command{
+		Use:   "hierarchy",
+		Short: "Merge the parameter files listed in a hierarchy.lst",
+		Long: `Merge the parameter files listed in a hierarchy.lst, like the jobs do before
+processing the templates. The flags are compatible with the hierarchy command.`,
+		Args: cobra.NoArgs,
+		// merging doesn't need a cluster
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.hierarchy(flags)
+		},
+	}
+	cmd.Flags().StringVarP(&flags.base, "base", "b", ".", "directory holding the hierarchy file; the directories it lists are relative to it")
+	cmd.Flags().StringVarP(&flags.file, "file", "f", hierarchy.DefaultFile, "name of the hierarchy file")
+	cmd.Flags().StringVarP(&flags.output, "output", "o", "", "file where the merged parameters are written; default is the standard output")
+	cmd.Flags().BoolVar(&flags.provenance, "provenance", false, "print the file which set each value instead of the merged parameters")
+	cmd.Flags().StringToStringVar(&flags.variables, "var", nil, "variable substituted in the directories, e.g. --var PROJECT=team1")
+	cmd.Flags().BoolVar(&flags.substituteValues, "substitute-values", false, "substitute the variables in the values too, like the #@substitute-values directive")
+	cmd.Flags().StringToStringVar(&flags.listStrategies, "list-merge", nil, "merge strategy of the lists at a path, e.g. --list-merge env=merge-by:name")
+	return cmd
+}
+
+func (c *cli) hierarchy(flags hierarchyFlags) error {
+	options := hierarchy.Options{
+		File:             flags.file,
+		Variables:        flags.variables,
+		SubstituteValues: flags.substituteValues,
+		ListStrategies:   map[string]hierarchy.ListStrategy{},
+	}
+	for path, strategy := range flags.listStrategies {
+		options.ListStrategies[path] = hierarchy.ListStrategy(strategy)
+	}
+	result, err := hierarchy.Merge(flags.base, options)
+	if err != nil {
+		return err
+	}
+	if flags.provenance {
+		return result.Provenance(c.out)
+	}
+	values, err := result.YAML()
+	if err != nil {
+		return err
+	}
+	if flags.output == "" {
+		_, err = c.out.Write(values)
+		return err
+	}
+	if err := ioutil.WriteFile(flags.output, values, 0644); err != nil {
+		return fmt.Errorf("failed to write the merged parameters: %w", err)
+	}
+	return nil
+}
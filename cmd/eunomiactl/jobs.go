@@ -0,0 +1,154 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"github.com/spf13/cobra"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newLogsCommand(c *cli) *cobra.Command {
+	var follow bool
+	cmd := &cobra.Command{
+		Use:   "logs NAME",
+		Short: "Print the logs of the latest job of a GitOpsConfig",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.logs(context.TODO(), args[0], follow)
+		},
+	}
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "stream the logs until the job ends")
+	return cmd
+}
+
+func newHistoryCommand(c *cli) *cobra.Command {
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "history NAME",
+		Short: "Show the recent jobs of a GitOpsConfig",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.history(context.TODO(), args[0], limit)
+		},
+	}
+	cmd.Flags().IntVar(&limit, "limit", 10, "maximum number of jobs to show; 0 means no limit")
+	return cmd
+}
+
+// jobs returns the jobs of the GitOpsConfig name, newest first.
+func (c *cli) jobs(ctx context.Context, name string) ([]batchv1.Job, error) {
+	jobs := &batchv1.JobList{}
+	err := c.client.List(ctx, jobs, client.InNamespace(c.namespace), client.MatchingLabels{gitopsconfig.JobOwnerLabel: name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the jobs of gitopsconfig %s: %w", name, err)
+	}
+	sort.SliceStable(jobs.Items, func(i, j int) bool {
+		return jobs.Items[j].CreationTimestamp.Before(&jobs.Items[i].CreationTimestamp)
+	})
+	return jobs.Items, nil
+}
+
+// logs copies the logs of the latest pod of the latest job of the
+// GitOpsConfig name to the output.
+func (c *cli) logs(ctx context.Context, name string, follow bool) error {
+	jobs, err := c.jobs(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("gitopsconfig %s has no jobs", name)
+	}
+	job := jobs[0]
+	pods := &corev1.PodList{}
+	if err := c.client.List(ctx, pods, client.InNamespace(c.namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return fmt.Errorf("failed to list the pods of job %s: %w", job.Name, err)
+	}
+	if len(pods.Items) == 0 {
+		return fmt.Errorf("job %s has no pods", job.Name)
+	}
+	// the job may have retried; the latest pod is the most relevant one
+	pod := pods.Items[0]
+	for _, p := range pods.Items[1:] {
+		if pod.CreationTimestamp.Before(&p.CreationTimestamp) {
+			pod = p
+		}
+	}
+	stream, err := c.clientset.CoreV1().Pods(c.namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Follow: follow}).Stream()
+	if err != nil {
+		return fmt.Errorf("failed to get the logs of pod %s: %w", pod.Name, err)
+	}
+	defer stream.Close()
+	_, err = io.Copy(c.out, stream)
+	return err
+}
+
+// history prints a table of the latest jobs of the GitOpsConfig name, at
+// most limit if it's positive.
+func (c *cli) history(ctx context.Context, name string, limit int) error {
+	jobs, err := c.jobs(ctx, name)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tACTION\tSTATUS\tAGE\tDURATION")
+	for i := range jobs {
+		job := &jobs[i]
+		duration := "<none>"
+		if job.Status.StartTime != nil && job.Status.CompletionTime != nil {
+			duration = shortDuration(job.Status.CompletionTime.Sub(job.Status.StartTime.Time))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			job.Name,
+			valueOrNone(job.Labels["action"]),
+			jobStatus(job),
+			age(job.Status.StartTime),
+			duration,
+		)
+	}
+	return w.Flush()
+}
+
+// jobStatus returns a one-word summary of the status of job.
+func jobStatus(job *batchv1.Job) string {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return "Succeeded"
+		case batchv1.JobFailed:
+			return "Failed"
+		}
+	}
+	if job.Status.StartTime.IsZero() {
+		return "Pending"
+	}
+	return "Running"
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/giturl"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newListCommand(c *cli) *cobra.Command {
+	var allNamespaces bool
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the GitOpsConfigs with their state and revisions",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace := c.namespace
+			if allNamespaces {
+				namespace = ""
+			}
+			return c.list(context.TODO(), namespace)
+		},
+	}
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "list the GitOpsConfigs of all namespaces")
+	return cmd
+}
+
+// list prints a table of the GitOpsConfigs of namespace, or of all namespaces
+// if namespace is empty.
+func (c *cli) list(ctx context.Context, namespace string) error {
+	configs := &gitopsv1alpha1.GitOpsConfigList{}
+	if err := c.client.List(ctx, configs, client.InNamespace(namespace)); err != nil {
+		return fmt.Errorf("failed to list the GitOpsConfigs: %w", err)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	if namespace == "" {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tSTATE\tSUSPEND\tTEMPLATE\tPARAMETERS\tLAST RUN\tMESSAGE")
+	for _, instance := range configs.Items {
+		if namespace == "" {
+			fmt.Fprintf(w, "%s\t", instance.Namespace)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\t%s\t%s\n",
+			instance.Name,
+			valueOrNone(instance.Status.State),
+			instance.Spec.Suspend,
+			revision(instance.Spec.TemplateSource),
+			revision(instance.Spec.ParameterSource),
+			age(instance.Status.StartTime),
+			instance.Status.Message,
+		)
+	}
+	return w.Flush()
+}
+
+// revision returns a short description of the revision of source, in the
+// form "host/org/repo@ref". The defaults of the source are filled in by the
+// operator when the GitOpsConfig is initialized.
+func revision(source gitopsv1alpha1.GitConfig) string {
+	if source.URI == "" {
+		return "<none>"
+	}
+	repo := source.URI
+	if parsed, err := giturl.Parse(source.URI); err == nil {
+		repo = parsed.String()
+	}
+	return repo + "@" + source.Ref
+}
+
+// age returns the time elapsed since t in a short human-readable form, e.g.
+// "5m" or "3d".
+func age(t *metav1.Time) string {
+	if t.IsZero() {
+		return "<none>"
+	}
+	return shortDuration(time.Since(t.Time))
+}
+
+func shortDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command eunomiactl manages GitOpsConfigs from the command line. When
+// installed in the PATH as kubectl-eunomia, it can be used as a kubectl
+// plugin: kubectl eunomia list.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis"
+	"github.com/KohlsTechnology/eunomia/version"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cli holds the global flags, and the clients built from them.
+type cli struct {
+	kubeconfig string
+	context    string
+	namespace  string
+
+	out       io.Writer
+	client    client.Client
+	clientset kubernetes.Interface
+}
+
+// connect builds the clients and resolves the namespace from the flags and
+// the kubeconfig. It's a no-op if the clients are already set.
+func (c *cli) connect() error {
+	if c.client != nil {
+		return nil
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = c.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: c.context}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+	if c.namespace == "" {
+		namespace, _, err := clientConfig.Namespace()
+		if err != nil {
+			return fmt.Errorf("failed to get the namespace from the kubeconfig: %w", err)
+		}
+		c.namespace = namespace
+	}
+	cfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load the kubeconfig: %w", err)
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return err
+	}
+	if err := apis.AddToScheme(scheme); err != nil {
+		return err
+	}
+	c.client, err = client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create the client: %w", err)
+	}
+	c.clientset, err = kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create the clientset: %w", err)
+	}
+	return nil
+}
+
+func newRootCommand(c *cli) *cobra.Command {
+	use := "eunomiactl"
+	if strings.HasPrefix(filepath.Base(os.Args[0]), "kubectl-") {
+		use = "kubectl eunomia"
+	}
+	cmd := &cobra.Command{
+		Use:           use,
+		Short:         "Manage Eunomia GitOpsConfigs",
+		Version:       version.Version,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return c.connect()
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&c.kubeconfig, "kubeconfig", "", "path to the kubeconfig file to use")
+	flags.StringVar(&c.context, "context", "", "name of the kubeconfig context to use")
+	flags.StringVarP(&c.namespace, "namespace", "n", "", "namespace of the GitOpsConfigs; defaults to the namespace of the kubeconfig context")
+
+	cmd.AddCommand(
+		newListCommand(c),
+		newTriggerCommand(c),
+		newSuspendCommand(c, true),
+		newSuspendCommand(c, false),
+		newLogsCommand(c),
+		newHistoryCommand(c),
+		newWaitCommand(c),
+		newRenderCommand(c),
+		newHierarchyCommand(c),
+	)
+	return cmd
+}
+
+func main() {
+	c := &cli{out: os.Stdout}
+	if err := newRootCommand(c).Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis"
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestCLI(t *testing.T, objs ...runtime.Object) (*cli, *bytes.Buffer) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := apis.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	return &cli{
+		namespace: "gitops",
+		out:       out,
+		client:    fake.NewFakeClientWithScheme(scheme, objs...),
+	}, out
+}
+
+func testConfig(name string) *gitopsv1alpha1.GitOpsConfig {
+	return &gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "gitops"},
+		Spec: gitopsv1alpha1.GitOpsConfigSpec{
+			TemplateSource:  gitopsv1alpha1.GitConfig{URI: "https://github.com/KohlsTechnology/eunomia.git", Ref: "master"},
+			ParameterSource: gitopsv1alpha1.GitConfig{URI: "git@github.com:org/params.git", Ref: "v1.0.0"},
+		},
+		Status: gitopsv1alpha1.GitOpsConfigStatus{State: "Success"},
+	}
+}
+
+func testJob(name, owner string, created time.Time, status batchv1.JobStatus) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "gitops",
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{gitopsconfig.JobOwnerLabel: owner, "action": "create"},
+		},
+		Status: status,
+	}
+}
+
+func TestList(t *testing.T) {
+	c, out := newTestCLI(t, testConfig("app"))
+	if err := c.list(context.TODO(), "gitops"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a header and 1 row, got %q", out.String())
+	}
+	for _, want := range []string{"app", "Success", "github.com/kohlstechnology/eunomia@master", "github.com/org/params@v1.0.0"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("expected %q in %q", want, lines[1])
+		}
+	}
+}
+
+func TestTriggerAndSuspend(t *testing.T) {
+	c, _ := newTestCLI(t, testConfig("app"))
+	ctx := context.TODO()
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := c.trigger(ctx, "app", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.setSuspend(ctx, "app", true); err != nil {
+		t.Fatal(err)
+	}
+	instance, err := c.getConfig(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := instance.Annotations[gitopsconfig.SyncRequestedAnnotation]; got != "2021-03-01T12:00:00Z" {
+		t.Errorf("unexpected sync request %q", got)
+	}
+	if !instance.Spec.Suspend {
+		t.Error("expected the GitOpsConfig to be suspended")
+	}
+	if err := c.trigger(ctx, "missing", now); err == nil {
+		t.Error("expected an error for a missing GitOpsConfig")
+	}
+}
+
+func TestJobsAndHistory(t *testing.T) {
+	now := time.Now()
+	started := metav1.NewTime(now.Add(-time.Hour))
+	finished := metav1.NewTime(now.Add(-time.Hour + 90*time.Second))
+	c, out := newTestCLI(t,
+		testJob("gitopsconfig-app-old", "app", now.Add(-time.Hour), batchv1.JobStatus{
+			StartTime:      &started,
+			CompletionTime: &finished,
+			Conditions:     []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		}),
+		testJob("gitopsconfig-app-new", "app", now, batchv1.JobStatus{StartTime: &started, Active: 1}),
+		testJob("gitopsconfig-other-abc", "other", now, batchv1.JobStatus{}),
+	)
+	jobs, err := c.jobs(context.TODO(), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].Name != "gitopsconfig-app-new" {
+		t.Fatalf("expected the 2 jobs of app, newest first, got %v", jobs)
+	}
+	if err := c.history(context.TODO(), "app", 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "gitopsconfig-app-new") || strings.Contains(out.String(), "gitopsconfig-app-old") {
+		t.Errorf("expected only the newest job, got %q", out.String())
+	}
+	if got := jobStatus(&jobs[1]); got != "Succeeded" {
+		t.Errorf("expected Succeeded, got %s", got)
+	}
+	if got := jobStatus(&jobs[0]); got != "Running" {
+		t.Errorf("expected Running, got %s", got)
+	}
+}
+
+func TestSynced(t *testing.T) {
+	started := metav1.Now()
+	running := *testJob("gitopsconfig-app-1", "app", time.Now(), batchv1.JobStatus{StartTime: &started, Active: 1})
+	done := *testJob("gitopsconfig-app-1", "app", time.Now(), batchv1.JobStatus{
+		StartTime:  &started,
+		Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+	})
+	tests := []struct {
+		comment    string
+		state      string
+		requested  string
+		handled    string
+		jobs       []batchv1.Job
+		wantSynced bool
+		wantErr    bool
+	}{
+		{"success", "Success", "", "", []batchv1.Job{done}, true, false},
+		{"handled sync request", "Success", "1", "1", nil, true, false},
+		{"pending sync request", "Success", "2", "1", nil, false, false},
+		{"running job", "Success", "", "", []batchv1.Job{running}, false, false},
+		{"in progress", "InProgress", "", "", nil, false, false},
+		{"failure", "Failure", "", "", nil, false, true},
+	}
+	for _, tt := range tests {
+		instance := testConfig("app")
+		instance.Status.State = tt.state
+		instance.Status.LastHandledSyncRequest = tt.handled
+		if tt.requested != "" {
+			instance.Annotations = map[string]string{gitopsconfig.SyncRequestedAnnotation: tt.requested}
+		}
+		got, err := synced(instance, tt.jobs)
+		if got != tt.wantSynced || (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected %t (error %t), got %t (%v)", tt.comment, tt.wantSynced, tt.wantErr, got, err)
+		}
+	}
+}
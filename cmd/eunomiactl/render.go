@@ -0,0 +1,109 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/render"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+)
+
+type renderFlags struct {
+	configFile   string
+	templateDir  string
+	parameterDir string
+	processor    string
+	outputDir    string
+}
+
+func newRenderCommand(c *cli) *cobra.Command {
+	flags := renderFlags{}
+	cmd := &cobra.Command{
+		Use:   "render -f GITOPSCONFIG --templates DIR --parameters DIR",
+		Short: "Render the manifests of a GitOpsConfig from local directories, without a cluster",
+		Long: `Render the manifests of a GitOpsConfig like its jobs do: the parameters are
+merged according to hierarchy.lst, the templates are processed by the template
+processor of the GitOpsConfig, and the owner and applied labels are added.
+The template and parameter directories are local checkouts of the
+repositories; the contextDirs of the GitOpsConfig are relative to them.`,
+		Args: cobra.NoArgs,
+		// rendering doesn't need a cluster
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.render(flags)
+		},
+	}
+	cmd.Flags().StringVarP(&flags.configFile, "filename", "f", "", "YAML file holding the GitOpsConfig")
+	cmd.Flags().StringVar(&flags.templateDir, "templates", "", "local checkout of the template repository")
+	cmd.Flags().StringVar(&flags.parameterDir, "parameters", "", "local checkout of the parameter repository; default is the template directory")
+	cmd.Flags().StringVar(&flags.processor, "processor", "", "template processor overriding the one selected from templateProcessorImage: base, helm, jinja or ocp-template")
+	cmd.Flags().StringVarP(&flags.outputDir, "output-dir", "o", "", "directory where the manifests are written; default is the standard output")
+	_ = cmd.MarkFlagRequired("filename")
+	_ = cmd.MarkFlagRequired("templates")
+	return cmd
+}
+
+func (c *cli) render(flags renderFlags) error {
+	text, err := ioutil.ReadFile(flags.configFile)
+	if err != nil {
+		return fmt.Errorf("failed to read the GitOpsConfig: %w", err)
+	}
+	config := &gitopsv1alpha1.GitOpsConfig{}
+	if err := yaml.Unmarshal(text, config); err != nil {
+		return fmt.Errorf("failed to parse the GitOpsConfig in %s: %w", flags.configFile, err)
+	}
+	if config.Namespace == "" {
+		config.Namespace = c.namespace
+	}
+	parameterDir := flags.parameterDir
+	if parameterDir == "" {
+		parameterDir = flags.templateDir
+	}
+	manifests, err := render.Render(render.Options{
+		Config:       config,
+		TemplateDir:  flags.templateDir,
+		ParameterDir: parameterDir,
+		Processor:    flags.processor,
+	})
+	if err != nil {
+		return err
+	}
+
+	if flags.outputDir == "" {
+		for _, manifest := range manifests {
+			fmt.Fprintf(c.out, "---\n# Source: %s\n%s", manifest.Path, manifest.Content)
+		}
+		return nil
+	}
+	for _, manifest := range manifests {
+		path := filepath.Join(flags.outputDir, filepath.FromSlash(manifest.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, manifest.Content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	fmt.Fprintf(c.out, "%d manifests written to %s\n", len(manifests), flags.outputDir)
+	return nil
+}
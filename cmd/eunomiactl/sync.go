@@ -0,0 +1,118 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTriggerCommand(c *cli) *cobra.Command {
+	var wait bool
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:     "trigger NAME",
+		Aliases: []string{"sync"},
+		Short:   "Request a run of a GitOpsConfig",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.TODO()
+			if err := c.trigger(ctx, args[0], time.Now()); err != nil {
+				return err
+			}
+			if !wait {
+				return nil
+			}
+			return c.wait(ctx, args[0], timeout, defaultPollInterval)
+		},
+	}
+	cmd.Flags().BoolVar(&wait, "wait", false, "wait until the run succeeds")
+	cmd.Flags().DurationVar(&timeout, "timeout", defaultWaitTimeout, "maximum time to wait for, with --wait")
+	return cmd
+}
+
+func newSuspendCommand(c *cli, suspend bool) *cobra.Command {
+	use, short := "resume NAME", "Resume the runs of a GitOpsConfig"
+	if suspend {
+		use, short = "suspend NAME", "Suspend the runs of a GitOpsConfig, until it's resumed"
+	}
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.setSuspend(context.TODO(), args[0], suspend)
+		},
+	}
+}
+
+// trigger requests a run of the GitOpsConfig name by setting its
+// sync-requested annotation to now.
+func (c *cli) trigger(ctx context.Context, name string, now time.Time) error {
+	instance, err := c.getConfig(ctx, name)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(instance.DeepCopy())
+	if instance.Annotations == nil {
+		instance.Annotations = map[string]string{}
+	}
+	instance.Annotations[gitopsconfig.SyncRequestedAnnotation] = now.UTC().Format(time.RFC3339Nano)
+	if err := c.client.Patch(ctx, instance, patch); err != nil {
+		return fmt.Errorf("failed to request a run of gitopsconfig %s: %w", name, err)
+	}
+	fmt.Fprintf(c.out, "gitopsconfig/%s run requested\n", name)
+	return nil
+}
+
+// setSuspend sets spec.suspend of the GitOpsConfig name.
+func (c *cli) setSuspend(ctx context.Context, name string, suspend bool) error {
+	instance, err := c.getConfig(ctx, name)
+	if err != nil {
+		return err
+	}
+	action := "resumed"
+	if suspend {
+		action = "suspended"
+	}
+	if instance.Spec.Suspend == suspend {
+		fmt.Fprintf(c.out, "gitopsconfig/%s already %s\n", name, action)
+		return nil
+	}
+	patch := client.MergeFrom(instance.DeepCopy())
+	instance.Spec.Suspend = suspend
+	if err := c.client.Patch(ctx, instance, patch); err != nil {
+		return fmt.Errorf("failed to update gitopsconfig %s: %w", name, err)
+	}
+	fmt.Fprintf(c.out, "gitopsconfig/%s %s\n", name, action)
+	return nil
+}
+
+func (c *cli) getConfig(ctx context.Context, name string) (*gitopsv1alpha1.GitOpsConfig, error) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	if err := c.client.Get(ctx, types.NamespacedName{Namespace: c.namespace, Name: name}, instance); err != nil {
+		return nil, fmt.Errorf("failed to get gitopsconfig %s: %w", name, err)
+	}
+	return instance, nil
+}
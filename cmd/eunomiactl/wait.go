@@ -0,0 +1,94 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"github.com/spf13/cobra"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultWaitTimeout  = 10 * time.Minute
+	defaultPollInterval = 2 * time.Second
+)
+
+func newWaitCommand(c *cli) *cobra.Command {
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "wait NAME",
+		Short: "Wait until a GitOpsConfig has no pending run and its last run succeeded",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.wait(context.TODO(), args[0], timeout, defaultPollInterval)
+		},
+	}
+	cmd.Flags().DurationVar(&timeout, "timeout", defaultWaitTimeout, "maximum time to wait for")
+	return cmd
+}
+
+// wait polls the GitOpsConfig name until it's synced. It fails early if the
+// last run failed.
+func (c *cli) wait(ctx context.Context, name string, timeout, interval time.Duration) error {
+	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
+		instance, err := c.getConfig(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		jobs, err := c.jobs(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		return synced(instance, jobs)
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("timed out waiting for gitopsconfig %s to be synced", name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "gitopsconfig/%s synced\n", name)
+	return nil
+}
+
+// synced returns true if instance has no pending run, none of its jobs are
+// running, and its last run succeeded. It returns an error if the last run
+// failed.
+func synced(instance *gitopsv1alpha1.GitOpsConfig, jobs []batchv1.Job) (bool, error) {
+	if value := instance.Annotations[gitopsconfig.SyncRequestedAnnotation]; value != instance.Status.LastHandledSyncRequest {
+		return false, nil
+	}
+	for i := range jobs {
+		if jobStatus(&jobs[i]) == "Pending" || jobStatus(&jobs[i]) == "Running" {
+			return false, nil
+		}
+	}
+	switch instance.Status.State {
+	case "Success":
+		return true, nil
+	case "Failure":
+		return false, fmt.Errorf("the last run of gitopsconfig %s failed: %s", instance.Name, instance.Status.Message)
+	default:
+		return false, nil
+	}
+}
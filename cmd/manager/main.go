@@ -23,11 +23,14 @@ import (
 	"net/http"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/KohlsTechnology/eunomia/pkg/apis"
 	"github.com/KohlsTechnology/eunomia/pkg/controller"
 	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
 	"github.com/KohlsTechnology/eunomia/pkg/handler"
+	"github.com/KohlsTechnology/eunomia/pkg/imagepolicy"
+	"github.com/KohlsTechnology/eunomia/pkg/syncwindow"
 	"github.com/KohlsTechnology/eunomia/pkg/util"
 	"github.com/KohlsTechnology/eunomia/version"
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
@@ -53,6 +56,30 @@ var (
 )
 var log = logf.Log.WithName("cmd").WithValues("filename", "main.go")
 
+// templateEvents returns a function emitting events on the operator's pod,
+// reporting the versions of the job templates in use, and the rejected
+// templates. No events are emitted when the pod is unknown, e.g. when running
+// outside of the cluster.
+func templateEvents(mgr manager.Manager) func(util.TemplateVersions, error) {
+	podName := os.Getenv(k8sutil.PodNameEnvVar)
+	namespace, err := k8sutil.GetOperatorNamespace()
+	if podName == "" || err != nil {
+		log.Info("Operator pod unknown, job template events are disabled")
+		return nil
+	}
+	pod := &corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: namespace, Name: podName}
+	recorder := mgr.GetEventRecorderFor("eunomia-operator")
+	return func(versions util.TemplateVersions, err error) {
+		if err != nil {
+			recorder.Eventf(pod, corev1.EventTypeWarning, "JobTemplatesRejected",
+				"Invalid job templates, keeping job template %s and cronjob template %s: %v", versions.Job, versions.CronJob, err)
+			return
+		}
+		recorder.Eventf(pod, corev1.EventTypeNormal, "JobTemplatesLoaded",
+			"Using job template %s and cronjob template %s", versions.Job, versions.CronJob)
+	}
+}
+
 func printVersion() {
 	log.Info(fmt.Sprintf("Eunomia version: %s (build date: %s, branch: %s, git SHA1: %s)", version.Version, version.BuildDate, version.Branch, version.GitSHA1))
 	log.Info(fmt.Sprintf("Go Version: %s", runtime.Version()))
@@ -70,7 +97,21 @@ func main() {
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 
 	versionFlag := pflag.Bool("version", false, "print version information and exit")
-
+	imagePolicyFile := pflag.String("image-policy-file", "", "path to a YAML file with the image policy restricting the images run by the jobs; any image is allowed if not set")
+	syncWindowsFile := pflag.String("sync-windows-file", "", "path to a YAML file with a list of cluster-wide sync windows, applied to all GitOpsConfigs")
+	maxConcurrentJobs := pflag.Int("max-concurrent-jobs", 0, "maximum number of Eunomia jobs running at the same time in the cluster; 0 means no limit")
+	maxConcurrentJobsPerNamespace := pflag.Int("max-concurrent-jobs-per-namespace", 0, "maximum number of Eunomia jobs running at the same time in a single namespace; 0 means no limit")
+
+	jobTemplateCatalogs := pflag.StringArray("job-template-catalog-namespace", nil, "namespace in which any GitOpsConfig can reference a job template ConfigMap, besides its own namespace; can be repeated")
+	webhookDebounce := pflag.Duration("webhook-debounce", 5*time.Second, "delay before starting the job requested by a webhook; the runs requested during the delay are collapsed into one")
+	webhookRequireSecret := pflag.Bool("webhook-require-secret", false, "ignore the webhook events for the GitOpsConfigs whose Webhook or PullRequest trigger has no secret")
+	serverOptions := handler.ServerOptions{}
+	pflag.StringVar(&serverOptions.Addr, "web-bind-address", ":8080", "address the webhook, trigger and health endpoints listen on")
+	pflag.StringVar(&serverOptions.CertFile, "web-tls-cert-file", "", "path to the TLS certificate of the web server, reloaded when modified; plain HTTP is used if not set")
+	pflag.StringVar(&serverOptions.KeyFile, "web-tls-key-file", "", "path to the TLS key of the web server, reloaded when modified")
+	pflag.DurationVar(&serverOptions.ReadTimeout, "web-read-timeout", 30*time.Second, "maximum duration for reading a request to the web server")
+	pflag.DurationVar(&serverOptions.WriteTimeout, "web-write-timeout", 30*time.Second, "maximum duration for writing the response to a request to the web server")
+	pflag.Int64Var(&serverOptions.MaxBodySize, "web-max-body-size", 25<<20, "maximum size in bytes of the body of requests to the web server; 0 means no limit")
 	pflag.Parse()
 
 	// Use a zap logr.Logger implementation. If none of the zap
@@ -123,8 +164,37 @@ func main() {
 		log.Info("CRONJOB_TEMPLATE not set. Using default job template.")
 		cjt = "/default-job-templates/cronjob.yaml"
 	}
-	util.InitializeTemplates(jt, cjt) //nolint:errcheck
-	log.Info("Templates initialized correctly")
+	err = util.InitializeTemplates(jt, cjt)
+	if err != nil {
+		log.Error(err, "Failed to initialize the job templates")
+		os.Exit(1)
+	}
+	versions := util.CurrentTemplateVersions()
+	log.Info("Templates initialized correctly", "job", versions.Job, "cronjob", versions.CronJob)
+
+	if *imagePolicyFile != "" {
+		err = imagepolicy.InitializeGlobalPolicy(*imagePolicyFile)
+		if err != nil {
+			log.Error(err, "Failed to initialize the image policy")
+			os.Exit(1)
+		}
+		log.Info("Image policy initialized correctly", "file", *imagePolicyFile)
+	}
+
+	if *syncWindowsFile != "" {
+		err = syncwindow.InitializeGlobalWindows(*syncWindowsFile)
+		if err != nil {
+			log.Error(err, "Failed to initialize cluster-wide sync windows")
+			os.Exit(1)
+		}
+		log.Info("Cluster-wide sync windows initialized correctly", "file", *syncWindowsFile)
+	}
+
+	gitopsconfig.SetConcurrencyLimits(gitopsconfig.ConcurrencyLimits{
+		MaxJobs:             *maxConcurrentJobs,
+		MaxJobsPerNamespace: *maxConcurrentJobsPerNamespace,
+	})
+	gitopsconfig.SetJobTemplateCatalogs(*jobTemplateCatalogs)
 
 	// Get a config to talk to the apiserver
 	cfg, err := config.GetConfig()
@@ -146,6 +216,8 @@ func main() {
 	mgr, err := manager.New(cfg, manager.Options{
 		Namespace:          namespace,
 		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
+		// Only the Jobs owned by GitOpsConfigs are cached
+		NewCache: gitopsconfig.NewCache,
 	})
 	if err != nil {
 		log.Error(err, "")
@@ -166,6 +238,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Reload the job templates when their files are modified
+	templateWatcher := &util.TemplateWatcher{OnReload: templateEvents(mgr)}
+	if err := mgr.Add(templateWatcher); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
 	// Create Service object to expose the metrics port.
 	// commented because service is generated via a manifest at deploy time.
 	// servicePorts := []v1.ServicePort{
@@ -177,11 +256,22 @@ func main() {
 
 	// Set up WebHook listener and healthz endpoint
 
+	webhookReconciler := gitopsconfig.NewReconciler(mgr)
+	dispatcher := handler.NewDispatcher(&webhookReconciler, *webhookDebounce, *webhookRequireSecret)
+	if err := mgr.Add(dispatcher); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/webhook/", func(w http.ResponseWriter, r *http.Request) {
-		handler.WebhookHandler(w, r, gitopsconfig.NewReconciler(mgr))
+	mux.HandleFunc("/webhook/", dispatcher.WebhookHandler)
+	mux.HandleFunc(handler.TriggerPath, func(w http.ResponseWriter, r *http.Request) {
+		reconciler := gitopsconfig.NewReconciler(mgr)
+		handler.TriggerHandler(w, r, &reconciler)
 	})
 
+	mux.HandleFunc(handler.AdmissionPath, handler.AdmissionHandler)
+
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok")) //nolint:errcheck
@@ -201,8 +291,16 @@ func main() {
 		w.Write([]byte("ok")) //nolint:errcheck
 	})
 
-	log.Info("Starting the Web Server")
-	go http.ListenAndServe(":8080", mux) //nolint:errcheck
+	// The server is started and gracefully stopped with the manager
+	server, err := handler.NewServer(serverOptions, mux)
+	if err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+	if err := mgr.Add(server); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
 
 	log.Info("Starting the Cmd.")
 
@@ -18,16 +18,49 @@ type GitConfig struct {
 	SecretRef  string `json:"secretRef,omitempty"`
 }
 
-// GitOpsTrigger represents a trigger, possible type values are change, periodic, webhook.
-// If token is used the object must be labeled with the following label: "gitops_config.eunomia.kohls.io/webhook_token: <token>"
+// GitOpsTrigger represents a trigger, possible type values are change, periodic, webhook, pullrequest, poll, referencechange.
 type GitOpsTrigger struct {
-	// Type supported types are Change, Periodic, Webhook
-	// +kubebuilder:validation:Enum=Change;Periodic;Webhook
+	// Type supported types are Change, Periodic, Webhook, PullRequest, Poll, ReferenceChange
+	// +kubebuilder:validation:Enum=Change;Periodic;Webhook;PullRequest;Poll;ReferenceChange
 	Type string `json:"type,omitempty"`
 	// cron expression only valid with the Periodic type
 	Cron string `json:"cron,omitempty"`
-	// webhook secret only valid with webhook type
+	// Interval between two checks of the remote refs for new commits, e.g. "5m", only valid with the Poll type. Default is 5m
+	Interval string `json:"interval,omitempty"`
+	// webhook secret only valid with webhook and pullrequest types
 	Secret string `json:"secret,omitempty"`
+	// TokenSecretRef is the name of a Secret in the namespace of the GitOpsConfig, whose "token" key holds the token authenticating calls to the /trigger endpoint, only valid with webhook type
+	TokenSecretRef string `json:"tokenSecretRef,omitempty"`
+	// IncludePaths are globs of repository paths, e.g. "apps/app1/**"; pushes not changing any matching file don't trigger a run, only valid with webhook type. Default is the contextDir of the sources
+	IncludePaths []string `json:"includePaths,omitempty"`
+	// ExcludePaths are globs of repository paths whose changes never trigger a run, only valid with webhook type
+	ExcludePaths []string `json:"excludePaths,omitempty"`
+}
+
+// SyncWindow represents a recurring period of time during which runs of a
+// GitOpsConfig are either allowed or denied. When any Deny window is active, or
+// when Allow windows are defined but none of them is active, new runs are
+// deferred until the next time the windows open.
+type SyncWindow struct {
+	// Kind of the window, supported values are Allow, Deny
+	// +kubebuilder:validation:Enum=Allow;Deny
+	Kind string `json:"kind,omitempty"`
+	// Schedule is a cron expression marking the start of each occurrence of the window
+	Schedule string `json:"schedule,omitempty"`
+	// Duration of each occurrence of the window, e.g. "1h30m"
+	Duration string `json:"duration,omitempty"`
+	// TimeZone in which Schedule is evaluated, e.g. "America/Chicago". Default is UTC
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// JobTemplateReference references a ConfigMap holding the templates of the
+// jobs and cronjobs of a GitOpsConfig, in its "job.yaml" and "cronjob.yaml"
+// keys. A missing key means the operator's template is used for that kind.
+type JobTemplateReference struct {
+	// Name of the ConfigMap
+	Name string `json:"name"`
+	// Namespace of the ConfigMap, either the namespace of the GitOpsConfig or one of the job template catalog namespaces allowed by the operator. Default is the namespace of the GitOpsConfig
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // GitOpsConfigSpec defines the desired state of GitOpsConfig
@@ -46,8 +79,10 @@ type GitOpsConfigSpec struct {
 	Triggers []GitOpsTrigger `json:"triggers,omitempty"`
 	// ServiceAccountRef references to the service account under which the template engine job will run, it must exists in the namespace in which this CR is created
 	ServiceAccountRef string `json:"serviceAccountRef,omitempty"`
-	// TemplateEngine, the gitops operator config map contains the list of available template engines, the value used here must exist in that list. Identity (i.e. no resource processing) is the default
+	// TemplateProcessorImage is the image of the template processor, used when TemplateProcessorRef is not set
 	TemplateProcessorImage string `json:"templateProcessorImage,omitempty"`
+	// TemplateProcessorRef is the name of a TemplateProcessor, whose image, default arguments and environment variables are used instead of TemplateProcessorImage
+	TemplateProcessorRef string `json:"templateProcessorRef,omitempty"`
 	// ResourceHandlingMode represents how resource creation/update should be handled. Supported values are Apply,Create,Delete,Patch,Replace,None. Default is Apply.
 	// +kubebuilder:validation:Enum=Apply;Create;Delete;Patch;Replace;None
 	ResourceHandlingMode string `json:"resourceHandlingMode,omitempty"`
@@ -56,6 +91,17 @@ type GitOpsConfigSpec struct {
 	ResourceDeletionMode string `json:"resourceDeletionMode,omitempty"`
 	// TemplateProcessorArgs references to the run time parameters, we can pass additional arguments/flags to the template processor.
 	TemplateProcessorArgs string `json:"templateProcessorArgs,omitempty"`
+	// SyncWindows restrict the periods of time in which new runs can be started; they are combined with the cluster-wide sync windows configured in the operator
+	// +listType=atomic
+	SyncWindows []SyncWindow `json:"syncWindows,omitempty"`
+	// TargetNamespace is the namespace in which the resources not specifying a namespace are created; the service account must be allowed to manage resources in it. Default is the namespace of the GitOpsConfig
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+	// Priority orders the runs queued because of the operator's concurrency limits; queued runs with a higher priority are started first. Default is 0
+	Priority int32 `json:"priority,omitempty"`
+	// Suspend stops new runs from being started while it's true; the runs requested in the meantime are deferred until it's set back to false. Deletion is not affected
+	Suspend bool `json:"suspend,omitempty"`
+	// JobTemplateRef references a ConfigMap holding custom templates for the jobs and cronjobs of this configuration, replacing the operator's templates
+	JobTemplateRef *JobTemplateReference `json:"jobTemplateRef,omitempty"`
 }
 
 // GitOpsConfigStatus defines the observed state of GitOpsConfig
@@ -70,6 +116,22 @@ type GitOpsConfigStatus struct {
 	CompletionTime   *metav1.Time `json:"completionTime,omitempty"`
 	Message          string       `json:"message,omitempty"`
 	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// ObservedGeneration is the .metadata.generation for which the most recent run was started
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastHandledSyncRequest is the value of the eunomia.kohls.io/sync-requested annotation for which the most recent run was started
+	LastHandledSyncRequest string `json:"lastHandledSyncRequest,omitempty"`
+	// TemplateRevision is the commit SHA of the template source for which the most recent run was started, when it was resolved by the Poll trigger
+	TemplateRevision string `json:"templateRevision,omitempty"`
+	// ParameterRevision is the commit SHA of the parameter source for which the most recent run was started, when it was resolved by the Poll trigger
+	ParameterRevision string `json:"parameterRevision,omitempty"`
+	// PendingTemplateRevision is the revision of the template source requested by the trigger endpoint, or the commit SHA resolved by the Poll trigger, for the pending run, which deploys it once it starts
+	PendingTemplateRevision string `json:"pendingTemplateRevision,omitempty"`
+	// PendingParameterRevision is the revision of the parameter source requested by the trigger endpoint, or the commit SHA resolved by the Poll trigger, for the pending run, which deploys it once it starts
+	PendingParameterRevision string `json:"pendingParameterRevision,omitempty"`
+	// ReferencesHash is the hash of the content of the Secrets, ServiceAccount, job template ConfigMap and TemplateProcessor referenced by the spec, salted with the UID of the GitOpsConfig, as last seen by the operator with the ReferenceChange trigger
+	ReferencesHash string `json:"referencesHash,omitempty"`
+	// QueuedTime is when the pending run was queued by the concurrency limits; the queued runs of the same priority are started in this order
+	QueuedTime *metav1.Time `json:"queuedTime,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -0,0 +1,48 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TemplateProcessorSpec defines a template processor which GitOpsConfigs can
+// reference by name
+// +k8s:openapi-gen=true
+type TemplateProcessorSpec struct {
+	// Image of the template processor
+	Image string `json:"image"`
+	// Args are the default run time arguments of the template processor, used when the GitOpsConfig doesn't set templateProcessorArgs
+	Args string `json:"args,omitempty"`
+	// SupportedModes are the resourceHandlingModes supported by the template processor. Default is all modes
+	// +listType=set
+	SupportedModes []string `json:"supportedModes,omitempty"`
+	// Env are the environment variables required by the template processor, added to its container in the jobs
+	// +listType=atomic
+	Env []corev1.EnvVar `json:"env,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// TemplateProcessor is the Schema for the templateprocessors API
+// +k8s:openapi-gen=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Image",type=string,JSONPath=`.spec.image`
+type TemplateProcessor struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TemplateProcessorSpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// TemplateProcessorList contains a list of TemplateProcessor
+type TemplateProcessorList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TemplateProcessor `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TemplateProcessor{}, &TemplateProcessorList{})
+}
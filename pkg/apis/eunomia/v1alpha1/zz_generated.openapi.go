@@ -30,9 +30,11 @@ import (
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
-		"./pkg/apis/eunomia/v1alpha1.GitOpsConfig":       schema_pkg_apis_eunomia_v1alpha1_GitOpsConfig(ref),
-		"./pkg/apis/eunomia/v1alpha1.GitOpsConfigSpec":   schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigSpec(ref),
-		"./pkg/apis/eunomia/v1alpha1.GitOpsConfigStatus": schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigStatus(ref),
+		"./pkg/apis/eunomia/v1alpha1.GitOpsConfig":          schema_pkg_apis_eunomia_v1alpha1_GitOpsConfig(ref),
+		"./pkg/apis/eunomia/v1alpha1.GitOpsConfigSpec":      schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigSpec(ref),
+		"./pkg/apis/eunomia/v1alpha1.GitOpsConfigStatus":    schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigStatus(ref),
+		"./pkg/apis/eunomia/v1alpha1.TemplateProcessor":     schema_pkg_apis_eunomia_v1alpha1_TemplateProcessor(ref),
+		"./pkg/apis/eunomia/v1alpha1.TemplateProcessorSpec": schema_pkg_apis_eunomia_v1alpha1_TemplateProcessorSpec(ref),
 	}
 }
 
@@ -126,7 +128,14 @@ func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigSpec(ref common.ReferenceCallb
 					},
 					"templateProcessorImage": {
 						SchemaProps: spec.SchemaProps{
-							Description: "TemplateEngine, the gitops operator config map contains the list of available template engines, the value used here must exist in that list. Identity (i.e. no resource processing) is the default",
+							Description: "TemplateProcessorImage is the image of the template processor, used when TemplateProcessorRef is not set",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"templateProcessorRef": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TemplateProcessorRef is the name of a TemplateProcessor, whose image, default arguments and environment variables are used instead of TemplateProcessorImage",
 							Type:        []string{"string"},
 							Format:      "",
 						},
@@ -152,11 +161,56 @@ func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigSpec(ref common.ReferenceCallb
 							Format:      "",
 						},
 					},
+					"syncWindows": {
+						VendorExtensible: spec.VendorExtensible{
+							Extensions: spec.Extensions{
+								"x-kubernetes-list-type": "atomic",
+							},
+						},
+						SchemaProps: spec.SchemaProps{
+							Description: "SyncWindows restrict the periods of time in which new runs can be started; they are combined with the cluster-wide sync windows configured in the operator",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("./pkg/apis/eunomia/v1alpha1.SyncWindow"),
+									},
+								},
+							},
+						},
+					},
+					"targetNamespace": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TargetNamespace is the namespace in which the resources not specifying a namespace are created; the service account must be allowed to manage resources in it. Default is the namespace of the GitOpsConfig",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"priority": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Priority orders the runs queued because of the operator's concurrency limits; queued runs with a higher priority are started first. Default is 0",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"suspend": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Suspend stops new runs from being started while it's true; the runs requested in the meantime are deferred until it's set back to false. Deletion is not affected",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"jobTemplateRef": {
+						SchemaProps: spec.SchemaProps{
+							Description: "JobTemplateRef references a ConfigMap holding custom templates for the jobs and cronjobs of this configuration, replacing the operator's templates",
+							Ref:         ref("./pkg/apis/eunomia/v1alpha1.JobTemplateReference"),
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"./pkg/apis/eunomia/v1alpha1.GitConfig", "./pkg/apis/eunomia/v1alpha1.GitOpsTrigger"},
+			"./pkg/apis/eunomia/v1alpha1.GitConfig", "./pkg/apis/eunomia/v1alpha1.GitOpsTrigger", "./pkg/apis/eunomia/v1alpha1.JobTemplateReference", "./pkg/apis/eunomia/v1alpha1.SyncWindow"},
 	}
 }
 
@@ -194,6 +248,61 @@ func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigStatus(ref common.ReferenceCal
 							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
 						},
 					},
+					"observedGeneration": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ObservedGeneration is the .metadata.generation for which the most recent run was started",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"lastHandledSyncRequest": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastHandledSyncRequest is the value of the eunomia.kohls.io/sync-requested annotation for which the most recent run was started",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"templateRevision": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TemplateRevision is the commit SHA of the template source for which the most recent run was started, when it was resolved by the Poll trigger",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"parameterRevision": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ParameterRevision is the commit SHA of the parameter source for which the most recent run was started, when it was resolved by the Poll trigger",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"pendingTemplateRevision": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PendingTemplateRevision is the revision of the template source requested by the trigger endpoint, or the commit SHA resolved by the Poll trigger, for the pending run, which deploys it once it starts",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"pendingParameterRevision": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PendingParameterRevision is the revision of the parameter source requested by the trigger endpoint, or the commit SHA resolved by the Poll trigger, for the pending run, which deploys it once it starts",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"referencesHash": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ReferencesHash is the hash of the content of the Secrets, ServiceAccount, job template ConfigMap and TemplateProcessor referenced by the spec, salted with the UID of the GitOpsConfig, as last seen by the operator with the ReferenceChange trigger",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"queuedTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "QueuedTime is when the pending run was queued by the concurrency limits; the queued runs of the same priority are started in this order",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
 				},
 			},
 		},
@@ -201,3 +310,109 @@ func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigStatus(ref common.ReferenceCal
 			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
+
+func schema_pkg_apis_eunomia_v1alpha1_TemplateProcessor(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "TemplateProcessor is the Schema for the templateprocessors API",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("./pkg/apis/eunomia/v1alpha1.TemplateProcessorSpec"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"./pkg/apis/eunomia/v1alpha1.TemplateProcessorSpec", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_eunomia_v1alpha1_TemplateProcessorSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "TemplateProcessorSpec defines a template processor which GitOpsConfigs can reference by name",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"image": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Image of the template processor",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"args": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Args are the default run time arguments of the template processor, used when the GitOpsConfig doesn't set templateProcessorArgs",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"supportedModes": {
+						VendorExtensible: spec.VendorExtensible{
+							Extensions: spec.Extensions{
+								"x-kubernetes-list-type": "set",
+							},
+						},
+						SchemaProps: spec.SchemaProps{
+							Description: "SupportedModes are the resourceHandlingModes supported by the template processor. Default is all modes",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"env": {
+						VendorExtensible: spec.VendorExtensible{
+							Extensions: spec.Extensions{
+								"x-kubernetes-list-type": "atomic",
+							},
+						},
+						SchemaProps: spec.SchemaProps{
+							Description: "Env are the environment variables required by the template processor, added to its container in the jobs",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("k8s.io/api/core/v1.EnvVar"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"image"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/api/core/v1.EnvVar"},
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// queuedRequeueDelay is how often a queued run checks if it can be started.
+const queuedRequeueDelay = 10 * time.Second
+
+// ConcurrencyLimits are the operator-wide limits on the number of Eunomia
+// jobs running at the same time. A zero value means no limit.
+type ConcurrencyLimits struct {
+	// MaxJobs is the maximum number of jobs running in the whole cluster.
+	MaxJobs int
+	// MaxJobsPerNamespace is the maximum number of jobs running in a single namespace.
+	MaxJobsPerNamespace int
+}
+
+// concurrencyLimits are the limits enforced by CreateJob.
+var concurrencyLimits ConcurrencyLimits
+
+// SetConcurrencyLimits configures the limits enforced when starting new jobs.
+// It must be called at controller boot time, before the controller is started.
+func SetConcurrencyLimits(limits ConcurrencyLimits) {
+	concurrencyLimits = limits
+}
+
+// jobRunning returns true if the job hasn't started yet, or is still running.
+func jobRunning(job *batchv1.Job) bool {
+	return job.Status.Active != 0 || job.Status.StartTime.IsZero()
+}
+
+// runningJobIndex is the name of the cache index of the Jobs by whether
+// they're running, i.e. "true" or "false".
+const runningJobIndex = "status.running"
+
+// stateIndex is the name of the cache index of the GitOpsConfigs by their
+// Status.State.
+const stateIndex = "status.state"
+
+// runningJobIndexValues returns the runningJobIndex value of a Job.
+func runningJobIndexValues(obj runtime.Object) []string {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return nil
+	}
+	return []string{strconv.FormatBool(jobRunning(job))}
+}
+
+// stateIndexValues returns the stateIndex value of a GitOpsConfig.
+func stateIndexValues(obj runtime.Object) []string {
+	instance, ok := obj.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return nil
+	}
+	return []string{instance.Status.State}
+}
+
+// concurrencyMessage checks if starting a new job for instance would exceed
+// the concurrency limits. If so, it returns a message explaining why the run
+// has to be queued; otherwise it returns an empty string. Queued instances
+// ahead of instance, i.e. with a higher priority, or with the same priority
+// and queued earlier, are counted as if their jobs were already running, so
+// that they get the next free slots.
+func (r *Reconciler) concurrencyMessage(ctx context.Context, instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	limits := concurrencyLimits
+	if limits.MaxJobs <= 0 && limits.MaxJobsPerNamespace <= 0 {
+		return "", nil
+	}
+
+	jobs := &batchv1.JobList{}
+	err := r.client.List(ctx, jobs, client.HasLabels{tagJobOwner}, client.MatchingFields{runningJobIndex: "true"})
+	if err != nil {
+		return "", fmt.Errorf("failed to list running jobs with label %q: %w", tagJobOwner, err)
+	}
+	running, runningInNamespace := 0, 0
+	for i := range jobs.Items {
+		// The index may lag behind the Job's status
+		if !jobRunning(&jobs.Items[i]) {
+			continue
+		}
+		running++
+		if jobs.Items[i].Namespace == instance.Namespace {
+			runningInNamespace++
+		}
+	}
+
+	configs := &gitopsv1alpha1.GitOpsConfigList{}
+	err = r.client.List(ctx, configs, client.MatchingFields{stateIndex: stateQueued})
+	if err != nil {
+		return "", fmt.Errorf("failed to list queued GitOpsConfigs: %w", err)
+	}
+	ahead, aheadInNamespace := 0, 0
+	for i := range configs.Items {
+		c := &configs.Items[i]
+		if c.Status.State != stateQueued || !queuedAhead(c, instance) {
+			continue
+		}
+		ahead++
+		if c.Namespace == instance.Namespace {
+			aheadInNamespace++
+		}
+	}
+
+	if limits.MaxJobs > 0 && running+ahead >= limits.MaxJobs {
+		return fmt.Sprintf("Queued: %d jobs running in the cluster (limit %d), %d queued ahead", running, limits.MaxJobs, ahead), nil
+	}
+	if limits.MaxJobsPerNamespace > 0 && runningInNamespace+aheadInNamespace >= limits.MaxJobsPerNamespace {
+		return fmt.Sprintf("Queued: %d jobs running in namespace %s (limit %d), %d queued ahead", runningInNamespace, instance.Namespace, limits.MaxJobsPerNamespace, aheadInNamespace), nil
+	}
+	return "", nil
+}
+
+// queuedAhead returns true if the queued GitOpsConfig c gets a free slot
+// before instance: it has a higher priority, or the same priority and it was
+// queued first, so that no run is skipped indefinitely. An instance which
+// isn't queued yet is behind all the queued ones of the same priority. Runs
+// queued in the same second are ordered by namespace and name.
+func queuedAhead(c, instance *gitopsv1alpha1.GitOpsConfig) bool {
+	if c.Namespace == instance.Namespace && c.Name == instance.Name {
+		return false
+	}
+	if c.Spec.Priority != instance.Spec.Priority {
+		return c.Spec.Priority > instance.Spec.Priority
+	}
+	if instance.Status.State != stateQueued || instance.Status.QueuedTime == nil {
+		return true
+	}
+	if c.Status.QueuedTime == nil {
+		return false
+	}
+	if !c.Status.QueuedTime.Equal(instance.Status.QueuedTime) {
+		return c.Status.QueuedTime.Before(instance.Status.QueuedTime)
+	}
+	return c.Namespace+"/"+c.Name < instance.Namespace+"/"+instance.Name
+}
+
+// queueByConcurrencyLimit marks the instance as Queued with the passed
+// message, and returns a result requeueing it to check again later.
+func (r *Reconciler) queueByConcurrencyLimit(instance *gitopsv1alpha1.GitOpsConfig, message string) (reconcile.Result, error) {
+	log.Info("Concurrency limit reached, deferring job creation", "instance", instance.Name, "message", message)
+	if instance.Status.State != stateQueued || instance.Status.Message != message || !revisionsDeferred(instance) {
+		err := r.updateStatus(instance, func(status *gitopsv1alpha1.GitOpsConfigStatus) {
+			if status.State != stateQueued || status.QueuedTime == nil {
+				now := metav1.Now()
+				status.QueuedTime = &now
+			}
+			status.State = stateQueued
+			status.Message = message
+			deferRevisions(instance)(status)
+		})
+		if err != nil {
+			log.Error(err, "unable to update status of queued instance", "instance", instance.Name)
+			return reconcile.Result{}, fmt.Errorf("unable to update status of GitOpsConfig %q queued by concurrency limit: %w", instance.Name, err)
+		}
+	}
+	return reconcile.Result{RequeueAfter: queuedRequeueDelay}, nil
+}
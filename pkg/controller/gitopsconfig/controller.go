@@ -20,9 +20,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/cron"
+	"github.com/KohlsTechnology/eunomia/pkg/gitremote"
+	"github.com/KohlsTechnology/eunomia/pkg/imagepolicy"
+	"github.com/KohlsTechnology/eunomia/pkg/syncwindow"
 	"github.com/KohlsTechnology/eunomia/pkg/util"
 	batchv1 "k8s.io/api/batch/v1"
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
@@ -31,6 +36,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -50,6 +56,27 @@ const (
 	tagFinalizer   string = "gitopsconfig.eunomia.kohls.io/finalizer"
 	tagJobOwner    string = "gitopsconfig.eunomia.kohls.io/jobOwner"
 	controllerName string = "gitopsconfig-controller"
+
+	// JobOwnerLabel is the label holding the name of the GitOpsConfig owning
+	// a Job or CronJob.
+	JobOwnerLabel string = tagJobOwner
+
+	// stateBlocked is set in Status.State when a run was deferred until the
+	// next open sync window, or until the GitOpsConfig is resumed.
+	stateBlocked string = "Blocked"
+	// messageSuspended is set in Status.Message when a run was deferred
+	// because the GitOpsConfig is suspended.
+	messageSuspended string = "Suspended"
+	// stateQueued is set in Status.State when a run was deferred because too
+	// many jobs are already running.
+	stateQueued string = "Queued"
+	// stateRejected is set in Status.State when a run was rejected because
+	// its job doesn't comply with the operator's image policy.
+	stateRejected string = "Rejected"
+
+	// triggerTokenKey is the key of the token in the Secret referenced by
+	// the tokenSecretRef of a Webhook trigger.
+	triggerTokenKey string = "token"
 )
 
 // Add creates a new GitOpsConfig Controller and adds it to the Manager. The Manager will set fields on the Controller
@@ -60,17 +87,22 @@ func Add(mgr manager.Manager) error {
 
 // NewReconciler creates a new git ops reconciler
 func NewReconciler(mgr manager.Manager) Reconciler {
-	return Reconciler{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return Reconciler{client: mgr.GetClient(), apiReader: mgr.GetAPIReader(), scheme: mgr.GetScheme(), eventRecorder: mgr.GetEventRecorderFor(controllerName), polls: newPollTimes()}
 }
 
-// newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &Reconciler{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+// newReconciler returns a new Reconciler
+func newReconciler(mgr manager.Manager) *Reconciler {
+	return &Reconciler{client: mgr.GetClient(), apiReader: mgr.GetAPIReader(), scheme: mgr.GetScheme(), eventRecorder: mgr.GetEventRecorderFor(controllerName), polls: newPollTimes()}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
-func add(mgr manager.Manager, r reconcile.Reconciler) error {
+func add(mgr manager.Manager, r *Reconciler) error {
 	log.Info("Initializing Controller")
+	err := addIndexes(mgr.GetFieldIndexer())
+	if err != nil {
+		return err
+	}
+
 	// Create a new controller
 	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
 	if err != nil {
@@ -93,8 +125,13 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 					log.Error(nil, "Update event has no new metadata", "event", e)
 					return false
 				}
-				// If there's a status update, .metadata.Generation field isn't changed - ignore such event
-				return e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration()
+				// If there's a status update, .metadata.Generation field isn't changed - ignore such event,
+				// unless a run was just deferred outside of the reconcile loop (e.g. by the webhook
+				// handler), in which case we must schedule it for later.
+				// Changes of the sync-requested annotation request a run as well.
+				return e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration() ||
+					enteredPendingState(e.ObjectOld, e.ObjectNew) ||
+					syncRequestChanged(e.MetaOld, e.MetaNew)
 			},
 		},
 	)
@@ -102,24 +139,59 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return fmt.Errorf("controller watch for changes to primary resource GitOpsConfig failed: %w", err)
 	}
 
-	// TODO: we should somehow detect when Reconciler is stopped, and run the
-	// stop func returned by addJobWatch, to not leak resources (though if it's
-	// done only once, it's not such a big problem)
-	_, err = addJobWatch(mgr.GetConfig(), &jobCompletionEmitter{
-		client:        mgr.GetClient(),
-		eventRecorder: mgr.GetEventRecorderFor(controllerName),
-	})
+	// Watch for changes to the Jobs owned by GitOpsConfigs, including the ones
+	// spawned by their CronJobs, to keep the owner's status up to date, and to
+	// start runs postponed until the previous Job finished.
+	err = c.Watch(
+		&source.Kind{Type: &batchv1.Job{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: jobOwnerRequests},
+		ownedJobPredicate,
+	)
 	if err != nil {
-		return fmt.Errorf("cannot create watch job for jobCompletionEmitter handler: %w", err)
+		return fmt.Errorf("controller watch for changes to owned Jobs failed: %w", err)
 	}
 
-	// TODO: detect when Reconciler stops and run stop func returned by addJobWatch
-	// TODO: make this and above addJobWatch share a single cache.SharedInformer
-	_, err = addJobWatch(mgr.GetConfig(), &statusUpdater{
-		client: mgr.GetClient(),
-	})
+	err = c.Watch(
+		&source.Kind{Type: &batchv1.Job{}},
+		&jobCompletionEmitter{
+			client:        mgr.GetClient(),
+			eventRecorder: mgr.GetEventRecorderFor(controllerName),
+		},
+		ownedJobPredicate,
+	)
+	if err != nil {
+		return fmt.Errorf("controller watch for owned Job completion events failed: %w", err)
+	}
+
+	// Watch for changes to the Secrets, ServiceAccounts, ConfigMaps and
+	// TemplateProcessors referenced by GitOpsConfigs, to start the
+	// ReferenceChange triggers. Only the metadata of the Secrets,
+	// ServiceAccounts and ConfigMaps is watched, see NewCache.
+	for _, kind := range []string{"Secret", "ServiceAccount", "ConfigMap"} {
+		err = c.Watch(
+			&source.Kind{Type: metadataOf(kind)},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: referencingRequests(mgr.GetClient(), kind)},
+		)
+		if err != nil {
+			return fmt.Errorf("controller watch for changes to referenced %ss failed: %w", kind, err)
+		}
+	}
+	err = c.Watch(
+		&source.Kind{Type: &gitopsv1alpha1.TemplateProcessor{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: referencingRequests(mgr.GetClient(), "TemplateProcessor")},
+	)
+	if err != nil {
+		return fmt.Errorf("controller watch for changes to referenced TemplateProcessors failed: %w", err)
+	}
+
+	// Reconcile the GitOpsConfigs whose refs were resolved in the background
+	// by their Poll trigger
+	err = c.Watch(
+		&source.Channel{Source: r.polls.events},
+		&handler.EnqueueRequestForObject{},
+	)
 	if err != nil {
-		return fmt.Errorf("cannot create watch job for statusUpdater handler: %w", err)
+		return fmt.Errorf("controller watch for polled GitOpsConfigs failed: %w", err)
 	}
 
 	log.Info("Controller initialization complete")
@@ -133,7 +205,15 @@ type Reconciler struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
 	client client.Client
-	scheme *runtime.Scheme
+	// apiReader reads directly from the apiserver, bypassing the cache, e.g.
+	// for the trigger tokens
+	apiReader client.Reader
+	scheme    *runtime.Scheme
+	// eventRecorder emits events on the GitOpsConfigs, nil in tests
+	eventRecorder record.EventRecorder
+	// polls resolves the refs of the Poll triggers in the background and
+	// records when they were last resolved, nil in tests
+	polls *pollTimes
 }
 
 // Reconcile reads that state of the cluster for a GitOpsConfig object and makes changes based on the state read
@@ -158,12 +238,15 @@ func (r *Reconciler) Reconcile(request reconcile.Request) (reconcile.Result, err
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
+			forgetMetrics(request.Namespace, request.Name)
+			r.polls.forget(request.NamespacedName)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, fmt.Errorf("reconciler failed to read GitOpsConfig from kubernetes: %w", err)
 	}
 	reqLogger.Info("found instance", "instance", instance.GetName())
+	recordState(instance)
 
 	//object is being deleted
 	if !instance.ObjectMeta.DeletionTimestamp.IsZero() {
@@ -186,12 +269,43 @@ func (r *Reconciler) Reconcile(request reconcile.Request) (reconcile.Result, err
 
 	reqLogger.Info("Instance is initialized", "instance", instance.GetName())
 
+	windows, err := syncwindow.ForConfig(instance)
+	if err != nil {
+		reqLogger.Error(err, "invalid sync windows", "instance", instance.GetName())
+		return reconcile.Result{}, fmt.Errorf("invalid sync windows for GitOpsConfig instance %q: %w", instance.GetName(), err)
+	}
+	// Bring the status up to date with the owned jobs, in case any Job events were missed
+	err = syncStatus(context.TODO(), r.client, instance)
+	if err != nil {
+		reqLogger.Error(err, "unable to update status from jobs", "instance", instance.GetName())
+		return reconcile.Result{}, fmt.Errorf("unable to update status of GitOpsConfig instance %q from its jobs: %w", instance.GetName(), err)
+	}
+
+	now := time.Now()
+	// Recompute the status periodically, even if no events are received
+	result := reconcile.Result{RequeueAfter: statusResyncPeriod}
+
 	if ContainsTrigger(instance, "Periodic") {
 		reqLogger.Info("Instance has a periodic trigger, creating/updating cronjob", "instance", instance.GetName())
-		err = r.createCronJob(instance)
+		suspend := instance.Spec.Suspend || !windows.Open(now)
+		err = r.createCronJob(instance, suspend)
 		if err != nil {
 			reqLogger.Error(err, "error creating the cronjob, continuing...")
 		}
+		if !windows.Empty() {
+			// Come back when the sync windows open or close, to resume or suspend the cronjob.
+			if next := windows.NextChange(now); !next.IsZero() {
+				result = earliestResult(result, reconcile.Result{RequeueAfter: next.Sub(now)})
+			}
+		}
+		if suspend && !instance.Spec.Suspend && instance.Status.State != stateBlocked && periodicRunMissed(instance, windows, now) {
+			// A cron tick is going to be skipped while the cronjob is suspended;
+			// defer it until the sync windows open.
+			blockResult, err := r.blockBySyncWindow(instance, windows, now)
+			if err != nil {
+				return blockResult, err
+			}
+		}
 	} else {
 		// if there are some leftover cronjobs after removing the Periodic trigger, delete them
 		cronJobs, err := ownedCronJobs(context.TODO(), r.client, instance)
@@ -209,17 +323,117 @@ func (r *Reconciler) Reconcile(request reconcile.Request) (reconcile.Result, err
 		}
 	}
 
-	if ContainsTrigger(instance, "Change") || ContainsTrigger(instance, "Webhook") {
-		reqLogger.Info("Instance has a change or Webhook trigger, creating job", "instance", instance.GetName())
-		reconcileResult, err := r.CreateJob("create", instance)
+	if ContainsTrigger(instance, "Poll") {
+		pollResult, requested, err := r.poll(instance, now)
+		result = earliestResult(result, pollResult)
+		if err != nil {
+			// Don't block the other triggers when a repository can't be reached
+			reqLogger.Error(err, "unable to poll the sources, retrying at the next interval", "instance", instance.GetName())
+		}
+		if requested {
+			return result, err
+		}
+	}
+
+	if ContainsTrigger(instance, "ReferenceChange") {
+		hash, changed, err := r.referencesChanged(instance)
+		switch {
+		case err != nil:
+			// Don't block the other triggers when a referenced object can't be read
+			reqLogger.Error(err, "unable to hash the referenced objects, retrying later", "instance", instance.GetName())
+		case changed:
+			reqLogger.Info("Instance has a change of the referenced objects, creating job", "instance", instance.GetName())
+			reconcileResult, err := r.CreateJob("create", instance)
+			if err != nil {
+				reqLogger.Error(err, "reconciler failed to create a job, continuing...", "instance", instance.GetName())
+				return reconcileResult, fmt.Errorf("reconciler failed to create a job for GitOpsConfig instance %q: %w", instance.GetName(), err)
+			}
+			return earliestResult(result, reconcileResult), nil
+		case hash != instance.Status.ReferencesHash && !needsRun(instance):
+			// Only track the change; runs record the hash they were started with
+			err = r.updateStatus(instance, func(status *gitopsv1alpha1.GitOpsConfigStatus) {
+				status.ReferencesHash = hash
+			})
+			if err != nil {
+				reqLogger.Error(err, "unable to update the hash of the referenced objects", "instance", instance.GetName())
+				return reconcile.Result{}, fmt.Errorf("unable to update the hash of the objects referenced by GitOpsConfig instance %q: %w", instance.GetName(), err)
+			}
+		}
+	}
+
+	if needsRun(instance) {
+		reqLogger.Info("Instance has a spec change, a sync request or a deferred run, creating job", "instance", instance.GetName())
+		// A run deferred by the Poll trigger deploys the commits it resolved
+		reconcileResult, err := r.CreateJob("create", pendingTarget(instance))
 		if err != nil {
 			reqLogger.Error(err, "reconciler failed to create a job, continuing...", "instance", instance.GetName())
 			return reconcileResult, fmt.Errorf("reconciler failed to create a job for GitOpsConfig instance %q: %w", instance.GetName(), err)
 		}
-		return reconcileResult, nil
+		return earliestResult(result, reconcileResult), nil
 	}
 
-	return reconcile.Result{}, err
+	return result, err
+}
+
+// needsRun returns true if a new job should be started for the passed
+// instance: either its spec has changed since the last run and it has a Change
+// or Webhook trigger, or a sync was requested with an annotation, or a
+// previous run was deferred.
+func needsRun(instance *gitopsv1alpha1.GitOpsConfig) bool {
+	if isPending(instance.Status.State) || syncRequested(instance) != "" {
+		return true
+	}
+	return (ContainsTrigger(instance, "Change") || ContainsTrigger(instance, "Webhook")) &&
+		instance.Generation != instance.Status.ObservedGeneration
+}
+
+// periodicRunMissed returns true if the cron schedule of the Periodic trigger
+// of instance fires before the sync windows open again.
+func periodicRunMissed(instance *gitopsv1alpha1.GitOpsConfig, windows *syncwindow.Set, now time.Time) bool {
+	for _, trigger := range instance.Spec.Triggers {
+		if trigger.Type != "Periodic" {
+			continue
+		}
+		schedule, err := cron.Parse(trigger.Cron)
+		if err != nil {
+			log.Error(err, "unable to parse cron expression of Periodic trigger", "instance", instance.Name)
+			return false
+		}
+		open, ok := windows.NextOpen(now)
+		tick := schedule.Next(now)
+		return !tick.IsZero() && (!ok || tick.Before(open))
+	}
+	return false
+}
+
+// earliestResult combines two reconcile results, so that the request is
+// requeued as soon as either of them asks for it.
+func earliestResult(a, b reconcile.Result) reconcile.Result {
+	result := reconcile.Result{Requeue: a.Requeue || b.Requeue, RequeueAfter: a.RequeueAfter}
+	if b.RequeueAfter > 0 && (result.RequeueAfter == 0 || b.RequeueAfter < result.RequeueAfter) {
+		result.RequeueAfter = b.RequeueAfter
+	}
+	return result
+}
+
+// isPending returns true if state means that a run was deferred and still needs
+// to be started.
+func isPending(state string) bool {
+	return state == stateBlocked || state == stateQueued
+}
+
+// enteredPendingState returns true if the GitOpsConfig's Status.State changed
+// to one of the pending states between oldObj and newObj.
+func enteredPendingState(oldObj, newObj runtime.Object) bool {
+	oldConfig, ok := oldObj.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return false
+	}
+	newConfig, ok := newObj.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return false
+	}
+	return oldConfig.Status.State != newConfig.Status.State && isPending(newConfig.Status.State)
 }
 
 // ContainsTrigger returns true if the passed instance contains the given trigger
@@ -232,21 +446,46 @@ func ContainsTrigger(instance *gitopsv1alpha1.GitOpsConfig, triggeType string) b
 	return false
 }
 
-// CreateJob creates a new gitops job for the passed instance
+// CreateJob creates a new gitops job for the passed instance. Jobs creating
+// resources are deferred if the instance is suspended, if its sync windows
+// are closed, or if the concurrency limits are reached.
 func (r *Reconciler) CreateJob(jobtype string, instance *gitopsv1alpha1.GitOpsConfig) (reconcile.Result, error) {
+	if jobtype == "create" && instance.Spec.Suspend {
+		return r.blockBySuspension(instance)
+	}
+	if jobtype == "create" {
+		windows, err := syncwindow.ForConfig(instance)
+		if err != nil {
+			log.Error(err, "invalid sync windows", "instance", instance.Name)
+			return reconcile.Result{}, fmt.Errorf("invalid sync windows for GitOpsConfig %q: %w", instance.Name, err)
+		}
+		if now := time.Now(); !windows.Open(now) {
+			return r.blockBySyncWindow(instance, windows, now)
+		}
+	}
+
 	// looking up for running jobs, to avoid creating duplicate one
 	jobs, err := ownedJobs(context.TODO(), r.client, instance)
 	if err != nil {
 		log.Error(err, "unable to list the jobs", "namespace", instance.Namespace)
 		return reconcile.Result{}, fmt.Errorf("unable to list owned jobs when trying to create new one: %w", err)
 	}
-	for _, j := range jobs {
-		if j.Status.Active != 0 || j.Status.StartTime.IsZero() {
-			log.Info("Job is already running for this instance, postponing new job creation", "instance", instance.Name, "job", j.Name)
-			return reconcile.Result{
-				Requeue:      true,
-				RequeueAfter: time.Second * 5,
-			}, nil
+	for i := range jobs {
+		if jobRunning(&jobs[i]) {
+			// The instance is reconciled again when the Job's status changes
+			log.Info("Job is already running for this instance, postponing new job creation", "instance", instance.Name, "job", jobs[i].Name)
+			return reconcile.Result{}, nil
+		}
+	}
+
+	if jobtype == "create" {
+		message, err := r.concurrencyMessage(context.TODO(), instance)
+		if err != nil {
+			log.Error(err, "unable to check concurrency limits", "instance", instance.Name)
+			return reconcile.Result{}, fmt.Errorf("unable to check concurrency limits for GitOpsConfig %q: %w", instance.Name, err)
+		}
+		if message != "" {
+			return r.queueByConcurrencyLimit(instance, message)
 		}
 	}
 
@@ -254,11 +493,15 @@ func (r *Reconciler) CreateJob(jobtype string, instance *gitopsv1alpha1.GitOpsCo
 		Config: *instance,
 		Action: jobtype,
 	}
-	job, err := util.CreateJob(mergedata)
+	job, err := r.jobManifest(mergedata)
 	if err != nil {
 		log.Error(err, "unable to create job manifest from merge data", "mergedata", mergedata)
 		return reconcile.Result{}, fmt.Errorf("unable to create job manifest from merge data: %w", err)
 	}
+	err = imagepolicy.CheckPod(&job.Spec.Template.Spec)
+	if err != nil {
+		return r.rejectByImagePolicy(instance, jobtype, err)
+	}
 	err = controllerutil.SetControllerReference(instance, &job, r.scheme)
 	if err != nil {
 		log.Error(err, "unable to set GitOpsConfig instance as Controller OwnerReference on owned job", "instanceName", instance.Name, "job", job)
@@ -271,20 +514,129 @@ func (r *Reconciler) CreateJob(jobtype string, instance *gitopsv1alpha1.GitOpsCo
 		log.Error(err, "unable to create the job", "job", job, "namespace", job.Namespace)
 		return reconcile.Result{}, fmt.Errorf("unable to create the job %q in namespace %q: %w", job.Name, job.Namespace, err)
 	}
+
+	if jobtype == "create" {
+		err = r.updateStatus(instance, r.handledRun(instance))
+		if err != nil {
+			log.Error(err, "unable to update observed generation", "instance", instance.Name, "job", job.Name)
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+// handledRun returns a function recording in the status which generation of
+// the spec, which sync request, which commits and which referenced objects a
+// run was started (or rejected) for, so that we don't start more jobs for
+// them.
+func (r *Reconciler) handledRun(instance *gitopsv1alpha1.GitOpsConfig) func(*gitopsv1alpha1.GitOpsConfigStatus) {
+	// The referenced objects are only tracked for the ReferenceChange trigger
+	hash := ""
+	if ContainsTrigger(instance, "ReferenceChange") {
+		var err error
+		hash, err = referencesHash(context.TODO(), r.uncachedReader(), instance)
+		if err != nil {
+			log.Error(err, "unable to hash the referenced objects", "instance", instance.Name)
+			hash = instance.Status.ReferencesHash
+		}
+	}
+	return func(status *gitopsv1alpha1.GitOpsConfigStatus) {
+		status.ReferencesHash = hash
+		status.ObservedGeneration = instance.Generation
+		status.QueuedTime = nil
+		status.PendingTemplateRevision = ""
+		status.PendingParameterRevision = ""
+		status.LastHandledSyncRequest = instance.GetAnnotations()[SyncRequestedAnnotation]
+		if gitremote.IsCommitSHA(instance.Spec.TemplateSource.Ref) {
+			status.TemplateRevision = instance.Spec.TemplateSource.Ref
+		}
+		if gitremote.IsCommitSHA(instance.Spec.ParameterSource.Ref) {
+			status.ParameterRevision = instance.Spec.ParameterSource.Ref
+		}
+	}
+}
+
+// blockBySyncWindow marks the instance as Blocked, and returns a result
+// requeueing it when the sync windows open again.
+func (r *Reconciler) blockBySyncWindow(instance *gitopsv1alpha1.GitOpsConfig, windows *syncwindow.Set, now time.Time) (reconcile.Result, error) {
+	message := "Blocked by sync window"
+	// If the windows never seem to open, check again later, as the windows may be changed in the meantime.
+	requeueAfter := time.Hour
+	if open, ok := windows.NextOpen(now); ok {
+		message = fmt.Sprintf("Blocked by sync window until %s", open.UTC().Format(time.RFC3339))
+		requeueAfter = open.Sub(now)
+	}
+	log.Info("Sync windows are closed, deferring job creation", "instance", instance.Name, "message", message)
+
+	if instance.Status.State != stateBlocked || instance.Status.Message != message || !revisionsDeferred(instance) {
+		err := r.updateStatus(instance, func(status *gitopsv1alpha1.GitOpsConfigStatus) {
+			status.State = stateBlocked
+			status.Message = message
+			deferRevisions(instance)(status)
+		})
+		if err != nil {
+			log.Error(err, "unable to update status of blocked instance", "instance", instance.Name)
+			return reconcile.Result{}, fmt.Errorf("unable to update status of GitOpsConfig %q blocked by sync window: %w", instance.Name, err)
+		}
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// blockBySuspension marks the suspended instance as Blocked. It's reconciled
+// again when it's resumed, as that changes its generation.
+func (r *Reconciler) blockBySuspension(instance *gitopsv1alpha1.GitOpsConfig) (reconcile.Result, error) {
+	log.Info("Instance is suspended, deferring job creation", "instance", instance.Name)
+	if instance.Status.State != stateBlocked || instance.Status.Message != messageSuspended || !revisionsDeferred(instance) {
+		err := r.updateStatus(instance, func(status *gitopsv1alpha1.GitOpsConfigStatus) {
+			status.State = stateBlocked
+			status.Message = messageSuspended
+			deferRevisions(instance)(status)
+		})
+		if err != nil {
+			log.Error(err, "unable to update status of suspended instance", "instance", instance.Name)
+			return reconcile.Result{}, fmt.Errorf("unable to update status of suspended GitOpsConfig %q: %w", instance.Name, err)
+		}
+	}
 	return reconcile.Result{}, nil
 }
 
-func (r *Reconciler) createCronJob(instance *gitopsv1alpha1.GitOpsConfig) error {
+// uncachedReader returns the reader of the objects which aren't cached, like
+// the Secrets, ServiceAccounts and ConfigMaps, as reading them through the
+// client would cache all of them.
+func (r *Reconciler) uncachedReader() client.Reader {
+	if r.apiReader == nil {
+		return r.client
+	}
+	return r.apiReader
+}
+
+// updateStatus applies mutate to the Status of instance in the cluster,
+// retrying in case of conflicts. On success, instance.Status is updated too.
+func (r *Reconciler) updateStatus(instance *gitopsv1alpha1.GitOpsConfig, mutate func(*gitopsv1alpha1.GitOpsConfigStatus)) error {
+	return updateStatus(context.TODO(), r.client, instance, func(status *gitopsv1alpha1.GitOpsConfigStatus) bool {
+		mutate(status)
+		return true
+	})
+}
+
+// createCronJob creates or updates the cronjob running the instance's Periodic
+// trigger. If suspend is true, the cronjob won't start new jobs until it's
+// updated again with suspend set to false.
+func (r *Reconciler) createCronJob(instance *gitopsv1alpha1.GitOpsConfig, suspend bool) error {
 	mergedata := util.JobMergeData{
 		Config: *instance,
 		Action: "create",
 	}
 
-	cronjob, err := util.CreateCronJob(mergedata)
+	cronjob, err := r.cronJobManifest(mergedata)
 	if err != nil {
 		log.Error(err, "unable to create cronjob manifest from merge data", "mergedata", mergedata)
 		return fmt.Errorf("unable to create cronjob manifest from merge data: %w", err)
 	}
+	err = imagepolicy.CheckPod(&cronjob.Spec.JobTemplate.Spec.Template.Spec)
+	if err != nil {
+		return r.rejectCronJobByImagePolicy(instance, &cronjob, err)
+	}
+	cronjob.Spec.Suspend = &suspend
 
 	err = r.client.Get(context.TODO(), util.GetNN(&cronjob), &batchv1beta1.CronJob{})
 	update := true
@@ -336,6 +688,58 @@ func (r *Reconciler) GetAll() (gitopsv1alpha1.GitOpsConfigList, error) {
 	return *instanceList, nil
 }
 
+// HasRunningJob returns true if a job of instance is running, in which case
+// CreateJob wouldn't start a new one.
+func (r *Reconciler) HasRunningJob(instance *gitopsv1alpha1.GitOpsConfig) (bool, error) {
+	jobs, err := ownedJobs(context.TODO(), r.client, instance)
+	if err != nil {
+		return false, fmt.Errorf("unable to list owned jobs of GitOpsConfig %q: %w", instance.Name, err)
+	}
+	for i := range jobs {
+		if jobRunning(&jobs[i]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Get retrieves the gitops config with the passed namespace and name
+func (r *Reconciler) Get(namespace, name string) (gitopsv1alpha1.GitOpsConfig, error) {
+	instance := gitopsv1alpha1.GitOpsConfig{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, &instance)
+	if err != nil {
+		return instance, fmt.Errorf("unable to retrieve GitOpsConfig %q in namespace %q: %w", name, namespace, err)
+	}
+	return instance, nil
+}
+
+// TriggerToken returns the token authenticating calls to the trigger endpoint
+// for instance, read from the Secret referenced by its Webhook trigger. An
+// empty token is returned if the instance doesn't reference such a Secret.
+func (r *Reconciler) TriggerToken(instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	secretName := ""
+	for _, trigger := range instance.Spec.Triggers {
+		if trigger.Type == "Webhook" {
+			secretName = trigger.TokenSecretRef
+		}
+	}
+	if secretName == "" {
+		return "", nil
+	}
+
+	secret := &corev1.Secret{}
+	err := r.uncachedReader().Get(context.TODO(), types.NamespacedName{Namespace: instance.Namespace, Name: secretName}, secret)
+	if err != nil {
+		log.Error(err, "unable to retrieve trigger token secret", "instance", instance.Name, "secret", secretName)
+		return "", fmt.Errorf("unable to retrieve trigger token secret %q of GitOpsConfig %q: %w", secretName, instance.Name, err)
+	}
+	token := strings.TrimSpace(string(secret.Data[triggerTokenKey]))
+	if token == "" {
+		return "", fmt.Errorf("trigger token secret %q of GitOpsConfig %q has no %q key", secretName, instance.Name, triggerTokenKey)
+	}
+	return token, nil
+}
+
 func (r *Reconciler) initialize(instance *gitopsv1alpha1.GitOpsConfig) error {
 	// verify mandatory field exist and set defaults
 	spec := &instance.Spec
@@ -489,9 +893,10 @@ func (r *Reconciler) manageDeletion(instance *gitopsv1alpha1.GitOpsConfig) (reco
 		}
 		done := deleters[0].Status.Succeeded > 0
 		if !done {
-			// if it's not succeeded we wait for 5 seconds
+			// The instance is reconciled again when the delete Job's status
+			// changes; check often too, as the finalizer blocks the deletion
+			// of the GitOpsConfig, and any missed event would delay it.
 			// TODO add logic to stop at a certain point ... or not ...
-			// TODO add exponential backoff, possibly like in CronJob
 			return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
 		}
 		return r.removeFinalizer(context.TODO(), instance)
@@ -503,17 +908,21 @@ func (r *Reconciler) manageDeletion(instance *gitopsv1alpha1.GitOpsConfig) (reco
 		log.Error(err, "unable to create deletion job", "instance", instance.Name)
 		return reconcile.Result{}, err
 	}
-	// we return because we need to wait for the job to stop
-	return reconcile.Result{
-		Requeue:      true,
-		RequeueAfter: time.Second * 5,
-	}, nil
+	// we return because we need to wait for the job to stop, see above
+	return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
 
 }
 
 func (r *Reconciler) removeFinalizer(ctx context.Context, instance *gitopsv1alpha1.GitOpsConfig) (reconcile.Result, error) {
+	// The namespace of a preview is deleted first, so that a failed deletion
+	// is retried instead of leaking the namespace
+	err := r.deletePreviewNamespace(ctx, instance)
+	if err != nil {
+		log.Error(err, "GitOpsConfig finalizer unable to delete namespace of preview", "instance", instance.Name)
+		return reconcile.Result{}, fmt.Errorf("GitOpsConfig finalizer unable to delete namespace of preview %q: %w", instance.Name, err)
+	}
 	instance.Finalizers = removeString(instance.Finalizers, tagFinalizer)
-	err := r.client.Update(ctx, instance)
+	err = r.client.Update(ctx, instance)
 	if err != nil {
 		// if apierrors.IsConflict, then requeue
 		var errAPI apierrors.APIStatus
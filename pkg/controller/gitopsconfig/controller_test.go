@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
 	"github.com/KohlsTechnology/eunomia/pkg/util"
@@ -50,6 +51,8 @@ func defaultGitOpsConfig() *gitopsv1alpha1.GitOpsConfig {
 			Namespace:   namespace,
 			Finalizers:  []string{tagFinalizer},
 			Annotations: map[string]string{tagInitialized: "true"},
+			// The fake client doesn't set generation like the API server does on creation
+			Generation: 1,
 		},
 		Spec: gitopsv1alpha1.GitOpsConfigSpec{
 			TemplateSource: gitopsv1alpha1.GitConfig{
@@ -586,3 +589,503 @@ func findRunningJob(cl client.Client) (batchv1.Job, error) {
 	}
 	return batchv1.Job{}, nil
 }
+
+// alwaysDenied is a sync window that never lets a run start
+var alwaysDenied = gitopsv1alpha1.SyncWindow{Kind: "Deny", Schedule: "* * * * *", Duration: "1h"}
+
+func TestSyncWindowBlocksJob(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{
+		{Type: "Change"},
+	}
+	gitops.Spec.SyncWindows = []gitopsv1alpha1.SyncWindow{alwaysDenied}
+
+	cl := fake.NewFakeClient(gitops)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	result, err := r.Reconcile(reconcile.Request{
+		NamespacedName: util.GetNN(gitops),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Errorf("expected blocked run to be requeued, got: %+v", result)
+	}
+
+	jobs, err := findJobList(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("expected no jobs while sync window is closed, got %d", len(jobs))
+	}
+
+	crd := &gitopsv1alpha1.GitOpsConfig{}
+	err = cl.Get(context.Background(), util.GetNN(gitops), crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crd.Status.State != "Blocked" {
+		t.Errorf("expected State %q, got %q", "Blocked", crd.Status.State)
+	}
+
+	// Once the sync window is removed, the deferred run should be started
+	crd.Spec.SyncWindows = nil
+	err = cl.Update(context.Background(), crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Reconcile(reconcile.Request{
+		NamespacedName: util.GetNN(gitops),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := findRunningJob(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Name == "" {
+		t.Error("expected deferred job to be created")
+	}
+}
+
+func TestSyncWindowSuspendsCronJob(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.SyncWindows = []gitopsv1alpha1.SyncWindow{alwaysDenied}
+
+	cl := fake.NewFakeClient(gitops)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	_, err := r.Reconcile(reconcile.Request{
+		NamespacedName: util.GetNN(gitops),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cron := &batchv1beta1.CronJob{}
+	err = cl.Get(context.Background(), util.NN{Name: "gitopsconfig-gitops-operator", Namespace: namespace}, cron)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cron.Spec.Suspend == nil || !*cron.Spec.Suspend {
+		t.Errorf("expected CronJob to be suspended, got: %v", cron.Spec.Suspend)
+	}
+
+	crd := &gitopsv1alpha1.GitOpsConfig{}
+	err = cl.Get(context.Background(), util.GetNN(gitops), crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crd.Status.State != "Blocked" {
+		t.Errorf("expected State %q, got %q", "Blocked", crd.Status.State)
+	}
+}
+
+func TestNoJobWithoutChange(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{
+		{Type: "Change"},
+	}
+
+	cl := fake.NewFakeClient(gitops)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	r.Reconcile(reconcile.Request{ //nolint:errcheck
+		NamespacedName: util.GetNN(gitops),
+	})
+
+	// Mark the job as finished, so that it doesn't postpone creation of new ones
+	startTime := metav1.Now()
+	job, err := findRunningJob(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.Status.Succeeded = 1
+	job.Status.StartTime = &startTime
+	err = cl.Update(context.Background(), &job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reconciling again without a spec change must not start a new job
+	r.Reconcile(reconcile.Request{ //nolint:errcheck
+		NamespacedName: util.GetNN(gitops),
+	})
+	jobs, err := findJobList(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Errorf("expected 1 job, got %d", len(jobs))
+	}
+}
+
+func TestConcurrencyLimitQueuesJob(t *testing.T) {
+	SetConcurrencyLimits(ConcurrencyLimits{MaxJobs: 1})
+	defer SetConcurrencyLimits(ConcurrencyLimits{})
+
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{
+		{Type: "Change"},
+	}
+	// A job of another GitOpsConfig is still running
+	other := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "other-job",
+			Namespace: "other",
+			Labels:    map[string]string{tagJobOwner: "other"},
+		},
+		Status: batchv1.JobStatus{Active: 1, StartTime: &metav1.Time{Time: time.Now()}},
+	}
+
+	cl := fake.NewFakeClient(gitops, other)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	result, err := r.Reconcile(reconcile.Request{
+		NamespacedName: util.GetNN(gitops),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Errorf("expected queued run to be requeued, got: %+v", result)
+	}
+	jobs, err := findJobList(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("expected no jobs while concurrency limit is reached, got %d", len(jobs))
+	}
+	crd := &gitopsv1alpha1.GitOpsConfig{}
+	err = cl.Get(context.Background(), util.GetNN(gitops), crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crd.Status.State != "Queued" {
+		t.Errorf("expected State %q, got %q", "Queued", crd.Status.State)
+	}
+
+	// Once the other job finishes, the queued run should be started
+	other.Status.Active = 0
+	other.Status.Succeeded = 1
+	err = cl.Update(context.Background(), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Reconcile(reconcile.Request{
+		NamespacedName: util.GetNN(gitops),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := findRunningJob(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Name == "" {
+		t.Error("expected queued job to be created")
+	}
+}
+
+func TestConcurrencyLimitPriority(t *testing.T) {
+	SetConcurrencyLimits(ConcurrencyLimits{MaxJobsPerNamespace: 1})
+	defer SetConcurrencyLimits(ConcurrencyLimits{})
+
+	// The times are stored with a precision of a second
+	later := metav1.NewTime(time.Now().Truncate(time.Second))
+	earlier := metav1.NewTime(later.Add(-time.Minute))
+	tests := []struct {
+		comment         string
+		priority        int32
+		queuedTime      *metav1.Time
+		otherPriority   int32
+		otherQueuedTime *metav1.Time
+		wantState       string
+	}{
+		{"lower priority waits", 0, nil, 10, &later, "Queued"},
+		{"same priority waits for the queued run", 10, nil, 10, &later, "Queued"},
+		{"same priority queued later waits", 10, &later, 10, &earlier, "Queued"},
+		{"same priority queued earlier starts", 10, &earlier, 10, &later, ""},
+		{"higher priority starts", 20, nil, 10, &earlier, ""},
+	}
+	for _, tt := range tests {
+		gitops := defaultGitOpsConfig()
+		gitops.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{
+			{Type: "Change"},
+		}
+		gitops.Spec.Priority = tt.priority
+		if tt.queuedTime != nil {
+			gitops.Status.State = "Queued"
+			gitops.Status.QueuedTime = tt.queuedTime
+		}
+		// Another GitOpsConfig in the same namespace is already waiting for a free slot
+		other := defaultGitOpsConfig()
+		other.Name = "other"
+		other.Spec.Priority = tt.otherPriority
+		other.Status.State = "Queued"
+		other.Status.QueuedTime = tt.otherQueuedTime
+
+		cl := fake.NewFakeClient(gitops, other)
+		r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+		_, err := r.Reconcile(reconcile.Request{
+			NamespacedName: util.GetNN(gitops),
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.comment, err)
+		}
+		crd := &gitopsv1alpha1.GitOpsConfig{}
+		err = cl.Get(context.Background(), util.GetNN(gitops), crd)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.comment, err)
+		}
+		if tt.wantState == "Queued" {
+			if crd.Status.State != "Queued" || crd.Status.QueuedTime == nil {
+				t.Errorf("%s: expected to be queued, got State %q, QueuedTime %v", tt.comment, crd.Status.State, crd.Status.QueuedTime)
+			} else if tt.queuedTime != nil && !crd.Status.QueuedTime.Equal(tt.queuedTime) {
+				t.Errorf("%s: expected QueuedTime %v to be kept, got %v", tt.comment, tt.queuedTime, crd.Status.QueuedTime)
+			}
+		} else if crd.Status.QueuedTime != nil {
+			// The State is only updated once the job starts
+			t.Errorf("%s: expected QueuedTime to be cleared when the run starts, got %v", tt.comment, crd.Status.QueuedTime)
+		}
+		jobs, err := findJobList(cl)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.comment, err)
+		}
+		if wantJobs := map[bool]int{true: 0, false: 1}[tt.wantState == "Queued"]; len(jobs) != wantJobs {
+			t.Errorf("%s: expected %d jobs, got %d", tt.comment, wantJobs, len(jobs))
+		}
+	}
+}
+
+func TestTriggerToken(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "trigger-token", Namespace: namespace},
+		Data:       map[string][]byte{"token": []byte("s3cret\n")},
+	}
+	cl := fake.NewFakeClient(gitops, secret)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	token, err := r.TriggerToken(gitops)
+	if err != nil || token != "" {
+		t.Errorf("expected no token without webhook trigger, got %q, %v", token, err)
+	}
+
+	gitops.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook", TokenSecretRef: "trigger-token"}}
+	token, err = r.TriggerToken(gitops)
+	if err != nil || token != "s3cret" {
+		t.Errorf("expected token %q, got %q, %v", "s3cret", token, err)
+	}
+
+	gitops.Spec.Triggers[0].TokenSecretRef = "missing"
+	if _, err := r.TriggerToken(gitops); err == nil {
+		t.Error("expected error for missing secret")
+	}
+}
+
+func TestSyncRequestedAnnotation(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	gitops.Annotations[SyncRequestedAnnotation] = "1614556800"
+
+	cl := fake.NewFakeClient(gitops)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: util.GetNN(gitops)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := findJobList(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 job for the sync request, got %d", len(jobs))
+	}
+	crd := &gitopsv1alpha1.GitOpsConfig{}
+	err = cl.Get(context.Background(), util.GetNN(gitops), crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crd.Status.LastHandledSyncRequest != "1614556800" {
+		t.Errorf("expected sync request to be acknowledged, got %q", crd.Status.LastHandledSyncRequest)
+	}
+
+	// Mark the job as finished, so that it doesn't postpone creation of new ones
+	startTime := metav1.Now()
+	jobs[0].Status.Succeeded = 1
+	jobs[0].Status.StartTime = &startTime
+	err = cl.Update(context.Background(), &jobs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The handled request doesn't start another job
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: util.GetNN(gitops)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ = findJobList(cl); len(jobs) != 1 {
+		t.Errorf("expected no job for the handled sync request, got %d jobs", len(jobs))
+	}
+
+	// A new request does
+	err = cl.Get(context.Background(), util.GetNN(gitops), crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crd.Annotations[SyncRequestedAnnotation] = "1614560400"
+	err = cl.Update(context.Background(), crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: util.GetNN(gitops)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ = findJobList(cl); len(jobs) != 2 {
+		t.Errorf("expected a job for the new sync request, got %d jobs", len(jobs))
+	}
+}
+
+func TestSyncRequestChanged(t *testing.T) {
+	meta := func(value string) metav1.Object {
+		if value == "" {
+			return &metav1.ObjectMeta{}
+		}
+		return &metav1.ObjectMeta{Annotations: map[string]string{SyncRequestedAnnotation: value}}
+	}
+	tests := []struct {
+		old, new string
+		want     bool
+	}{
+		{"", "1", true},
+		{"1", "2", true},
+		{"1", "1", false},
+		{"1", "", false},
+	}
+	for _, tt := range tests {
+		if got := syncRequestChanged(meta(tt.old), meta(tt.new)); got != tt.want {
+			t.Errorf("syncRequestChanged(%q, %q): expected %v, got %v", tt.old, tt.new, tt.want, got)
+		}
+	}
+}
+
+func TestRequestRunAfterRunningJob(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.ParameterSource.URI = gitops.Spec.TemplateSource.URI
+	running := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: namespace, Labels: map[string]string{tagJobOwner: gitops.Name}},
+		Status:     batchv1.JobStatus{Active: 1, StartTime: &metav1.Time{Time: time.Now()}},
+	}
+	cl := fake.NewFakeClient(gitops, running)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	err := r.RequestRun(gitops, "v1.0.0", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The run is postponed until the running job finishes
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: util.GetNN(gitops)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ := findJobList(cl); len(jobs) != 1 {
+		t.Fatalf("expected the run to be postponed, got %d jobs", len(jobs))
+	}
+	crd := &gitopsv1alpha1.GitOpsConfig{}
+	if err := cl.Get(context.Background(), util.GetNN(gitops), crd); err != nil {
+		t.Fatal(err)
+	}
+	if crd.Status.PendingTemplateRevision != "v1.0.0" || crd.Status.PendingParameterRevision != "v1.0.0" {
+		t.Errorf("expected the requested revision to be pending, got %q and %q", crd.Status.PendingTemplateRevision, crd.Status.PendingParameterRevision)
+	}
+
+	running.Status.Active = 0
+	running.Status.Succeeded = 1
+	if err := cl.Update(context.Background(), running); err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: util.GetNN(gitops)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := findJobList(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected the requested run to start once the job finished, got %d jobs", len(jobs))
+	}
+	for _, job := range jobs {
+		if job.Name == running.Name {
+			continue
+		}
+		for _, v := range job.Spec.Template.Spec.Containers[0].Env {
+			if (v.Name == "TEMPLATE_GIT_REF" || v.Name == "PARAMETER_GIT_REF") && v.Value != "v1.0.0" {
+				t.Errorf("expected the job to check out the requested revision, got %s=%q", v.Name, v.Value)
+			}
+		}
+	}
+	crd = &gitopsv1alpha1.GitOpsConfig{}
+	if err := cl.Get(context.Background(), util.GetNN(gitops), crd); err != nil {
+		t.Fatal(err)
+	}
+	if crd.Status.PendingTemplateRevision != "" || crd.Status.LastHandledSyncRequest == "" {
+		t.Errorf("expected the request to be handled, got pending revision %q and handled request %q", crd.Status.PendingTemplateRevision, crd.Status.LastHandledSyncRequest)
+	}
+}
+
+func TestSuspendDefersRun(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.Triggers = append(gitops.Spec.Triggers, gitopsv1alpha1.GitOpsTrigger{Type: "Change"})
+	gitops.Spec.Suspend = true
+	gitops.Generation = 1
+
+	cl := fake.NewFakeClient(gitops)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: util.GetNN(gitops)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ := findJobList(cl); len(jobs) != 0 {
+		t.Errorf("expected no job while suspended, got %d", len(jobs))
+	}
+	cron := &batchv1beta1.CronJob{}
+	err = cl.Get(context.Background(), util.NN{Name: "gitopsconfig-gitops-operator", Namespace: namespace}, cron)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cron.Spec.Suspend == nil || !*cron.Spec.Suspend {
+		t.Errorf("expected CronJob to be suspended, got: %v", cron.Spec.Suspend)
+	}
+	crd := &gitopsv1alpha1.GitOpsConfig{}
+	err = cl.Get(context.Background(), util.GetNN(gitops), crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crd.Status.State != "Blocked" || crd.Status.Message != "Suspended" {
+		t.Errorf("expected Blocked state with Suspended message, got %q %q", crd.Status.State, crd.Status.Message)
+	}
+
+	// Resuming starts the deferred run
+	crd.Spec.Suspend = false
+	crd.Generation = 2
+	err = cl.Update(context.Background(), crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: util.GetNN(gitops)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ := findJobList(cl); len(jobs) != 1 {
+		t.Errorf("expected a job after resuming, got %d", len(jobs))
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// imagePolicyViolation is the reason of the events emitted when a job or
+// cronjob is rejected by the image policy.
+const imagePolicyViolation = "ImagePolicyViolation"
+
+// rejectedMessage returns the Status.Message of a run rejected by the image
+// policy because of err.
+func rejectedMessage(err error) string {
+	return "Rejected by image policy: " + err.Error()
+}
+
+// rejectByImagePolicy handles a job of the instance not complying with the
+// image policy. A rejected create job marks the run as handled, so it's not
+// retried until something changes; a rejected delete job is retried, as the
+// finalizer can't be removed until the resources are deleted.
+func (r *Reconciler) rejectByImagePolicy(instance *gitopsv1alpha1.GitOpsConfig, jobtype string, policyErr error) (reconcile.Result, error) {
+	log.Info("Job rejected by image policy", "instance", instance.Name, "jobtype", jobtype, "reason", policyErr.Error())
+	r.recordViolation(instance, fmt.Sprintf("%s job rejected: %v", jobtype, policyErr))
+
+	mutate := func(status *gitopsv1alpha1.GitOpsConfigStatus) {
+		now := metav1.Now()
+		status.State = stateRejected
+		status.Message = rejectedMessage(policyErr)
+		status.StartTime = &now
+		status.CompletionTime = nil
+	}
+	if jobtype == "create" {
+		handled := r.handledRun(instance)
+		reject := mutate
+		mutate = func(status *gitopsv1alpha1.GitOpsConfigStatus) {
+			reject(status)
+			handled(status)
+		}
+	}
+	err := r.updateStatus(instance, mutate)
+	if err != nil {
+		log.Error(err, "unable to update status of rejected instance", "instance", instance.Name)
+		return reconcile.Result{}, fmt.Errorf("unable to update status of GitOpsConfig %q rejected by image policy: %w", instance.Name, err)
+	}
+	if jobtype != "create" {
+		return reconcile.Result{}, fmt.Errorf("%s job of GitOpsConfig %q rejected by image policy: %w", jobtype, instance.Name, policyErr)
+	}
+	return reconcile.Result{}, nil
+}
+
+// rejectCronJobByImagePolicy handles a cronjob of the instance not complying
+// with the image policy, deleting the cronjob previously created for the
+// instance, if any, so that it doesn't keep running non-compliant images.
+func (r *Reconciler) rejectCronJobByImagePolicy(instance *gitopsv1alpha1.GitOpsConfig, cronjob *batchv1beta1.CronJob, policyErr error) error {
+	log.Info("CronJob rejected by image policy", "instance", instance.Name, "cronjob", cronjob.Name, "reason", policyErr.Error())
+	r.recordViolation(instance, fmt.Sprintf("cronjob rejected: %v", policyErr))
+
+	message := rejectedMessage(policyErr)
+	if instance.Status.State != stateRejected || instance.Status.Message != message {
+		err := r.updateStatus(instance, func(status *gitopsv1alpha1.GitOpsConfigStatus) {
+			now := metav1.Now()
+			status.State = stateRejected
+			status.Message = message
+			status.StartTime = &now
+			status.CompletionTime = nil
+		})
+		if err != nil {
+			log.Error(err, "unable to update status of rejected instance", "instance", instance.Name)
+			return fmt.Errorf("unable to update status of GitOpsConfig %q rejected by image policy: %w", instance.Name, err)
+		}
+	}
+
+	existing := &batchv1beta1.CronJob{}
+	err := r.client.Get(context.TODO(), util.GetNN(cronjob), existing)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return fmt.Errorf("client failed to retrieve CronJob %q from namespace %q: %w", cronjob.Name, cronjob.Namespace, err)
+	case metav1.IsControlledBy(existing, instance):
+		log.Info("Deleting CronJob rejected by image policy", "cronjob", existing.Name, "namespace", existing.Namespace)
+		err = r.client.Delete(context.TODO(), existing)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete the cronjob %q rejected by image policy: %w", existing.Name, err)
+		}
+	}
+	return fmt.Errorf("cronjob of GitOpsConfig %q rejected by image policy: %w", instance.Name, policyErr)
+}
+
+// recordViolation emits a warning event on the instance about an image policy
+// violation.
+func (r *Reconciler) recordViolation(instance *gitopsv1alpha1.GitOpsConfig, message string) {
+	if r.eventRecorder == nil {
+		return
+	}
+	r.eventRecorder.Event(instance, "Warning", imagePolicyViolation, message)
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/imagepolicy"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// quayOnly allows the images of the quay.io/kohlstechnology repositories.
+var quayOnly = &imagepolicy.Policy{AllowedRepositories: []string{"quay.io/kohlstechnology"}}
+
+func TestImagePolicyRejectsJob(t *testing.T) {
+	imagepolicy.SetGlobalPolicy(quayOnly)
+	defer imagepolicy.SetGlobalPolicy(nil)
+
+	tests := []struct {
+		name       string
+		image      string
+		jobtype    string
+		wantJobs   int
+		wantState  string
+		wantErr    bool
+		wantEvents int
+	}{
+		{"allowed", "quay.io/kohlstechnology/eunomia-helm:v0.2.0", "create", 1, "", false, 0},
+		{"rejected", "myimage", "create", 0, stateRejected, false, 1},
+		{"rejected deletion", "myimage", "delete", 0, stateRejected, true, 1},
+	}
+	for _, tt := range tests {
+		gitops := defaultGitOpsConfig()
+		gitops.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+		gitops.Spec.TemplateProcessorImage = tt.image
+		cl := fake.NewFakeClient(gitops)
+		recorder := record.NewFakeRecorder(10)
+		r := &Reconciler{client: cl, scheme: scheme.Scheme, eventRecorder: recorder}
+
+		_, err := r.CreateJob(tt.jobtype, gitops)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		jobs, err := findJobList(cl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != tt.wantJobs {
+			t.Errorf("%s: expected %d jobs, got %d", tt.name, tt.wantJobs, len(jobs))
+		}
+		if len(recorder.Events) != tt.wantEvents {
+			t.Errorf("%s: expected %d events, got %d", tt.name, tt.wantEvents, len(recorder.Events))
+		}
+
+		crd := &gitopsv1alpha1.GitOpsConfig{}
+		err = cl.Get(context.Background(), util.GetNN(gitops), crd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if crd.Status.State != tt.wantState {
+			t.Errorf("%s: expected state %q, got %q", tt.name, tt.wantState, crd.Status.State)
+		}
+		if tt.wantState == stateRejected && !strings.Contains(crd.Status.Message, "not from an allowed repository") {
+			t.Errorf("%s: unexpected message %q", tt.name, crd.Status.Message)
+		}
+		// A rejected run is handled, it's not retried until the spec changes
+		wantGeneration := int64(0)
+		if tt.jobtype == "create" {
+			wantGeneration = gitops.Generation
+		}
+		if crd.Status.ObservedGeneration != wantGeneration {
+			t.Errorf("%s: expected observed generation %d, got %d", tt.name, wantGeneration, crd.Status.ObservedGeneration)
+		}
+	}
+}
+
+func TestImagePolicyDeletesCronJob(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	cl := fake.NewFakeClient(gitops)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+	nn := util.NN{Name: "gitopsconfig-gitops-operator", Namespace: namespace}
+
+	err := r.createCronJob(gitops, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cl.Get(context.Background(), nn, &batchv1beta1.CronJob{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imagepolicy.SetGlobalPolicy(quayOnly)
+	defer imagepolicy.SetGlobalPolicy(nil)
+	err = r.createCronJob(gitops, false)
+	if err == nil {
+		t.Error("expected the cronjob to be rejected")
+	}
+	err = cl.Get(context.Background(), nn, &batchv1beta1.CronJob{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected the rejected cronjob to be deleted, got %v", err)
+	}
+	if gitops.Status.State != stateRejected {
+		t.Errorf("expected state %q, got %q", stateRejected, gitops.Status.State)
+	}
+}
+
+func TestApplyJobStatusRejected(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	imagepolicy.SetGlobalPolicy(&imagepolicy.Policy{RequireDigest: true})
+	defer imagepolicy.SetGlobalPolicy(nil)
+	r := &Reconciler{client: fake.NewFakeClient(gitops), scheme: scheme.Scheme}
+
+	_, err := r.CreateJob("create", gitops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The status of a job started before the rejection doesn't override it
+	job := finishedJob("previous", gitops.Status.StartTime.Time, gitops.Status.StartTime.Time, true)
+	if applyJobStatus(&gitops.Status, job) {
+		t.Errorf("expected the rejected status to be kept, got %+v", gitops.Status)
+	}
+}
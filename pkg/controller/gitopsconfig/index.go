@@ -0,0 +1,147 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/giturl"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// repoRefIndex is the name of the cache index of the GitOpsConfigs by the
+// normalized repository and Git ref of their templateSource and
+// parameterSource, e.g. "github.com/kohlstechnology/eunomia@master".
+const repoRefIndex = "spec.source.repoRef"
+
+// RefNames returns the names of the pushed Git ref, as they can be set in
+// the ref of a source: the branch name of "refs/heads/" refs, and both the
+// full ref and the tag name of "refs/tags/" refs.
+func RefNames(ref string) []string {
+	switch {
+	case ref == "":
+		return nil
+	case strings.HasPrefix(ref, "refs/heads/"):
+		return []string{strings.TrimPrefix(ref, "refs/heads/")}
+	case strings.HasPrefix(ref, "refs/tags/"):
+		return []string{ref, strings.TrimPrefix(ref, "refs/tags/")}
+	}
+	return []string{ref}
+}
+
+// repoRefKey returns the repoRefIndex value for the repository repo at ref.
+func repoRefKey(repo giturl.Repo, ref string) string {
+	return repo.String() + "@" + ref
+}
+
+// repoRefIndexValues returns the repoRefIndex values of a GitOpsConfig. The
+// sources whose URI can't be normalized aren't indexed.
+func repoRefIndexValues(obj runtime.Object) []string {
+	instance, ok := obj.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return nil
+	}
+	values := []string{}
+	seen := map[string]bool{}
+	for _, source := range []gitopsv1alpha1.GitConfig{instance.Spec.TemplateSource, instance.Spec.ParameterSource} {
+		repo, err := giturl.Parse(source.URI)
+		if err != nil || source.Ref == "" {
+			continue
+		}
+		key := repoRefKey(repo, source.Ref)
+		if !seen[key] {
+			seen[key] = true
+			values = append(values, key)
+		}
+	}
+	return values
+}
+
+// addIndexes registers the cache indexes used to look up GitOpsConfigs and
+// Jobs. It must be called before the cache is started.
+func addIndexes(indexer client.FieldIndexer) error {
+	err := indexer.IndexField(&gitopsv1alpha1.GitOpsConfig{}, repoRefIndex, repoRefIndexValues)
+	if err != nil {
+		return fmt.Errorf("failed to add index %q: %w", repoRefIndex, err)
+	}
+	err = indexer.IndexField(&gitopsv1alpha1.GitOpsConfig{}, referenceIndex, referenceIndexValues)
+	if err != nil {
+		return fmt.Errorf("failed to add index %q: %w", referenceIndex, err)
+	}
+	err = indexer.IndexField(&gitopsv1alpha1.GitOpsConfig{}, stateIndex, stateIndexValues)
+	if err != nil {
+		return fmt.Errorf("failed to add index %q: %w", stateIndex, err)
+	}
+	err = indexer.IndexField(&batchv1.Job{}, runningJobIndex, runningJobIndexValues)
+	if err != nil {
+		return fmt.Errorf("failed to add index %q: %w", runningJobIndex, err)
+	}
+	return nil
+}
+
+// GetByRepoRef retrieves the GitOpsConfigs whose templateSource or
+// parameterSource point to one of the repositories with the passed URLs (see
+// giturl.Parse), at one of the passed Git refs, e.g. "refs/heads/master" or
+// "refs/tags/v1.0.0". It uses the cache index, unless none of the URLs can be
+// normalized or no ref is passed, in which case all the GitOpsConfigs are
+// returned.
+func (r *Reconciler) GetByRepoRef(repoURLs []string, refs []string) (gitopsv1alpha1.GitOpsConfigList, error) {
+	keys := []string{}
+	seenKeys := map[string]bool{}
+	for _, repoURL := range repoURLs {
+		repo, err := giturl.Parse(repoURL)
+		if err != nil {
+			continue
+		}
+		for _, ref := range refs {
+			for _, name := range RefNames(ref) {
+				key := repoRefKey(repo, name)
+				if !seenKeys[key] {
+					seenKeys[key] = true
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	if len(seenKeys) == 0 {
+		return r.GetAll()
+	}
+
+	result := gitopsv1alpha1.GitOpsConfigList{}
+	seen := map[types.NamespacedName]bool{}
+	for _, key := range keys {
+		list := &gitopsv1alpha1.GitOpsConfigList{}
+		err := r.client.List(context.TODO(), list, client.MatchingFields{repoRefIndex: key})
+		if err != nil {
+			return result, fmt.Errorf("unable to retrieve list of GitOpsConfig for %q: %w", key, err)
+		}
+		for _, instance := range list.Items {
+			name := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}
+			if !seen[name] {
+				seen[name] = true
+				result.Items = append(result.Items, instance)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	//nolint:staticcheck
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// indexedClient filters the GitOpsConfigs listed with the repoRefIndex or
+// referenceIndex field selectors, like the cache does; the fake client ignores
+// field selectors.
+type indexedClient struct {
+	client.Client
+	lists int
+}
+
+func (c *indexedClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	c.lists++
+	err := c.Client.List(ctx, list, opts...)
+	if err != nil {
+		return err
+	}
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	configs, ok := list.(*gitopsv1alpha1.GitOpsConfigList)
+	if !ok || listOpts.FieldSelector == nil {
+		return nil
+	}
+	indexValues := repoRefIndexValues
+	key, found := listOpts.FieldSelector.RequiresExactMatch(repoRefIndex)
+	if !found {
+		indexValues = referenceIndexValues
+		key, found = listOpts.FieldSelector.RequiresExactMatch(referenceIndex)
+	}
+	if !found {
+		return nil
+	}
+	items := []gitopsv1alpha1.GitOpsConfig{}
+	for _, instance := range configs.Items {
+		for _, value := range indexValues(&instance) {
+			if value == key {
+				items = append(items, instance)
+				break
+			}
+		}
+	}
+	configs.Items = items
+	return nil
+}
+
+func indexedConfig(name, templateURI, templateRef, parameterURI, parameterRef string) *gitopsv1alpha1.GitOpsConfig {
+	return &gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: gitopsv1alpha1.GitOpsConfigSpec{
+			TemplateSource:  gitopsv1alpha1.GitConfig{URI: templateURI, Ref: templateRef},
+			ParameterSource: gitopsv1alpha1.GitConfig{URI: parameterURI, Ref: parameterRef},
+		},
+	}
+}
+
+func TestRepoRefIndexValues(t *testing.T) {
+	tests := []struct {
+		comment string
+		config  *gitopsv1alpha1.GitOpsConfig
+		want    []string
+	}{
+		{
+			"same repository",
+			indexedConfig("a", "https://github.com/Org/App.git", "master", "git@github.com:org/app", "master"),
+			[]string{"github.com/org/app@master"},
+		},
+		{
+			"different refs",
+			indexedConfig("b", "https://github.com/org/app", "master", "https://github.com/org/app", "refs/tags/v1.0.0"),
+			[]string{"github.com/org/app@master", "github.com/org/app@refs/tags/v1.0.0"},
+		},
+		{
+			"invalid uri",
+			indexedConfig("c", "/local/path", "master", "https://gitlab.com/org/params", "main"),
+			[]string{"gitlab.com/org/params@main"},
+		},
+	}
+	for _, tt := range tests {
+		if got := repoRefIndexValues(tt.config); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.comment, tt.want, got)
+		}
+	}
+}
+
+func TestRefNames(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want []string
+	}{
+		{"refs/heads/master", []string{"master"}},
+		{"refs/tags/v1.0.0", []string{"refs/tags/v1.0.0", "v1.0.0"}},
+		{"master", []string{"master"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := RefNames(tt.ref); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RefNames(%q): expected %v, got %v", tt.ref, tt.want, got)
+		}
+	}
+}
+
+func TestGetByRepoRef(t *testing.T) {
+	cl := &indexedClient{Client: fake.NewFakeClient(
+		indexedConfig("app", "https://github.com/org/app", "master", "https://github.com/org/params", "master"),
+		indexedConfig("app-params", "https://github.com/org/templates", "master", "https://github.com/org/app.git", "master"),
+		indexedConfig("app-tag", "https://github.com/org/app", "refs/tags/v1.0.0", "https://github.com/org/app", "refs/tags/v1.0.0"),
+		indexedConfig("app-tag-name", "https://github.com/org/app", "v1.0.0", "https://github.com/org/app", "v1.0.0"),
+		indexedConfig("other", "https://github.com/org/other", "master", "https://github.com/org/other", "master"),
+	)}
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+	names := func(list gitopsv1alpha1.GitOpsConfigList) []string {
+		result := []string{}
+		for _, instance := range list.Items {
+			result = append(result, instance.Name)
+		}
+		return result
+	}
+
+	eventURLs := []string{"https://github.com/org/app.git", "git@github.com:org/app.git"}
+	list, err := r.GetByRepoRef(eventURLs, []string{"refs/heads/master"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(list); !reflect.DeepEqual(got, []string{"app", "app-params"}) {
+		t.Errorf("expected app and app-params, got %v", got)
+	}
+	if cl.lists != 1 {
+		t.Errorf("expected equivalent URLs to be looked up once, got %d lists", cl.lists)
+	}
+
+	list, err = r.GetByRepoRef(eventURLs, []string{"refs/tags/v1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(list); !reflect.DeepEqual(got, []string{"app-tag", "app-tag-name"}) {
+		t.Errorf("expected app-tag and app-tag-name, got %v", got)
+	}
+
+	list, err = r.GetByRepoRef(nil, []string{"refs/heads/master"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 5 {
+		t.Errorf("expected all GitOpsConfigs for event without URLs, got %v", names(list))
+	}
+}
@@ -42,5 +42,5 @@ func init() {
 	)
 
 	// Register operator types with the runtime scheme.
-	scheme.Scheme.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, &gitopsv1alpha1.GitOpsConfig{})
+	scheme.Scheme.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, &gitopsv1alpha1.GitOpsConfig{}, &gitopsv1alpha1.GitOpsConfigList{}, &gitopsv1alpha1.TemplateProcessor{}, &gitopsv1alpha1.TemplateProcessorList{})
 }
@@ -0,0 +1,224 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	batchinformers "k8s.io/client-go/informers/batch/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultResync is the resync period of the Job and metadata informers when
+// the manager doesn't set one, the same as the manager's cache.
+const defaultResync = 10 * time.Hour
+
+// allNamespaces is the namespace part of the field index keys used to look up
+// Jobs in all the namespaces.
+const allNamespaces = "__all_namespaces"
+
+// jobKind is the GroupVersionKind of Jobs.
+var jobKind = batchv1.SchemeGroupVersion.WithKind("Job")
+
+// NewCache creates the cache of the manager. It's the default cache, except
+// that only the Jobs having the tagJobOwner label are listed and watched, so
+// that the operator doesn't cache every Job of the cluster, and that only the
+// metadata of the Secrets, ServiceAccounts and ConfigMaps referenced by the
+// GitOpsConfigs is watched, see metadataCache. It's passed as the NewCache
+// option of the manager.
+func NewCache(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+	objects, err := cache.New(config, opts)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the client of the Job cache: %w", err)
+	}
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the client of the metadata cache: %w", err)
+	}
+	resync := defaultResync
+	if opts.Resync != nil {
+		resync = *opts.Resync
+	}
+	jobs := batchinformers.NewFilteredJobInformer(
+		clientset,
+		opts.Namespace,
+		resync,
+		toolscache.Indexers{toolscache.NamespaceIndex: toolscache.MetaNamespaceIndexFunc},
+		func(options *metav1.ListOptions) { options.LabelSelector = tagJobOwner },
+	)
+	objects = &metadataCache{Cache: objects, informers: newMetadataInformers(metadataClient, opts.Namespace, resync)}
+	return &jobCache{Cache: objects, jobs: jobs}, nil
+}
+
+// jobCache serves the Jobs from a label-selected informer, and the other
+// objects from the default cache.
+type jobCache struct {
+	cache.Cache
+	jobs toolscache.SharedIndexInformer
+}
+
+var _ cache.Cache = &jobCache{}
+
+// Get retrieves a Job from the Job informer, or any other object from the
+// default cache.
+func (c *jobCache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return c.Cache.Get(ctx, key, obj)
+	}
+	item, exists, err := c.jobs.GetIndexer().GetByKey(key.String())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return apierrors.NewNotFound(batchv1.Resource("jobs"), key.Name)
+	}
+	item.(*batchv1.Job).DeepCopyInto(job)
+	return nil
+}
+
+// List lists the Jobs of the Job informer, or any other objects from the
+// default cache. Like the default cache, the field selectors must be exact
+// matches of an index added with IndexField.
+func (c *jobCache) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	jobs, ok := list.(*batchv1.JobList)
+	if !ok {
+		return c.Cache.List(ctx, list, opts...)
+	}
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+
+	var items []interface{}
+	var err error
+	indexer := c.jobs.GetIndexer()
+	switch {
+	case listOpts.FieldSelector != nil:
+		field, value, found := exactMatch(listOpts.FieldSelector)
+		if !found {
+			return errors.New("non-exact field matches are not supported by the cache")
+		}
+		namespace := listOpts.Namespace
+		if namespace == "" {
+			namespace = allNamespaces
+		}
+		items, err = indexer.ByIndex(fieldIndexName(field), namespace+"/"+value)
+	case listOpts.Namespace != "":
+		items, err = indexer.ByIndex(toolscache.NamespaceIndex, listOpts.Namespace)
+	default:
+		items = indexer.List()
+	}
+	if err != nil {
+		return err
+	}
+
+	jobs.Items = make([]batchv1.Job, 0, len(items))
+	for _, item := range items {
+		job := item.(*batchv1.Job)
+		if listOpts.LabelSelector != nil && !listOpts.LabelSelector.Matches(labels.Set(job.Labels)) {
+			continue
+		}
+		jobs.Items = append(jobs.Items, *job.DeepCopy())
+	}
+	return nil
+}
+
+// GetInformer returns the Job informer for Jobs, or the informer of the
+// default cache for any other object.
+func (c *jobCache) GetInformer(obj runtime.Object) (cache.Informer, error) {
+	if _, ok := obj.(*batchv1.Job); ok {
+		return c.jobs, nil
+	}
+	return c.Cache.GetInformer(obj)
+}
+
+// GetInformerForKind returns the Job informer for Jobs, or the informer of
+// the default cache for any other kind.
+func (c *jobCache) GetInformerForKind(gvk schema.GroupVersionKind) (cache.Informer, error) {
+	if gvk == jobKind {
+		return c.jobs, nil
+	}
+	return c.Cache.GetInformerForKind(gvk)
+}
+
+// IndexField adds a field index to the Job informer for Jobs, or to the
+// default cache for any other object. The values are indexed per namespace
+// and for all the namespaces, like the default cache does.
+func (c *jobCache) IndexField(obj runtime.Object, field string, extractValue client.IndexerFunc) error {
+	if _, ok := obj.(*batchv1.Job); !ok {
+		return c.Cache.IndexField(obj, field, extractValue)
+	}
+	return c.jobs.AddIndexers(toolscache.Indexers{
+		fieldIndexName(field): func(obj interface{}) ([]string, error) {
+			job, ok := obj.(*batchv1.Job)
+			if !ok {
+				return nil, fmt.Errorf("object %T is not a Job", obj)
+			}
+			keys := []string{}
+			for _, value := range extractValue(job) {
+				keys = append(keys, allNamespaces+"/"+value, job.Namespace+"/"+value)
+			}
+			return keys, nil
+		},
+	})
+}
+
+// Start runs the Job informer and the default cache until stop is closed.
+func (c *jobCache) Start(stop <-chan struct{}) error {
+	go c.jobs.Run(stop)
+	return c.Cache.Start(stop)
+}
+
+// WaitForCacheSync waits for the Job informer and the default cache to sync.
+func (c *jobCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	return toolscache.WaitForCacheSync(stop, c.jobs.HasSynced) && c.Cache.WaitForCacheSync(stop)
+}
+
+// fieldIndexName returns the name of the informer index of field.
+func fieldIndexName(field string) string {
+	return "field:" + field
+}
+
+// exactMatch returns the field and value of selector, if it's a single exact
+// match.
+func exactMatch(selector fields.Selector) (string, string, bool) {
+	requirements := selector.Requirements()
+	if len(requirements) != 1 {
+		return "", "", false
+	}
+	field := requirements[0].Field
+	value, found := selector.RequiresExactMatch(field)
+	return field, value, found
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestJobCache(t *testing.T) {
+	job := func(namespace, name, owner string) batchv1.Job {
+		labels := map[string]string{}
+		if owner != "" {
+			labels[tagJobOwner] = owner
+		}
+		return batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels}}
+	}
+	jobs := []batchv1.Job{
+		job("a", "owned-a", "config-a"),
+		job("b", "owned-b", "config-b"),
+		job("a", "other", ""),
+	}
+	// The list emulates the label selector of the Job informer of NewCache
+	owned, err := labels.Parse(tagJobOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	informer := toolscache.NewSharedIndexInformer(
+		&toolscache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				list := &batchv1.JobList{}
+				for _, j := range jobs {
+					if owned.Matches(labels.Set(j.Labels)) {
+						list.Items = append(list.Items, j)
+					}
+				}
+				return list, nil
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return watch.NewFake(), nil
+			},
+		},
+		&batchv1.Job{},
+		0,
+		toolscache.Indexers{toolscache.NamespaceIndex: toolscache.MetaNamespaceIndexFunc},
+	)
+	c := &jobCache{jobs: informer}
+	err = c.IndexField(&batchv1.Job{}, "owner", func(obj runtime.Object) []string {
+		return []string{obj.(*batchv1.Job).Labels[tagJobOwner]}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go informer.Run(stop)
+	if !toolscache.WaitForCacheSync(stop, informer.HasSynced) {
+		t.Fatal("Job informer didn't sync")
+	}
+
+	tests := []struct {
+		comment string
+		opts    []client.ListOption
+		want    []string
+	}{
+		{"all jobs", nil, []string{"owned-a", "owned-b"}},
+		{"namespace", []client.ListOption{client.InNamespace("a")}, []string{"owned-a"}},
+		{"labels", []client.ListOption{client.MatchingLabels{tagJobOwner: "config-b"}}, []string{"owned-b"}},
+		{"field index", []client.ListOption{client.MatchingFields{"owner": "config-a"}}, []string{"owned-a"}},
+		{"field index in namespace", []client.ListOption{client.InNamespace("b"), client.MatchingFields{"owner": "config-a"}}, []string{}},
+	}
+	for _, tt := range tests {
+		jobs := &batchv1.JobList{}
+		if err := c.List(context.TODO(), jobs, tt.opts...); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.comment, err)
+			continue
+		}
+		names := []string{}
+		for _, j := range jobs.Items {
+			names = append(names, j.Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s: got jobs %v, want %v", tt.comment, names, tt.want)
+		}
+	}
+
+	found := &batchv1.Job{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "a", Name: "owned-a"}, found); err != nil || found.Name != "owned-a" {
+		t.Errorf("expected to get owned-a, got %v, %v", found.Name, err)
+	}
+	err = c.Get(context.TODO(), client.ObjectKey{Namespace: "a", Name: "other"}, &batchv1.Job{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected the Job without owner label not to be cached, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"text/template"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// JobTemplateKey is the key of the job template in the ConfigMaps
+	// referenced by the jobTemplateRef of GitOpsConfigs.
+	JobTemplateKey = "job.yaml"
+	// CronJobTemplateKey is the key of the cronjob template in the ConfigMaps
+	// referenced by the jobTemplateRef of GitOpsConfigs.
+	CronJobTemplateKey = "cronjob.yaml"
+)
+
+// jobTemplateCatalogs are the namespaces, besides their own, in which the
+// GitOpsConfigs can reference job template ConfigMaps.
+var jobTemplateCatalogs = map[string]bool{}
+
+// SetJobTemplateCatalogs configures the namespaces in which any GitOpsConfig
+// can reference job template ConfigMaps, e.g. a catalog of templates
+// maintained by the platform team. It must be called at controller boot time,
+// before the controller is started.
+func SetJobTemplateCatalogs(namespaces []string) {
+	jobTemplateCatalogs = map[string]bool{}
+	for _, namespace := range namespaces {
+		jobTemplateCatalogs[namespace] = true
+	}
+}
+
+// parsedJobTemplates are the templates parsed from a version of a job
+// template ConfigMap. A nil template means the operator's one is used.
+type parsedJobTemplates struct {
+	resourceVersion string
+	job             *template.Template
+	cronJob         *template.Template
+}
+
+// jobTemplateCache holds the templates parsed from the job template
+// ConfigMaps, by ConfigMap, so that they're only parsed again when the
+// ConfigMap is modified.
+var jobTemplateCache = struct {
+	sync.Mutex
+	templates map[types.NamespacedName]*parsedJobTemplates
+}{templates: map[types.NamespacedName]*parsedJobTemplates{}}
+
+// jobTemplateName returns the name of the job template ConfigMap referenced
+// by instance, or an error if it's in a namespace which isn't allowed.
+func jobTemplateName(instance *gitopsv1alpha1.GitOpsConfig) (types.NamespacedName, error) {
+	ref := instance.Spec.JobTemplateRef
+	name := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+	if name.Namespace == "" {
+		name.Namespace = instance.Namespace
+	}
+	if name.Namespace != instance.Namespace && !jobTemplateCatalogs[name.Namespace] {
+		return name, fmt.Errorf("job template ConfigMap %q of GitOpsConfig %q is neither in its namespace nor in a job template catalog namespace", name, instance.Name)
+	}
+	return name, nil
+}
+
+// jobTemplates returns the templates of the ConfigMap referenced by the
+// jobTemplateRef of instance, or nil if it has none.
+func (r *Reconciler) jobTemplates(instance *gitopsv1alpha1.GitOpsConfig) (*parsedJobTemplates, error) {
+	if instance.Spec.JobTemplateRef == nil {
+		return nil, nil
+	}
+	name, err := jobTemplateName(instance)
+	if err != nil {
+		log.Error(err, "invalid job template reference", "instance", instance.Name)
+		return nil, err
+	}
+	configMap := &corev1.ConfigMap{}
+	err = r.uncachedReader().Get(context.TODO(), name, configMap)
+	if err != nil {
+		log.Error(err, "unable to get the job template ConfigMap", "instance", instance.Name, "configmap", name)
+		return nil, fmt.Errorf("unable to get job template ConfigMap %q of GitOpsConfig %q: %w", name, instance.Name, err)
+	}
+
+	jobTemplateCache.Lock()
+	defer jobTemplateCache.Unlock()
+	cached := jobTemplateCache.templates[name]
+	if cached != nil && cached.resourceVersion == configMap.ResourceVersion {
+		return cached, nil
+	}
+	parsed := &parsedJobTemplates{resourceVersion: configMap.ResourceVersion}
+	if text, ok := configMap.Data[JobTemplateKey]; ok {
+		parsed.job, err = util.ParseJobTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q in job template ConfigMap %q: %w", JobTemplateKey, name, err)
+		}
+	}
+	if text, ok := configMap.Data[CronJobTemplateKey]; ok {
+		parsed.cronJob, err = util.ParseCronJobTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q in job template ConfigMap %q: %w", CronJobTemplateKey, name, err)
+		}
+	}
+	jobTemplateCache.templates[name] = parsed
+	return parsed, nil
+}
+
+// jobManifest returns the job for mergedata, created from the job template
+// of its GitOpsConfig, with its TemplateProcessor. The deletion jobs fall back
+// to the operator's template and to the templateProcessorImage when the
+// custom template or the TemplateProcessor can't be used, so that a missing
+// object doesn't block the deletion of the GitOpsConfig.
+func (r *Reconciler) jobManifest(mergedata util.JobMergeData) (batchv1.Job, error) {
+	deletion := mergedata.Action == "delete"
+	env, err := r.applyTemplateProcessor(&mergedata.Config)
+	if err != nil && deletion {
+		log.Info("unable to use the template processor, using the templateProcessorImage for deletion", "instance", mergedata.Config.Name, "error", err.Error())
+	} else if err != nil {
+		return batchv1.Job{}, err
+	}
+	job, err := r.executeJobTemplate(mergedata)
+	if err != nil {
+		return job, err
+	}
+	addProcessorEnv(&job.Spec.Template.Spec, env)
+	return job, nil
+}
+
+// executeJobTemplate executes the job template of the GitOpsConfig of
+// mergedata.
+func (r *Reconciler) executeJobTemplate(mergedata util.JobMergeData) (batchv1.Job, error) {
+	templates, err := r.jobTemplates(&mergedata.Config)
+	if err != nil && mergedata.Action == "delete" {
+		log.Info("unable to use the custom job template, using the default one for deletion", "instance", mergedata.Config.Name, "error", err.Error())
+		return util.CreateJob(mergedata)
+	}
+	if err != nil {
+		return batchv1.Job{}, err
+	}
+	if templates == nil || templates.job == nil {
+		return util.CreateJob(mergedata)
+	}
+	return util.ExecuteJobTemplate(templates.job, mergedata)
+}
+
+// cronJobManifest returns the cronjob for mergedata, created from the cronjob
+// template of its GitOpsConfig, with its TemplateProcessor.
+func (r *Reconciler) cronJobManifest(mergedata util.JobMergeData) (batchv1beta1.CronJob, error) {
+	env, err := r.applyTemplateProcessor(&mergedata.Config)
+	if err != nil {
+		return batchv1beta1.CronJob{}, err
+	}
+	templates, err := r.jobTemplates(&mergedata.Config)
+	if err != nil {
+		return batchv1beta1.CronJob{}, err
+	}
+	var cronJob batchv1beta1.CronJob
+	if templates == nil || templates.cronJob == nil {
+		cronJob, err = util.CreateCronJob(mergedata)
+	} else {
+		cronJob, err = util.ExecuteCronJobTemplate(templates.cronJob, mergedata)
+	}
+	if err != nil {
+		return cronJob, err
+	}
+	addProcessorEnv(&cronJob.Spec.JobTemplate.Spec.Template.Spec, env)
+	return cronJob, nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// customJobTemplate returns the default job template, with an additional
+// label on the jobs.
+func customJobTemplate(t *testing.T, label string) string {
+	t.Helper()
+	text, err := ioutil.ReadFile("../../../build/job-templates/job.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Replace(string(text), "  labels:\n", "  labels:\n    custom: "+label+"\n", 1)
+}
+
+func TestJobTemplateRef(t *testing.T) {
+	defer SetJobTemplateCatalogs(nil)
+	configMap := func(namespace, job string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "templates", Namespace: namespace},
+			Data:       map[string]string{JobTemplateKey: job},
+		}
+	}
+	tests := []struct {
+		name      string
+		ref       *gitopsv1alpha1.JobTemplateReference
+		catalogs  []string
+		configMap *corev1.ConfigMap
+		action    string
+		wantLabel string
+		wantErr   bool
+	}{
+		{"default template", nil, nil, nil, "create", "", false},
+		{"same namespace", &gitopsv1alpha1.JobTemplateReference{Name: "templates"}, nil, configMap(namespace, customJobTemplate(t, "local")), "create", "local", false},
+		{"catalog", &gitopsv1alpha1.JobTemplateReference{Name: "templates", Namespace: "catalog"}, []string{"catalog"}, configMap("catalog", customJobTemplate(t, "catalog")), "create", "catalog", false},
+		{"not a catalog", &gitopsv1alpha1.JobTemplateReference{Name: "templates", Namespace: "other"}, []string{"catalog"}, configMap("other", customJobTemplate(t, "other")), "create", "", true},
+		{"missing configmap", &gitopsv1alpha1.JobTemplateReference{Name: "templates"}, nil, nil, "create", "", true},
+		{"missing configmap on deletion", &gitopsv1alpha1.JobTemplateReference{Name: "templates"}, nil, nil, "delete", "", false},
+		{"invalid template", &gitopsv1alpha1.JobTemplateReference{Name: "templates"}, nil, configMap(namespace, "{{ .Missing"), "create", "", true},
+		{"no job key", &gitopsv1alpha1.JobTemplateReference{Name: "templates"}, nil, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "templates", Namespace: namespace}}, "create", "", false},
+	}
+	for _, tt := range tests {
+		// The fake clients all start counting resource versions from scratch
+		jobTemplateCache.templates = map[types.NamespacedName]*parsedJobTemplates{}
+		SetJobTemplateCatalogs(tt.catalogs)
+		gitops := defaultGitOpsConfig()
+		gitops.Spec.JobTemplateRef = tt.ref
+		cl := fake.NewFakeClient(gitops)
+		if tt.configMap != nil {
+			if err := cl.Create(context.Background(), tt.configMap); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := &Reconciler{client: cl, scheme: scheme.Scheme}
+		job, err := r.jobManifest(util.JobMergeData{Config: *gitops, Action: tt.action})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+			continue
+		}
+		if got := job.Labels["custom"]; got != tt.wantLabel {
+			t.Errorf("%s: expected custom label %q, got %q", tt.name, tt.wantLabel, got)
+		}
+	}
+}
+
+func TestJobTemplateCache(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.JobTemplateRef = &gitopsv1alpha1.JobTemplateReference{Name: "templates"}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "templates", Namespace: namespace},
+		Data:       map[string]string{JobTemplateKey: customJobTemplate(t, "v1")},
+	}
+	cl := fake.NewFakeClient(gitops, configMap)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+	jobTemplateCache.templates = map[types.NamespacedName]*parsedJobTemplates{}
+
+	first, err := r.jobTemplates(gitops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.cronJob != nil {
+		t.Error("expected no cronjob template")
+	}
+	second, err := r.jobTemplates(gitops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("expected the templates to be parsed once per ConfigMap version")
+	}
+
+	if err := cl.Get(context.Background(), util.GetNN(configMap), configMap); err != nil {
+		t.Fatal(err)
+	}
+	configMap.Data[JobTemplateKey] = customJobTemplate(t, "v2")
+	if err := cl.Update(context.Background(), configMap); err != nil {
+		t.Fatal(err)
+	}
+	job, err := r.jobManifest(util.JobMergeData{Config: *gitops, Action: "create"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Labels["custom"] != "v2" {
+		t.Errorf("expected the updated template to be used, got labels %v", job.Labels)
+	}
+}
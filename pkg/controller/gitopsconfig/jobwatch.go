@@ -17,53 +17,77 @@ limitations under the License.
 package gitopsconfig
 
 import (
-	"fmt"
+	"context"
 
 	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
 	batchv1 "k8s.io/api/batch/v1"
-	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-// addJobWatch starts watching Job events in the Kubernetes cluster as
-// specified by kubecfg. The handler will be called for every Job event
-// detected. The returned func should be called to stop the watch and free
-// associated resources.
-func addJobWatch(kubecfg *rest.Config, handler cache.ResourceEventHandler) (func(), error) {
-	// based on: http://web.archive.org/web/20161221032701/https://solinea.com/blog/tapping-kubernetes-events
-	clientset, err := kubernetes.NewForConfig(kubecfg)
-	if err != nil {
-		return nil, fmt.Errorf("cannot create Job watcher from config: %w", err)
+// ownedJobPredicate filters Job events down to the Jobs owned by a
+// GitOpsConfig, i.e. the ones having the tagJobOwner label. The cache created
+// by NewCache only watches such Jobs already; the predicate keeps the events
+// of other Jobs out when another cache is used.
+var ownedJobPredicate = predicate.Funcs{
+	CreateFunc:  func(e event.CreateEvent) bool { return jobOwner(e.Meta) != "" },
+	UpdateFunc:  func(e event.UpdateEvent) bool { return jobOwner(e.MetaNew) != "" },
+	DeleteFunc:  func(e event.DeleteEvent) bool { return jobOwner(e.Meta) != "" },
+	GenericFunc: func(e event.GenericEvent) bool { return jobOwner(e.Meta) != "" },
+}
+
+// jobOwner returns the name of the GitOpsConfig owning the Job with the
+// passed metadata, or an empty string if it's not owned by a GitOpsConfig.
+func jobOwner(meta metav1.Object) string {
+	if meta == nil {
+		return ""
 	}
-	watchlist := cache.NewListWatchFromClient(clientset.BatchV1().RESTClient(), "jobs", corev1.NamespaceAll, fields.Everything())
-	// https://stackoverflow.com/a/49231503/98528
-	// TODO: what is the difference vs. NewSharedInformer? -> https://stackoverflow.com/q/59544139
-	_, controller := cache.NewInformer(watchlist, &batchv1.Job{}, 0, handler)
-
-	stopChan := make(chan struct{})
-	go controller.Run(stopChan)
-	return func() { close(stopChan) }, nil
+	return meta.GetLabels()[tagJobOwner]
 }
 
+// jobOwnerRequests maps a Job to a reconcile request for the GitOpsConfig
+// owning it, so that its Status is updated and any postponed run is started.
+// Note: Assuming the same namespace for GitOpsConfig as for the Job.
+var jobOwnerRequests = handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+	name := jobOwner(o.Meta)
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: o.Meta.GetNamespace()}}}
+})
+
 // jobCompletionEmitter emits Job completion events ("JobSuccessful",
-// "JobFailed") into cluster when it is used as a ResourceEventHandler on
-// batchv1.Job objects. For more details, see OnUpdate method. The OnAdd and
-// OnDelete methods pass their argument to OnUpdate.
+// "JobFailed") into cluster when it is used as a handler.EventHandler on
+// batchv1.Job objects. For more details, see OnUpdate method. It doesn't
+// enqueue any reconcile requests.
 type jobCompletionEmitter struct {
 	client        client.Client
 	eventRecorder record.EventRecorder
 }
 
-var _ cache.ResourceEventHandler = &jobCompletionEmitter{}
+var _ handler.EventHandler = &jobCompletionEmitter{}
+
+func (e *jobCompletionEmitter) Create(evt event.CreateEvent, _ workqueue.RateLimitingInterface) {
+	e.OnUpdate(nil, evt.Object)
+}
+
+func (e *jobCompletionEmitter) Update(evt event.UpdateEvent, _ workqueue.RateLimitingInterface) {
+	e.OnUpdate(evt.ObjectOld, evt.ObjectNew)
+}
+
+func (e *jobCompletionEmitter) Delete(evt event.DeleteEvent, _ workqueue.RateLimitingInterface) {
+	e.OnUpdate(evt.Object, nil)
+}
 
-func (e *jobCompletionEmitter) OnAdd(newObj interface{})    { e.OnUpdate(nil, newObj) }
-func (e *jobCompletionEmitter) OnDelete(oldObj interface{}) { e.OnUpdate(oldObj, nil) }
+func (e *jobCompletionEmitter) Generic(event.GenericEvent, workqueue.RateLimitingInterface) {}
 
 // OnUpdate detects if newObj is a completed Job while oldObj is not, and emits
 // a Job completion event into the cluster in such case. It requires that the
@@ -77,7 +101,7 @@ func (e *jobCompletionEmitter) OnDelete(oldObj interface{}) { e.OnUpdate(oldObj,
 // For JobFailed to be emitted, conditions are similar as for JobSuccessful,
 // except for the last one being:
 //  - have .Status.Succeeded == 0 and .Status.Failed > 0.
-func (e *jobCompletionEmitter) OnUpdate(oldObj, newObj interface{}) {
+func (e *jobCompletionEmitter) OnUpdate(oldObj, newObj runtime.Object) {
 	// Extract Job objects from arguments
 	oldJob, ok := oldObj.(*batchv1.Job)
 	if !ok && oldObj != nil {
@@ -90,6 +114,15 @@ func (e *jobCompletionEmitter) OnUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
+	// Record run metrics once the Job is finished for good, i.e. it won't be
+	// retried anymore. Jobs already finished when first seen (e.g. after
+	// operator restart) are not counted again.
+	if newJob != nil && jobFinishTime(newJob) != nil && (oldJob == nil || jobFinishTime(oldJob) == nil) {
+		if name := newJob.Labels[tagJobOwner]; name != "" {
+			recordJobCompletion(context.TODO(), e.client, name, newJob, oldJob != nil)
+		}
+	}
+
 	// Check some preconditions that can let us quickly ignore the Job change.
 	switch {
 	case newJob == nil:
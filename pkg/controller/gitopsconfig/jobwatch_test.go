@@ -0,0 +1,53 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+func TestJobOwnerRequests(t *testing.T) {
+	owned := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:      "gitopsconfig-gitops-operator-abcde",
+		Namespace: namespace,
+		Labels:    map[string]string{tagJobOwner: "gitops-operator"},
+	}}
+	other := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:      "other",
+		Namespace: namespace,
+	}}
+
+	if !ownedJobPredicate.Create(event.CreateEvent{Meta: owned, Object: owned}) {
+		t.Error("expected event of owned Job to pass the predicate")
+	}
+	if ownedJobPredicate.Update(event.UpdateEvent{MetaOld: other, ObjectOld: other, MetaNew: other, ObjectNew: other}) {
+		t.Error("expected event of other Job to be filtered out")
+	}
+
+	requests := jobOwnerRequests(handler.MapObject{Meta: owned, Object: owned})
+	if len(requests) != 1 || requests[0].Name != "gitops-operator" || requests[0].Namespace != namespace {
+		t.Errorf("expected a request for the owning GitOpsConfig, got %v", requests)
+	}
+	if requests := jobOwnerRequests(handler.MapObject{Meta: other, Object: other}); len(requests) != 0 {
+		t.Errorf("expected no requests for other Job, got %v", requests)
+	}
+}
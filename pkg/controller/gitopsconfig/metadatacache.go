@@ -0,0 +1,138 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/metadata"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// metadataResources are the resources of the kinds of referenced objects
+// whose metadata only is watched.
+var metadataResources = map[string]string{
+	"Secret":         "secrets",
+	"ServiceAccount": "serviceaccounts",
+	"ConfigMap":      "configmaps",
+}
+
+// metadataOf returns the object to watch the metadata of the objects of kind
+// with, see metadataCache.
+func metadataOf(kind string) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: kind}}
+}
+
+// newMetadataInformers returns informers of the metadata of the objects of
+// metadataResources in namespace, or in all the namespaces if it's empty.
+func newMetadataInformers(client metadata.Interface, namespace string, resync time.Duration) map[schema.GroupVersionKind]toolscache.SharedIndexInformer {
+	informers := map[schema.GroupVersionKind]toolscache.SharedIndexInformer{}
+	for kind, resource := range metadataResources {
+		resource := client.Resource(corev1.SchemeGroupVersion.WithResource(resource)).Namespace(namespace)
+		informers[corev1.SchemeGroupVersion.WithKind(kind)] = toolscache.NewSharedIndexInformer(
+			&toolscache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					list, err := resource.List(options)
+					if err != nil {
+						return nil, err
+					}
+					for i := range list.Items {
+						stripMetadata(&list.Items[i])
+					}
+					return list, nil
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					w, err := resource.Watch(options)
+					if err != nil {
+						return nil, err
+					}
+					return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+						if object, ok := event.Object.(*metav1.PartialObjectMetadata); ok {
+							stripMetadata(object)
+						}
+						return event, true
+					}), nil
+				},
+			},
+			&metav1.PartialObjectMetadata{},
+			resync,
+			toolscache.Indexers{toolscache.NamespaceIndex: toolscache.MetaNamespaceIndexFunc},
+		)
+	}
+	return informers
+}
+
+// stripMetadata drops the annotations and managed fields of object, as they
+// may hold its content, e.g. the last-applied-configuration annotation of
+// kubectl.
+func stripMetadata(object *metav1.PartialObjectMetadata) {
+	object.Annotations = nil
+	object.ManagedFields = nil
+}
+
+// metadataCache serves informers of the metadata of the Secrets,
+// ServiceAccounts and ConfigMaps for the PartialObjectMetadata of their kind,
+// see metadataOf, so that changes to the referenced objects are watched
+// without caching their content. The other objects are served from the
+// default cache.
+type metadataCache struct {
+	cache.Cache
+	informers map[schema.GroupVersionKind]toolscache.SharedIndexInformer
+}
+
+var _ cache.Cache = &metadataCache{}
+
+// GetInformer returns the metadata informer of the kind of a
+// PartialObjectMetadata, or the informer of the default cache for any other
+// object.
+func (c *metadataCache) GetInformer(obj runtime.Object) (cache.Informer, error) {
+	if _, ok := obj.(*metav1.PartialObjectMetadata); !ok {
+		return c.Cache.GetInformer(obj)
+	}
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	informer, ok := c.informers[gvk]
+	if !ok {
+		return nil, fmt.Errorf("the metadata of %s is not cached", gvk)
+	}
+	return informer, nil
+}
+
+// Start runs the metadata informers and the default cache until stop is
+// closed.
+func (c *metadataCache) Start(stop <-chan struct{}) error {
+	for _, informer := range c.informers {
+		go informer.Run(stop)
+	}
+	return c.Cache.Start(stop)
+}
+
+// WaitForCacheSync waits for the metadata informers and the default cache to
+// sync.
+func (c *metadataCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	synced := []toolscache.InformerSynced{}
+	for _, informer := range c.informers {
+		synced = append(synced, informer.HasSynced)
+	}
+	return toolscache.WaitForCacheSync(stop, synced...) && c.Cache.WaitForCacheSync(stop)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+func TestMetadataCacheGetInformer(t *testing.T) {
+	secrets := toolscache.NewSharedIndexInformer(&toolscache.ListWatch{}, &metav1.PartialObjectMetadata{}, 0, toolscache.Indexers{})
+	c := &metadataCache{informers: map[schema.GroupVersionKind]toolscache.SharedIndexInformer{
+		corev1.SchemeGroupVersion.WithKind("Secret"): secrets,
+	}}
+
+	informer, err := c.GetInformer(metadataOf("Secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if informer != secrets {
+		t.Errorf("expected the metadata informer of the Secrets, got %v", informer)
+	}
+	if _, err := c.GetInformer(metadataOf("Pod")); err == nil {
+		t.Error("expected an error for a kind whose metadata is not cached")
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	object := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{
+		Name:          "pio",
+		Labels:        map[string]string{"team": "a"},
+		Annotations:   map[string]string{"kubectl.kubernetes.io/last-applied-configuration": `{"data":{"id_rsa":"a2V5"}}`},
+		ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+	}}
+	stripMetadata(object)
+	if object.Annotations != nil || object.ManagedFields != nil {
+		t.Errorf("expected the annotations and managed fields to be dropped, got %v and %v", object.Annotations, object.ManagedFields)
+	}
+	if object.Name != "pio" || object.Labels["team"] != "a" {
+		t.Errorf("expected the name and labels to be kept, got %v", object.ObjectMeta)
+	}
+}
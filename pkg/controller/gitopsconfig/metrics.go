@@ -0,0 +1,247 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+
+	// managedResourcesPrefix starts the line of the template processor's
+	// termination message reporting the number of managed resources.
+	managedResourcesPrefix = "managedResources="
+)
+
+// knownStates are the values of Status.State reported by the state metric.
+var knownStates = []string{"InProgress", "Success", "Failure", stateBlocked, stateQueued, stateRejected}
+
+var (
+	runDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "eunomia",
+			Subsystem: "gitopsconfig",
+			Name:      "run_duration_seconds",
+			Help:      "Duration of the finished jobs of a GitOpsConfig.",
+			Buckets:   prometheus.ExponentialBuckets(5, 2, 10),
+		},
+		[]string{"namespace", "name", "result"},
+	)
+	runsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eunomia",
+			Subsystem: "gitopsconfig",
+			Name:      "runs_total",
+			Help:      "Number of finished jobs of a GitOpsConfig, by result.",
+		},
+		[]string{"namespace", "name", "result"},
+	)
+	lastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "eunomia",
+			Subsystem: "gitopsconfig",
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix timestamp of the completion of the last successful job of a GitOpsConfig.",
+		},
+		[]string{"namespace", "name"},
+	)
+	configState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "eunomia",
+			Subsystem: "gitopsconfig",
+			Name:      "state",
+			Help:      "Current state of a GitOpsConfig; the series with the value 1 is labeled with the state from its status.",
+		},
+		[]string{"namespace", "name", "state"},
+	)
+	pendingRuns = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "eunomia",
+			Subsystem: "gitopsconfig",
+			Name:      "pending_runs",
+			Help:      "Number of runs of a GitOpsConfig deferred by sync windows or concurrency limits.",
+		},
+		[]string{"namespace", "name"},
+	)
+	managedResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "eunomia",
+			Subsystem: "gitopsconfig",
+			Name:      "managed_resources",
+			Help:      "Number of resources applied by the last successful job of a GitOpsConfig.",
+		},
+		[]string{"namespace", "name"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(runDuration, runsTotal, lastSuccess, configState, pendingRuns, managedResources)
+}
+
+// lastSuccessTimes keeps the value of the lastSuccess metric for each
+// GitOpsConfig, as Job events may come in any order, e.g. on operator start.
+var lastSuccessTimes = struct {
+	sync.Mutex
+	m map[string]metav1.Time
+}{m: map[string]metav1.Time{}}
+
+// recordState updates the metrics derived from the instance's Status.
+func recordState(instance *gitopsv1alpha1.GitOpsConfig) {
+	for _, s := range knownStates {
+		value := 0.0
+		if s == instance.Status.State {
+			value = 1
+		}
+		configState.WithLabelValues(instance.Namespace, instance.Name, s).Set(value)
+	}
+	pending := 0.0
+	if isPending(instance.Status.State) {
+		pending = 1
+	}
+	pendingRuns.WithLabelValues(instance.Namespace, instance.Name).Set(pending)
+}
+
+// recordJobCompletion updates the run metrics of the GitOpsConfig owning the
+// finished job. If counted is false, the job is only taken into account for
+// the last success metrics, e.g. because it may have been counted before the
+// operator restarted.
+func recordJobCompletion(ctx context.Context, kube client.Client, gitopsName string, job *batchv1.Job, counted bool) {
+	namespace := job.Namespace
+	result := resultSuccess
+	if job.Status.Succeeded == 0 {
+		result = resultFailure
+	}
+	finished := jobFinishTime(job)
+
+	if counted {
+		runsTotal.WithLabelValues(namespace, gitopsName, result).Inc()
+		if job.Status.StartTime != nil && finished != nil {
+			runDuration.WithLabelValues(namespace, gitopsName, result).Observe(finished.Sub(job.Status.StartTime.Time).Seconds())
+		}
+	}
+	if result != resultSuccess || finished == nil {
+		return
+	}
+
+	key := namespace + "/" + gitopsName
+	lastSuccessTimes.Lock()
+	defer lastSuccessTimes.Unlock()
+	if last, ok := lastSuccessTimes.m[key]; ok && !last.Before(finished) {
+		return
+	}
+	lastSuccessTimes.m[key] = *finished
+	lastSuccess.WithLabelValues(namespace, gitopsName).Set(float64(finished.Unix()))
+
+	if job.Labels["action"] == "delete" {
+		managedResources.WithLabelValues(namespace, gitopsName).Set(0)
+		return
+	}
+	count, err := jobManagedResources(ctx, kube, job)
+	if err != nil {
+		log.Error(err, "unable to read number of managed resources", "job", job.Name, "namespace", namespace)
+		return
+	}
+	if count >= 0 {
+		managedResources.WithLabelValues(namespace, gitopsName).Set(float64(count))
+	}
+}
+
+// forgetMetrics removes all metrics of a deleted GitOpsConfig.
+func forgetMetrics(namespace, name string) {
+	for _, result := range []string{resultSuccess, resultFailure} {
+		runDuration.DeleteLabelValues(namespace, name, result)
+		runsTotal.DeleteLabelValues(namespace, name, result)
+	}
+	for _, s := range knownStates {
+		configState.DeleteLabelValues(namespace, name, s)
+	}
+	lastSuccess.DeleteLabelValues(namespace, name)
+	pendingRuns.DeleteLabelValues(namespace, name)
+	managedResources.DeleteLabelValues(namespace, name)
+
+	lastSuccessTimes.Lock()
+	delete(lastSuccessTimes.m, namespace+"/"+name)
+	lastSuccessTimes.Unlock()
+}
+
+// jobFinishTime returns the time when the job completed or failed, or nil if
+// it's not known.
+func jobFinishTime(job *batchv1.Job) *metav1.Time {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime
+	}
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return &c.LastTransitionTime
+		}
+	}
+	return nil
+}
+
+// jobManagedResources returns the number of managed resources reported in
+// the termination message of the job's successful pod, or -1 if none was
+// reported (e.g. by template processors not supporting it).
+func jobManagedResources(ctx context.Context, kube client.Client, job *batchv1.Job) (int, error) {
+	pods := &corev1.PodList{}
+	err := kube.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return -1, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		for _, s := range pod.Status.ContainerStatuses {
+			if s.State.Terminated != nil {
+				if count, ok := parseManagedResources(s.State.Terminated.Message); ok {
+					return count, nil
+				}
+			}
+		}
+	}
+	return -1, nil
+}
+
+// parseManagedResources finds the "managedResources=N" line in a termination
+// message.
+func parseManagedResources(message string) (int, bool) {
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, managedResourcesPrefix) {
+			continue
+		}
+		count, err := strconv.Atoi(strings.TrimPrefix(line, managedResourcesPrefix))
+		if err != nil || count < 0 {
+			return 0, false
+		}
+		return count, true
+	}
+	return 0, false
+}
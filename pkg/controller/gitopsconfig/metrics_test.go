@@ -0,0 +1,157 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	//nolint:staticcheck
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func metricValue(t *testing.T, c prometheus.Collector) float64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 1)
+	c.Collect(ch)
+	m := &dto.Metric{}
+	err := (<-ch).Write(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Histogram != nil:
+		return float64(m.Histogram.GetSampleCount())
+	}
+	t.Fatalf("unsupported metric: %v", m)
+	return 0
+}
+
+func finishedJob(name string, start, end time.Time, succeeded bool) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{tagJobOwner: "metrics", "action": "create"},
+		},
+		Status: batchv1.JobStatus{StartTime: &metav1.Time{Time: start}},
+	}
+	if succeeded {
+		job.Status.Succeeded = 1
+		job.Status.CompletionTime = &metav1.Time{Time: end}
+	} else {
+		job.Status.Failed = 5
+		job.Status.Conditions = []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Time{Time: end}},
+		}
+	}
+	return job
+}
+
+func TestRecordJobCompletion(t *testing.T) {
+	defer forgetMetrics(namespace, "metrics")
+
+	start := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "job-2-abcde",
+			Namespace: namespace,
+			Labels:    map[string]string{"job-name": "job-2"},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: "managedResources=7\n"}},
+			}},
+		},
+	}
+	cl := fake.NewFakeClient(pod)
+
+	recordJobCompletion(context.Background(), cl, "metrics", finishedJob("job-1", start, start.Add(time.Minute), false), true)
+	recordJobCompletion(context.Background(), cl, "metrics", finishedJob("job-2", start.Add(time.Hour), start.Add(time.Hour+time.Minute), true), true)
+	// An older job seen after operator restart must not be counted, nor move the last success back
+	recordJobCompletion(context.Background(), cl, "metrics", finishedJob("job-0", start, start.Add(time.Minute), true), false)
+
+	if got := metricValue(t, runsTotal.WithLabelValues(namespace, "metrics", resultFailure)); got != 1 {
+		t.Errorf("expected 1 failed run, got %v", got)
+	}
+	if got := metricValue(t, runsTotal.WithLabelValues(namespace, "metrics", resultSuccess)); got != 1 {
+		t.Errorf("expected 1 successful run, got %v", got)
+	}
+	if got := metricValue(t, runDuration.WithLabelValues(namespace, "metrics", resultFailure).(prometheus.Histogram)); got != 1 {
+		t.Errorf("expected 1 observed failed run duration, got %v", got)
+	}
+	want := float64(start.Add(time.Hour + time.Minute).Unix())
+	if got := metricValue(t, lastSuccess.WithLabelValues(namespace, "metrics")); got != want {
+		t.Errorf("expected last success at %v, got %v", want, got)
+	}
+	if got := metricValue(t, managedResources.WithLabelValues(namespace, "metrics")); got != 7 {
+		t.Errorf("expected 7 managed resources, got %v", got)
+	}
+}
+
+func TestRecordState(t *testing.T) {
+	defer forgetMetrics(namespace, "gitops-operator")
+
+	gitops := defaultGitOpsConfig()
+	gitops.Status.State = stateQueued
+	recordState(gitops)
+
+	for _, s := range knownStates {
+		want := 0.0
+		if s == stateQueued {
+			want = 1
+		}
+		if got := metricValue(t, configState.WithLabelValues(namespace, gitops.Name, s)); got != want {
+			t.Errorf("expected state %q to be %v, got %v", s, want, got)
+		}
+	}
+	if got := metricValue(t, pendingRuns.WithLabelValues(namespace, gitops.Name)); got != 1 {
+		t.Errorf("expected 1 pending run, got %v", got)
+	}
+}
+
+func TestParseManagedResources(t *testing.T) {
+	tests := []struct {
+		message string
+		want    int
+		ok      bool
+	}{
+		{"managedResources=12", 12, true},
+		{"some output\nmanagedResources=3\n", 3, true},
+		{"", 0, false},
+		{"managedResources=many", 0, false},
+		{"managedResources=-1", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseManagedResources(tt.message)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseManagedResources(%q): expected (%d, %v), got (%d, %v)", tt.message, tt.want, tt.ok, got, ok)
+		}
+	}
+}
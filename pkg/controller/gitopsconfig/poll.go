@@ -0,0 +1,309 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/gitremote"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// defaultPollInterval is the interval of Poll triggers without interval.
+	defaultPollInterval = 5 * time.Minute
+	// pollTimeout bounds the time spent resolving the refs of a source.
+	pollTimeout = 30 * time.Second
+	// maxConcurrentPolls bounds the number of GitOpsConfigs whose refs are
+	// resolved at the same time.
+	maxConcurrentPolls = 4
+)
+
+// resolveRevision resolves a remote ref to a commit SHA; it's replaced in
+// tests.
+var resolveRevision = gitremote.Resolve
+
+// pollTimes records when the refs of each GitOpsConfig were last resolved,
+// and for which generation of its spec, so that reconciling it for other
+// reasons doesn't poll the repositories more often than the interval of its
+// Poll trigger. The refs are resolved in the background, outside of the
+// reconcile loop, and the GitOpsConfig is enqueued through events once
+// they're resolved. A nil pollTimes polls nothing.
+type pollTimes struct {
+	sync.Mutex
+	polls map[types.NamespacedName]lastPoll
+	// resolved holds the commits resolved in the background until the
+	// GitOpsConfig is reconciled.
+	resolved map[types.NamespacedName]polledRevisions
+	// slots bounds the number of sources resolved at the same time.
+	slots chan struct{}
+	// events receives the GitOpsConfigs whose refs were resolved.
+	events chan event.GenericEvent
+}
+
+// lastPoll is the last time the refs of a GitOpsConfig were resolved.
+type lastPoll struct {
+	time       time.Time
+	generation int64
+}
+
+// polledRevisions are the commits resolved for a generation of the spec of a
+// GitOpsConfig, or the error resolving them.
+type polledRevisions struct {
+	generation int64
+	template   string
+	parameter  string
+	err        error
+}
+
+// newPollTimes returns an empty pollTimes.
+func newPollTimes() *pollTimes {
+	return &pollTimes{
+		polls:    map[types.NamespacedName]lastPoll{},
+		resolved: map[types.NamespacedName]polledRevisions{},
+		slots:    make(chan struct{}, maxConcurrentPolls),
+		events:   make(chan event.GenericEvent, maxConcurrentPolls),
+	}
+}
+
+// start returns zero and records now as the poll time of instance if its
+// refs must be resolved, i.e. they weren't resolved during interval or its
+// spec changed since. Otherwise it returns the time left until the next poll.
+func (p *pollTimes) start(instance *gitopsv1alpha1.GitOpsConfig, interval time.Duration, now time.Time) time.Duration {
+	if p == nil {
+		return interval
+	}
+	key := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}
+	p.Lock()
+	defer p.Unlock()
+	last, ok := p.polls[key]
+	if ok && last.generation == instance.Generation && now.Sub(last.time) < interval {
+		return interval - now.Sub(last.time)
+	}
+	p.polls[key] = lastPoll{time: now, generation: instance.Generation}
+	return 0
+}
+
+// resolve resolves the refs of instance with resolveRefs in the background,
+// and enqueues instance once they're resolved. The commits resolved for an
+// older generation of its spec than the last poll are dropped.
+func (p *pollTimes) resolve(instance *gitopsv1alpha1.GitOpsConfig, resolveRefs func(*gitopsv1alpha1.GitOpsConfig) polledRevisions) {
+	if p == nil {
+		return
+	}
+	instance = instance.DeepCopy()
+	key := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}
+	go func() {
+		p.slots <- struct{}{}
+		revisions := resolveRefs(instance)
+		<-p.slots
+
+		p.Lock()
+		last, ok := p.polls[key]
+		if ok && last.generation == revisions.generation {
+			p.resolved[key] = revisions
+		}
+		p.Unlock()
+		if ok {
+			p.events <- event.GenericEvent{Meta: instance, Object: instance}
+		}
+	}()
+}
+
+// take returns and removes the commits resolved in the background for the
+// current generation of the spec of instance, if any.
+func (p *pollTimes) take(instance *gitopsv1alpha1.GitOpsConfig) (polledRevisions, bool) {
+	if p == nil {
+		return polledRevisions{}, false
+	}
+	key := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}
+	p.Lock()
+	defer p.Unlock()
+	revisions, ok := p.resolved[key]
+	delete(p.resolved, key)
+	return revisions, ok && revisions.generation == instance.Generation
+}
+
+// forget removes the poll time and resolved commits of a deleted
+// GitOpsConfig.
+func (p *pollTimes) forget(key types.NamespacedName) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	delete(p.polls, key)
+	delete(p.resolved, key)
+}
+
+// pollInterval returns the interval of the Poll trigger of instance.
+func pollInterval(instance *gitopsv1alpha1.GitOpsConfig) time.Duration {
+	for _, trigger := range instance.Spec.Triggers {
+		if trigger.Type != "Poll" || trigger.Interval == "" {
+			continue
+		}
+		interval, err := time.ParseDuration(trigger.Interval)
+		if err != nil || interval <= 0 {
+			log.Error(err, "invalid interval of Poll trigger, using the default", "instance", instance.Name, "interval", trigger.Interval)
+			return defaultPollInterval
+		}
+		return interval
+	}
+	return defaultPollInterval
+}
+
+// poll starts resolving the refs of the template and parameter sources of
+// instance in the background, if they weren't resolved during the interval
+// of its Poll trigger or its spec changed since. Once they're resolved and
+// instance is reconciled again, it starts a run for the resolved commits if
+// they differ from the ones of the last run, or of the pending run. It
+// returns true if a run was requested.
+func (r *Reconciler) poll(instance *gitopsv1alpha1.GitOpsConfig, now time.Time) (reconcile.Result, bool, error) {
+	if syncRequested(instance) != "" {
+		// The requested run is started first, with the revision requested by
+		// the trigger endpoint, if any
+		return reconcile.Result{}, false, nil
+	}
+	revisions, resolved := r.polls.take(instance)
+	interval := pollInterval(instance)
+	wait := r.polls.start(instance, interval, now)
+	if wait == 0 {
+		r.polls.resolve(instance, r.resolveSources)
+		wait = interval
+	}
+	result := reconcile.Result{RequeueAfter: wait}
+	if !resolved {
+		return result, false, nil
+	}
+	if revisions.err != nil {
+		return result, false, revisions.err
+	}
+
+	status := &instance.Status
+	if status.PendingTemplateRevision != "" || status.PendingParameterRevision != "" {
+		if revisions.template == status.PendingTemplateRevision && revisions.parameter == status.PendingParameterRevision {
+			// The pending run already deploys these commits
+			return result, false, nil
+		}
+	} else if revisions.template == status.TemplateRevision && revisions.parameter == status.ParameterRevision {
+		return result, false, nil
+	}
+
+	log.Info("New commits found by Poll trigger, creating job", "instance", instance.Name, "templateRevision", revisions.template, "parameterRevision", revisions.parameter)
+	// Deploy the resolved commits, even if the refs move in the meantime
+	target := instance.DeepCopy()
+	target.Spec.TemplateSource.Ref = revisions.template
+	target.Spec.ParameterSource.Ref = revisions.parameter
+	createResult, err := r.CreateJob("create", target)
+	if err != nil {
+		return result, true, err
+	}
+	return earliestResult(result, createResult), true, nil
+}
+
+// resolveSources returns the commits which the refs of the template and
+// parameter sources of instance point to.
+func (r *Reconciler) resolveSources(instance *gitopsv1alpha1.GitOpsConfig) polledRevisions {
+	spec := &instance.Spec
+	revisions := polledRevisions{generation: instance.Generation}
+	revisions.template, revisions.err = r.resolveSource(instance, spec.TemplateSource)
+	if revisions.err != nil {
+		return revisions
+	}
+	revisions.parameter = revisions.template
+	if spec.ParameterSource != spec.TemplateSource {
+		revisions.parameter, revisions.err = r.resolveSource(instance, spec.ParameterSource)
+	}
+	return revisions
+}
+
+// deferRevisions returns a function recording in the status the commits
+// which the deferred run of instance is going to deploy, when its refs were
+// resolved by the Poll trigger, so that the run deploys them once it starts.
+// The revisions requested by the trigger endpoint are already recorded.
+func deferRevisions(instance *gitopsv1alpha1.GitOpsConfig) func(*gitopsv1alpha1.GitOpsConfigStatus) {
+	return func(status *gitopsv1alpha1.GitOpsConfigStatus) {
+		if gitremote.IsCommitSHA(instance.Spec.TemplateSource.Ref) {
+			status.PendingTemplateRevision = instance.Spec.TemplateSource.Ref
+		}
+		if gitremote.IsCommitSHA(instance.Spec.ParameterSource.Ref) {
+			status.PendingParameterRevision = instance.Spec.ParameterSource.Ref
+		}
+	}
+}
+
+// revisionsDeferred returns true if the status of instance already records
+// the commits its deferred run is going to deploy.
+func revisionsDeferred(instance *gitopsv1alpha1.GitOpsConfig) bool {
+	status := instance.Status.DeepCopy()
+	deferRevisions(instance)(status)
+	return status.PendingTemplateRevision == instance.Status.PendingTemplateRevision &&
+		status.PendingParameterRevision == instance.Status.PendingParameterRevision
+}
+
+// pendingTarget returns instance with its refs pinned to the revisions
+// resolved by the Poll trigger or requested by the trigger endpoint for its
+// pending run, if any.
+func pendingTarget(instance *gitopsv1alpha1.GitOpsConfig) *gitopsv1alpha1.GitOpsConfig {
+	status := &instance.Status
+	if status.PendingTemplateRevision == "" && status.PendingParameterRevision == "" {
+		return instance
+	}
+	target := instance.DeepCopy()
+	if status.PendingTemplateRevision != "" {
+		target.Spec.TemplateSource.Ref = status.PendingTemplateRevision
+	}
+	if status.PendingParameterRevision != "" {
+		target.Spec.ParameterSource.Ref = status.PendingParameterRevision
+	}
+	return target
+}
+
+// resolveSource returns the commit SHA which the ref of source points to.
+func (r *Reconciler) resolveSource(instance *gitopsv1alpha1.GitOpsConfig, source gitopsv1alpha1.GitConfig) (string, error) {
+	remote := gitremote.Source{
+		URI:        source.URI,
+		Ref:        source.Ref,
+		HTTPProxy:  source.HTTPProxy,
+		HTTPSProxy: source.HTTPSProxy,
+		NOProxy:    source.NOProxy,
+	}
+	if source.SecretRef != "" {
+		secret := &corev1.Secret{}
+		err := r.uncachedReader().Get(context.TODO(), types.NamespacedName{Namespace: instance.Namespace, Name: source.SecretRef}, secret)
+		if err != nil {
+			log.Error(err, "unable to retrieve gitconfig secret", "instance", instance.Name, "secret", source.SecretRef)
+			return "", fmt.Errorf("unable to retrieve gitconfig secret %q of GitOpsConfig %q: %w", source.SecretRef, instance.Name, err)
+		}
+		remote.Files = secret.Data
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), pollTimeout)
+	defer cancel()
+	revision, err := resolveRevision(ctx, remote)
+	if err != nil {
+		log.Error(err, "unable to resolve remote ref", "instance", instance.Name, "uri", source.URI, "ref", source.Ref)
+		return "", fmt.Errorf("unable to resolve ref %q of %q for GitOpsConfig %q: %w", source.Ref, source.URI, instance.Name, err)
+	}
+	return revision, nil
+}
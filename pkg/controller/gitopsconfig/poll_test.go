@@ -0,0 +1,241 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/gitremote"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPollInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		want     time.Duration
+	}{
+		{"", defaultPollInterval},
+		{"1m30s", 90 * time.Second},
+		{"invalid", defaultPollInterval},
+		{"-1m", defaultPollInterval},
+	}
+	for _, tt := range tests {
+		gitops := defaultGitOpsConfig()
+		gitops.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Poll", Interval: tt.interval}}
+		if got := pollInterval(gitops); got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.interval, tt.want, got)
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	revisions := map[string]string{
+		"https://github.com/KohlsTechnology/eunomia": strings.Repeat("a", 40),
+		"https://github.com/URI1/URI2":               strings.Repeat("b", 40),
+	}
+	var sources []gitremote.Source
+	defer func(resolve func(context.Context, gitremote.Source) (string, error)) { resolveRevision = resolve }(resolveRevision)
+	resolveRevision = func(ctx context.Context, source gitremote.Source) (string, error) {
+		sources = append(sources, source)
+		revision, ok := revisions[source.URI]
+		if !ok {
+			return "", errors.New("unreachable")
+		}
+		return revision, nil
+	}
+
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Poll", Interval: "1m"}}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "pio", Namespace: namespace},
+		Data:       map[string][]byte{".gitconfig": []byte("[user]\n")},
+	}
+	cl := fake.NewFakeClient(gitops, secret)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme, polls: newPollTimes()}
+	now := time.Now()
+
+	get := func() *gitopsv1alpha1.GitOpsConfig {
+		t.Helper()
+		instance := &gitopsv1alpha1.GitOpsConfig{}
+		if err := cl.Get(context.Background(), util.GetNN(gitops), instance); err != nil {
+			t.Fatal(err)
+		}
+		return instance
+	}
+	poll := func(now time.Time) bool {
+		t.Helper()
+		requested, err := pollResolved(t, r, get, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return requested
+	}
+
+	// The first poll starts a run for the resolved commits
+	if !poll(now) {
+		t.Fatal("expected a run for the first poll")
+	}
+	jobs, err := findJobList(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(jobs))
+	}
+	env := map[string]string{}
+	for _, v := range jobs[0].Spec.Template.Spec.Containers[0].Env {
+		env[v.Name] = v.Value
+	}
+	if env["TEMPLATE_GIT_REF"] != strings.Repeat("a", 40) || env["PARAMETER_GIT_REF"] != strings.Repeat("b", 40) {
+		t.Errorf("expected the job to check out the resolved commits, got %q and %q", env["TEMPLATE_GIT_REF"], env["PARAMETER_GIT_REF"])
+	}
+	if len(sources) != 2 || string(sources[0].Files[".gitconfig"]) != "[user]\n" || sources[0].HTTPSProxy != "http://proxy.com:8080" {
+		t.Errorf("unexpected sources %+v", sources)
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	if err := cl.Get(context.Background(), util.GetNN(gitops), instance); err != nil {
+		t.Fatal(err)
+	}
+	if instance.Status.TemplateRevision != strings.Repeat("a", 40) || instance.Status.ParameterRevision != strings.Repeat("b", 40) {
+		t.Errorf("expected the revisions to be recorded, got %+v", instance.Status)
+	}
+	startTime := metav1.Now()
+	jobs[0].Status.Succeeded = 1
+	jobs[0].Status.StartTime = &startTime
+	if err := cl.Update(context.Background(), &jobs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The refs aren't resolved again during the interval
+	if _, requested, err := r.poll(get(), now.Add(30*time.Second)); err != nil || requested || len(sources) != 2 {
+		t.Errorf("expected no poll during the interval, got %d polls", len(sources))
+	}
+	// Unchanged commits don't start a run
+	if poll(now.Add(time.Minute)) {
+		t.Error("expected no run for unchanged commits")
+	}
+	// New commits do
+	revisions["https://github.com/URI1/URI2"] = strings.Repeat("c", 40)
+	if !poll(now.Add(2 * time.Minute)) {
+		t.Error("expected a run for the new parameter commit")
+	}
+	if jobs, _ = findJobList(cl); len(jobs) != 2 {
+		t.Errorf("expected 2 jobs, got %d", len(jobs))
+	}
+
+	// Unreachable repositories are an error
+	delete(revisions, "https://github.com/KohlsTechnology/eunomia")
+	if _, err := pollResolved(t, r, get, now.Add(3*time.Minute)); err == nil {
+		t.Error("expected an error for an unreachable repository")
+	}
+}
+
+func TestPollDeferredRun(t *testing.T) {
+	revision := strings.Repeat("a", 40)
+	polls := 0
+	defer func(resolve func(context.Context, gitremote.Source) (string, error)) { resolveRevision = resolve }(resolveRevision)
+	resolveRevision = func(ctx context.Context, source gitremote.Source) (string, error) {
+		polls++
+		return revision, nil
+	}
+
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Poll", Interval: "1m"}}
+	gitops.Spec.TemplateSource.SecretRef = ""
+	gitops.Spec.ParameterSource = gitops.Spec.TemplateSource
+	gitops.Spec.Suspend = true
+	cl := fake.NewFakeClient(gitops)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme, polls: newPollTimes()}
+	now := time.Now()
+	get := func() *gitopsv1alpha1.GitOpsConfig {
+		t.Helper()
+		instance := &gitopsv1alpha1.GitOpsConfig{}
+		if err := cl.Get(context.Background(), util.GetNN(gitops), instance); err != nil {
+			t.Fatal(err)
+		}
+		return instance
+	}
+
+	// The run of a suspended config is deferred with the resolved commits
+	if requested, err := pollResolved(t, r, get, now); err != nil || !requested {
+		t.Fatalf("expected a run to be requested, got %t, %v", requested, err)
+	}
+	instance := get()
+	if instance.Status.State != stateBlocked || instance.Status.PendingTemplateRevision != revision || instance.Status.PendingParameterRevision != revision {
+		t.Errorf("expected a blocked run for %s, got %+v", revision, instance.Status)
+	}
+	// The pending run isn't requested again
+	if requested, err := pollResolved(t, r, get, now.Add(time.Minute)); err != nil || requested || polls != 2 {
+		t.Errorf("expected no new run for the pending commits, got %t, %v after %d polls", requested, err, polls)
+	}
+	// A spec change is polled without waiting for the interval
+	instance.Generation++
+	changed := func() *gitopsv1alpha1.GitOpsConfig { return instance }
+	if _, err := pollResolved(t, r, changed, now.Add(time.Minute+time.Second)); err != nil || polls != 3 {
+		t.Errorf("expected a poll after the spec change, got %v after %d polls", err, polls)
+	}
+
+	// Once resumed, the deferred run deploys the resolved commits
+	instance = get()
+	instance.Spec.Suspend = false
+	revision = strings.Repeat("b", 40)
+	if _, err := r.CreateJob("create", pendingTarget(instance)); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := findJobList(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(jobs))
+	}
+	for _, v := range jobs[0].Spec.Template.Spec.Containers[0].Env {
+		if (v.Name == "TEMPLATE_GIT_REF" || v.Name == "PARAMETER_GIT_REF") && v.Value != strings.Repeat("a", 40) {
+			t.Errorf("expected %s to be the deferred commit, got %q", v.Name, v.Value)
+		}
+	}
+	instance = get()
+	if instance.Status.TemplateRevision != strings.Repeat("a", 40) || instance.Status.PendingTemplateRevision != "" || instance.Status.PendingParameterRevision != "" {
+		t.Errorf("expected the deferred commits to be recorded as deployed, got %+v", instance.Status)
+	}
+}
+
+// pollResolved starts resolving the refs of the GitOpsConfig returned by get
+// in the background, waits for them to be resolved and reconciles its Poll
+// trigger again to handle the resolved commits.
+func pollResolved(t *testing.T, r *Reconciler, get func() *gitopsv1alpha1.GitOpsConfig, now time.Time) (bool, error) {
+	t.Helper()
+	if _, requested, err := r.poll(get(), now); err != nil || requested {
+		t.Fatalf("expected the refs to be resolved in the background, got %t, %v", requested, err)
+	}
+	select {
+	case <-r.polls.events:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the refs to be resolved")
+	}
+	_, requested, err := r.poll(get(), now)
+	return requested, err
+}
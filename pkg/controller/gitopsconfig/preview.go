@@ -0,0 +1,237 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/giturl"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// tagPreviewOf labels the GitOpsConfigs and namespaces of pull request
+	// preview environments with the name of their template GitOpsConfig.
+	tagPreviewOf string = "gitopsconfig.eunomia.kohls.io/previewOf"
+	// tagPullRequest labels the GitOpsConfigs and namespaces of pull request
+	// preview environments with the number of the pull request.
+	tagPullRequest string = "gitopsconfig.eunomia.kohls.io/pullRequest"
+
+	// maxNamespaceLength is the maximum length of a namespace name.
+	maxNamespaceLength = 63
+
+	// previewRoleBinding is the name of the RoleBinding allowing the service
+	// account of a preview environment to manage resources in its namespace.
+	previewRoleBinding = "eunomia-preview"
+	// previewClusterRole is the ClusterRole bound to the service account of a
+	// preview environment in its namespace.
+	previewClusterRole = "admin"
+)
+
+// PullRequest describes a pull request for which a preview environment is
+// created from a template GitOpsConfig having a PullRequest trigger.
+type PullRequest struct {
+	// RepoFullName is the path of the repository of the pull request, e.g. "kohlstechnology/eunomia"
+	RepoFullName string
+	// RepoURLs are the URLs of the repository of the pull request, e.g. its clone and ssh URLs
+	RepoURLs []string
+	// Number of the pull request
+	Number int
+	// HeadSHA is the commit SHA of the head of the pull request
+	HeadSHA string
+}
+
+// PreviewName returns the name of the GitOpsConfig of the preview environment
+// of pull request number, created from the template GitOpsConfig.
+func PreviewName(template *gitopsv1alpha1.GitOpsConfig, number int) string {
+	return fmt.Sprintf("%s-pr-%d", template.Name, number)
+}
+
+// previewNamespace returns the generated namespace where the resources of the
+// preview environment of pull request number are created. Names too long for
+// a namespace are shortened, keeping them unique with a hash.
+func previewNamespace(template *gitopsv1alpha1.GitOpsConfig, number int) string {
+	prefix := template.Namespace + "-" + template.Name
+	suffix := fmt.Sprintf("-pr-%d", number)
+	if len(prefix)+len(suffix) > maxNamespaceLength {
+		sum := sha256.Sum256([]byte(template.Namespace + "/" + template.Name))
+		hash := hex.EncodeToString(sum[:])[:8]
+		prefix = strings.TrimRight(prefix[:maxNamespaceLength-len(suffix)-len(hash)-1], "-") + "-" + hash
+	}
+	return prefix + suffix
+}
+
+// previewSpec returns the spec of the preview environment of pr: the sources in
+// the repository of the pull request are pinned to its head, and the
+// PullRequest trigger is replaced by a Change trigger, so that a new run is
+// started each time the head of the pull request changes.
+func previewSpec(template *gitopsv1alpha1.GitOpsConfig, pr PullRequest) gitopsv1alpha1.GitOpsConfigSpec {
+	spec := *template.Spec.DeepCopy()
+	if giturl.Match(spec.TemplateSource.URI, pr.RepoFullName, pr.RepoURLs) {
+		spec.TemplateSource.Ref = pr.HeadSHA
+	}
+	if giturl.Match(spec.ParameterSource.URI, pr.RepoFullName, pr.RepoURLs) {
+		spec.ParameterSource.Ref = pr.HeadSHA
+	}
+	spec.TargetNamespace = previewNamespace(template, pr.Number)
+
+	triggers := []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	for _, trigger := range spec.Triggers {
+		if trigger.Type != "PullRequest" && trigger.Type != "Change" {
+			triggers = append(triggers, trigger)
+		}
+	}
+	spec.Triggers = triggers
+	return spec
+}
+
+// ApplyPreview creates the preview environment of pr from the template
+// GitOpsConfig, or updates it to the new head of the pull request.
+func (r *Reconciler) ApplyPreview(template *gitopsv1alpha1.GitOpsConfig, pr PullRequest) error {
+	labels := map[string]string{
+		tagPreviewOf:   template.Name,
+		tagPullRequest: strconv.Itoa(pr.Number),
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: previewNamespace(template, pr.Number), Labels: labels}}
+	err := r.client.Create(context.TODO(), ns)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		log.Error(err, "unable to create preview namespace", "template", template.Name, "namespace", ns.Name)
+		return fmt.Errorf("unable to create namespace %q for preview of pull request %d of %q: %w", ns.Name, pr.Number, template.Name, err)
+	}
+	if apierrors.IsAlreadyExists(err) {
+		// Only grant access to namespaces created for this preview environment
+		existing := &corev1.Namespace{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: ns.Name}, existing)
+		if err != nil {
+			return fmt.Errorf("unable to get namespace %q for preview of pull request %d of %q: %w", ns.Name, pr.Number, template.Name, err)
+		}
+		if existing.Labels[tagPreviewOf] != labels[tagPreviewOf] || existing.Labels[tagPullRequest] != labels[tagPullRequest] {
+			log.Info("Refusing to use namespace not created for preview", "template", template.Name, "namespace", ns.Name)
+			return fmt.Errorf("namespace %q for preview of pull request %d of %q already exists and was not created for it", ns.Name, pr.Number, template.Name)
+		}
+	}
+
+	err = r.applyPreviewRoleBinding(template, ns.Name, labels)
+	if err != nil {
+		log.Error(err, "unable to apply preview RoleBinding", "template", template.Name, "namespace", ns.Name)
+		return fmt.Errorf("unable to grant access to namespace %q for preview of pull request %d of %q: %w", ns.Name, pr.Number, template.Name, err)
+	}
+
+	preview := &gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: PreviewName(template, pr.Number), Namespace: template.Namespace},
+	}
+	op, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, preview, func() error {
+		if preview.Labels == nil {
+			preview.Labels = map[string]string{}
+		}
+		for k, v := range labels {
+			preview.Labels[k] = v
+		}
+		preview.Spec = previewSpec(template, pr)
+		return controllerutil.SetOwnerReference(template, preview, r.scheme)
+	})
+	if err != nil {
+		log.Error(err, "unable to apply preview GitOpsConfig", "template", template.Name, "preview", preview.Name)
+		return fmt.Errorf("unable to apply GitOpsConfig %q for preview of pull request %d of %q: %w", preview.Name, pr.Number, template.Name, err)
+	}
+	log.Info("Applied preview GitOpsConfig", "template", template.Name, "preview", preview.Name, "operation", op, "ref", pr.HeadSHA)
+	return nil
+}
+
+// applyPreviewRoleBinding binds the previewClusterRole to the service account
+// of the template in the preview namespace, so that the jobs of the preview
+// environment can manage resources in it. The RoleBinding is deleted with the
+// namespace.
+func (r *Reconciler) applyPreviewRoleBinding(template *gitopsv1alpha1.GitOpsConfig, namespace string, labels map[string]string) error {
+	serviceAccount := template.Spec.ServiceAccountRef
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: previewRoleBinding, Namespace: namespace},
+	}
+	_, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, binding, func() error {
+		binding.Labels = labels
+		// The role of an existing RoleBinding can't be changed
+		binding.RoleRef = rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: previewClusterRole}
+		binding.Subjects = []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: serviceAccount, Namespace: template.Namespace}}
+		return nil
+	})
+	return err
+}
+
+// DeletePreview deletes the preview environment of pull request number. Its
+// resources are deleted by the finalizer, which then deletes its namespace.
+func (r *Reconciler) DeletePreview(template *gitopsv1alpha1.GitOpsConfig, number int) error {
+	preview := &gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: PreviewName(template, number), Namespace: template.Namespace},
+	}
+	err := r.client.Delete(context.TODO(), preview)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Error(err, "unable to delete preview GitOpsConfig", "template", template.Name, "preview", preview.Name)
+		return fmt.Errorf("unable to delete GitOpsConfig %q for preview of pull request %d of %q: %w", preview.Name, number, template.Name, err)
+	}
+	log.Info("Deleted preview GitOpsConfig", "template", template.Name, "preview", preview.Name)
+	return nil
+}
+
+// deletePreviewNamespace deletes the target namespace of a deleted preview
+// environment, once its resources have been deleted, and before its finalizer
+// is removed. Namespaces which were not created for the preview environment
+// are kept.
+func (r *Reconciler) deletePreviewNamespace(ctx context.Context, instance *gitopsv1alpha1.GitOpsConfig) error {
+	if instance.Labels[tagPreviewOf] == "" || instance.Spec.TargetNamespace == "" {
+		return nil
+	}
+	ns := &corev1.Namespace{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: instance.Spec.TargetNamespace}, ns)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get namespace %q of preview %q: %w", instance.Spec.TargetNamespace, instance.Name, err)
+	}
+	if ns.Labels[tagPreviewOf] != instance.Labels[tagPreviewOf] || ns.Labels[tagPullRequest] != instance.Labels[tagPullRequest] {
+		log.Info("Keeping target namespace not created for preview", "instance", instance.Name, "namespace", ns.Name)
+		return nil
+	}
+	if ns.DeletionTimestamp != nil {
+		// Already being deleted
+		return nil
+	}
+	err = r.client.Delete(ctx, ns)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to delete namespace %q of preview %q: %w", ns.Name, instance.Name, err)
+	}
+	log.Info("Deleted preview namespace", "instance", instance.Name, "namespace", ns.Name)
+	return nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	//nolint:staticcheck
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestApplyAndDeletePreview(t *testing.T) {
+	template := defaultGitOpsConfig()
+	template.Spec.ParameterSource.URI = template.Spec.TemplateSource.URI
+	template.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "PullRequest"}, {Type: "Periodic", Cron: "0 * * * *"}}
+	cl := fake.NewFakeClient(template)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	headSHA := "0123456789abcdef0123456789abcdef01234567"
+	err := r.ApplyPreview(template, PullRequest{RepoFullName: "KohlsTechnology/eunomia", Number: 42, HeadSHA: headSHA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preview := &gitopsv1alpha1.GitOpsConfig{}
+	err = cl.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: "gitops-operator-pr-42"}, preview)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Spec.TemplateSource.Ref != headSHA || preview.Spec.ParameterSource.Ref != headSHA {
+		t.Errorf("expected sources pinned to %q, got %q and %q", headSHA, preview.Spec.TemplateSource.Ref, preview.Spec.ParameterSource.Ref)
+	}
+	if preview.Spec.TargetNamespace != "gitops-gitops-operator-pr-42" {
+		t.Errorf("expected generated target namespace, got %q", preview.Spec.TargetNamespace)
+	}
+	if !ContainsTrigger(preview, "Change") || !ContainsTrigger(preview, "Periodic") || ContainsTrigger(preview, "PullRequest") {
+		t.Errorf("expected Change and Periodic triggers, got %v", preview.Spec.Triggers)
+	}
+	if len(preview.OwnerReferences) != 1 || preview.OwnerReferences[0].Name != template.Name {
+		t.Errorf("expected preview to be owned by template, got %v", preview.OwnerReferences)
+	}
+	ns := &corev1.Namespace{}
+	err = cl.Get(context.Background(), types.NamespacedName{Name: preview.Spec.TargetNamespace}, ns)
+	if err != nil {
+		t.Fatalf("expected target namespace to be created: %v", err)
+	}
+	binding := &rbacv1.RoleBinding{}
+	err = cl.Get(context.Background(), types.NamespacedName{Namespace: ns.Name, Name: previewRoleBinding}, binding)
+	if err != nil {
+		t.Fatalf("expected preview RoleBinding to be created: %v", err)
+	}
+	wantSubject := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: template.Spec.ServiceAccountRef, Namespace: namespace}
+	if binding.RoleRef.Name != previewClusterRole || len(binding.Subjects) != 1 || binding.Subjects[0] != wantSubject {
+		t.Errorf("expected %q bound to %v, got %v bound to %v", previewClusterRole, wantSubject, binding.RoleRef, binding.Subjects)
+	}
+
+	// A new commit is pushed to the pull request
+	newSHA := "89abcdef0123456789abcdef0123456789abcdef"
+	err = r.ApplyPreview(template, PullRequest{RepoFullName: "KohlsTechnology/eunomia", Number: 42, HeadSHA: newSHA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cl.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: "gitops-operator-pr-42"}, preview)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Spec.TemplateSource.Ref != newSHA {
+		t.Errorf("expected preview updated to %q, got %q", newSHA, preview.Spec.TemplateSource.Ref)
+	}
+
+	err = r.DeletePreview(template, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cl.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: "gitops-operator-pr-42"}, preview)
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected preview to be deleted, got %v", err)
+	}
+}
+
+func TestApplyPreviewRefusesExistingNamespace(t *testing.T) {
+	template := defaultGitOpsConfig()
+	template.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "PullRequest"}}
+	existing := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "gitops-gitops-operator-pr-42"}}
+	cl := fake.NewFakeClient(template, existing)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	err := r.ApplyPreview(template, PullRequest{RepoFullName: "KohlsTechnology/eunomia", Number: 42, HeadSHA: "0123456789abcdef0123456789abcdef01234567"})
+	if err == nil {
+		t.Fatal("expected an error when the preview namespace exists and was not created for it")
+	}
+	err = cl.Get(context.Background(), types.NamespacedName{Namespace: existing.Name, Name: previewRoleBinding}, &rbacv1.RoleBinding{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected no RoleBinding in namespace not created for preview, got %v", err)
+	}
+	err = cl.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: "gitops-operator-pr-42"}, &gitopsv1alpha1.GitOpsConfig{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected no preview GitOpsConfig, got %v", err)
+	}
+}
+
+func TestPreviewSpecPinsPullRequestRepo(t *testing.T) {
+	template := defaultGitOpsConfig()
+	headSHA := "0123456789abcdef0123456789abcdef01234567"
+	spec := previewSpec(template, PullRequest{RepoFullName: "URI1/URI2", Number: 3, HeadSHA: headSHA})
+	if spec.TemplateSource.Ref != "master" || spec.ParameterSource.Ref != headSHA {
+		t.Errorf("expected only parameterSource pinned to %q, got %q and %q", headSHA, spec.TemplateSource.Ref, spec.ParameterSource.Ref)
+	}
+}
+
+func TestDeletePreviewNamespace(t *testing.T) {
+	labels := map[string]string{tagPreviewOf: "app", tagPullRequest: "7"}
+	preview := defaultGitOpsConfig()
+	preview.Labels = labels
+	preview.Spec.TargetNamespace = "gitops-app-pr-7"
+	owned := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "gitops-app-pr-7", Labels: labels}}
+	other := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shared"}}
+	cl := fake.NewFakeClient(owned, other)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	err := r.deletePreviewNamespace(context.Background(), preview)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cl.Get(context.Background(), types.NamespacedName{Name: owned.Name}, &corev1.Namespace{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected preview namespace to be deleted, got %v", err)
+	}
+
+	preview.Spec.TargetNamespace = "shared"
+	err = r.deletePreviewNamespace(context.Background(), preview)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cl.Get(context.Background(), types.NamespacedName{Name: other.Name}, &corev1.Namespace{})
+	if err != nil {
+		t.Errorf("expected namespace not created for preview to be kept, got %v", err)
+	}
+}
+
+// failingDeleteClient fails to delete any object.
+type failingDeleteClient struct {
+	client.Client
+}
+
+func (c failingDeleteClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	return apierrors.NewForbidden(corev1.Resource("namespaces"), "", nil)
+}
+
+func TestRemoveFinalizerKeepsPreviewNamespace(t *testing.T) {
+	labels := map[string]string{tagPreviewOf: "app", tagPullRequest: "7"}
+	preview := defaultGitOpsConfig()
+	preview.Labels = labels
+	preview.Finalizers = []string{tagFinalizer}
+	preview.Spec.TargetNamespace = "gitops-app-pr-7"
+	owned := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "gitops-app-pr-7", Labels: labels}}
+	cl := fake.NewFakeClient(preview, owned)
+	r := &Reconciler{client: failingDeleteClient{cl}, scheme: scheme.Scheme}
+
+	_, err := r.removeFinalizer(context.Background(), preview)
+	if err == nil {
+		t.Fatal("expected an error when the preview namespace can't be deleted")
+	}
+	found := &gitopsv1alpha1.GitOpsConfig{}
+	err = cl.Get(context.Background(), types.NamespacedName{Namespace: preview.Namespace, Name: preview.Name}, found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(found.Finalizers, tagFinalizer) {
+		t.Errorf("expected finalizer to be kept until the preview namespace is deleted, got %v", found.Finalizers)
+	}
+}
+
+func TestPreviewNamespace(t *testing.T) {
+	template := defaultGitOpsConfig()
+	template.Name = strings.Repeat("a", 70)
+	got := previewNamespace(template, 1234)
+	if len(got) > maxNamespaceLength || !strings.HasSuffix(got, "-pr-1234") {
+		t.Errorf("expected namespace name of at most %d characters, got %q", maxNamespaceLength, got)
+	}
+	template.Name = strings.Repeat("a", 69)
+	if other := previewNamespace(template, 1234); other == got {
+		t.Errorf("expected different templates to get different namespaces, got %q", got)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// referenceIndex is the name of the cache index of the GitOpsConfigs by the
+// objects they reference, e.g. "Secret/team/git-credentials".
+const referenceIndex = "spec.references"
+
+// reference identifies an object referenced by a GitOpsConfig.
+type reference struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (ref reference) String() string {
+	return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+}
+
+// references returns the objects referenced by instance whose content is
+// used by its jobs: the gitconfig Secrets of its sources, its ServiceAccount,
+// its job template ConfigMap and its TemplateProcessor.
+func references(instance *gitopsv1alpha1.GitOpsConfig) []reference {
+	refs := []reference{}
+	seen := map[reference]bool{}
+	add := func(kind, namespace, name string) {
+		ref := reference{Kind: kind, Namespace: namespace, Name: name}
+		if name != "" && !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	add("Secret", instance.Namespace, instance.Spec.TemplateSource.SecretRef)
+	add("Secret", instance.Namespace, instance.Spec.ParameterSource.SecretRef)
+	add("ServiceAccount", instance.Namespace, instance.Spec.ServiceAccountRef)
+	if instance.Spec.JobTemplateRef != nil {
+		// Catalog ConfigMaps are referenced from other namespaces
+		name, err := jobTemplateName(instance)
+		if err == nil {
+			add("ConfigMap", name.Namespace, name.Name)
+		}
+	}
+	add("TemplateProcessor", "", instance.Spec.TemplateProcessorRef)
+	return refs
+}
+
+// referenceIndexValues returns the referenceIndex values of a GitOpsConfig.
+func referenceIndexValues(obj runtime.Object) []string {
+	instance, ok := obj.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return nil
+	}
+	values := []string{}
+	for _, ref := range references(instance) {
+		values = append(values, ref.String())
+	}
+	return values
+}
+
+// referencingRequests returns a function mapping an object of kind to
+// reconcile requests for the GitOpsConfigs with a ReferenceChange trigger
+// referencing it, so that they are reconciled when it changes.
+func referencingRequests(c client.Client, kind string) handler.ToRequestsFunc {
+	return func(o handler.MapObject) []reconcile.Request {
+		ref := reference{Kind: kind, Namespace: o.Meta.GetNamespace(), Name: o.Meta.GetName()}
+		list := &gitopsv1alpha1.GitOpsConfigList{}
+		err := c.List(context.TODO(), list, client.MatchingFields{referenceIndex: ref.String()})
+		if err != nil {
+			log.Error(err, "unable to list the GitOpsConfigs referencing an object", "reference", ref.String())
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for i := range list.Items {
+			instance := &list.Items[i]
+			if !ContainsTrigger(instance, "ReferenceChange") {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}})
+		}
+		return requests
+	}
+}
+
+// referencesHash returns a hash of the content of the objects referenced by
+// instance. Missing objects are hashed as such, so that creating them
+// changes the hash. The hash is salted with the UID of instance, so that the
+// hashes of the same content differ between GitOpsConfigs and can't be
+// looked up. The objects are read from reader, as only the metadata of the
+// Secrets, ServiceAccounts and ConfigMaps is cached.
+func referencesHash(ctx context.Context, reader client.Reader, instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n", instance.UID)
+	for _, ref := range references(instance) {
+		fmt.Fprintf(hash, "%s\n", ref)
+		key := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+		var err error
+		switch ref.Kind {
+		case "Secret":
+			secret := &corev1.Secret{}
+			if err = reader.Get(ctx, key, secret); err == nil {
+				hashData(hash, secret.Data)
+			}
+		case "ServiceAccount":
+			// The tokens and pull secrets of the jobs come from the ServiceAccount
+			account := &corev1.ServiceAccount{}
+			if err = reader.Get(ctx, key, account); err == nil {
+				for _, secret := range account.Secrets {
+					fmt.Fprintf(hash, "secret=%s\n", secret.Name)
+				}
+				for _, secret := range account.ImagePullSecrets {
+					fmt.Fprintf(hash, "imagePullSecret=%s\n", secret.Name)
+				}
+			}
+		case "ConfigMap":
+			configMap := &corev1.ConfigMap{}
+			if err = reader.Get(ctx, key, configMap); err == nil {
+				data := map[string][]byte{}
+				for key, value := range configMap.Data {
+					data[key] = []byte(value)
+				}
+				for key, value := range configMap.BinaryData {
+					data[key] = value
+				}
+				hashData(hash, data)
+			}
+		case "TemplateProcessor":
+			processor := &gitopsv1alpha1.TemplateProcessor{}
+			if err = reader.Get(ctx, key, processor); err == nil {
+				var spec []byte
+				spec, err = json.Marshal(processor.Spec)
+				hash.Write(spec)
+			}
+		}
+		if apierrors.IsNotFound(err) {
+			fmt.Fprintf(hash, "missing\n")
+		} else if err != nil {
+			return "", fmt.Errorf("unable to get %s referenced by GitOpsConfig %q: %w", ref, instance.Name, err)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashData writes data to hash, in a stable order.
+func hashData(hash io.Writer, data map[string][]byte) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%d:", key, len(data[key]))
+		hash.Write(data[key])
+		fmt.Fprintf(hash, "\n")
+	}
+}
+
+// referencesChanged returns the hash of the objects referenced by instance,
+// and true if they changed since the hash was recorded in its status. The
+// first hash computed for instance isn't considered a change.
+func (r *Reconciler) referencesChanged(instance *gitopsv1alpha1.GitOpsConfig) (string, bool, error) {
+	hash, err := referencesHash(context.TODO(), r.uncachedReader(), instance)
+	if err != nil {
+		return "", false, err
+	}
+	return hash, instance.Status.ReferencesHash != "" && hash != instance.Status.ReferencesHash, nil
+}
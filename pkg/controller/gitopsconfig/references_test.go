@@ -0,0 +1,254 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReferenceIndexValues(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	want := []string{"Secret/gitops/pio", "ServiceAccount/gitops/mysvcaccount"}
+	if got := referenceIndexValues(gitops); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	gitops.Spec.ParameterSource.SecretRef = "params"
+	want = []string{"Secret/gitops/pio", "Secret/gitops/params", "ServiceAccount/gitops/mysvcaccount"}
+	if got := referenceIndexValues(gitops); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Only the job templates of the allowed namespaces are referenced
+	defer SetJobTemplateCatalogs(nil)
+	SetJobTemplateCatalogs([]string{"catalog"})
+	gitops.Spec.JobTemplateRef = &gitopsv1alpha1.JobTemplateReference{Name: "templates", Namespace: "catalog"}
+	want = []string{"Secret/gitops/pio", "Secret/gitops/params", "ServiceAccount/gitops/mysvcaccount", "ConfigMap/catalog/templates"}
+	if got := referenceIndexValues(gitops); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	gitops.Spec.JobTemplateRef.Namespace = "other"
+	want = want[:3]
+	if got := referenceIndexValues(gitops); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// TemplateProcessors are cluster-scoped
+	gitops.Spec.TemplateProcessorRef = "helm"
+	want = append(want, "TemplateProcessor//helm")
+	if got := referenceIndexValues(gitops); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestReferencingRequests(t *testing.T) {
+	triggers := []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}, {Type: "ReferenceChange"}}
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.Triggers = triggers
+	other := defaultGitOpsConfig()
+	other.Name = "other"
+	other.Spec.TemplateSource.SecretRef = ""
+	other.Spec.ParameterSource.SecretRef = ""
+	other.Spec.Triggers = triggers
+	elsewhere := defaultGitOpsConfig()
+	elsewhere.Namespace = "elsewhere"
+	elsewhere.Spec.Triggers = triggers
+	// Only the GitOpsConfigs with a ReferenceChange trigger are reconciled
+	untriggered := defaultGitOpsConfig()
+	untriggered.Name = "untriggered"
+	cl := &indexedClient{Client: fake.NewFakeClient(gitops, other, elsewhere, untriggered)}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pio", Namespace: namespace}}
+	got := referencingRequests(cl, "Secret")(handler.MapObject{Meta: secret, Object: secret})
+	want := []reconcile.Request{{NamespacedName: util.GetNN(gitops)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v for the secret, got %v", want, got)
+	}
+	account := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "mysvcaccount", Namespace: namespace}}
+	got = referencingRequests(cl, "ServiceAccount")(handler.MapObject{Meta: account, Object: account})
+	if len(got) != 2 {
+		t.Errorf("expected 2 requests for the service account, got %v", got)
+	}
+}
+
+func TestReferencesHash(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "pio", Namespace: namespace},
+		Data:       map[string][]byte{".gitconfig": []byte("[user]\n"), "id_rsa": []byte("key1")},
+	}
+	cl := fake.NewFakeClient(gitops)
+	hash := func() string {
+		t.Helper()
+		got, err := referencesHash(context.Background(), cl, gitops)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	missing := hash()
+	if err := cl.Create(context.Background(), secret); err != nil {
+		t.Fatal(err)
+	}
+	created := hash()
+	if created == missing {
+		t.Error("expected the hash to change when the secret is created")
+	}
+	if hash() != created {
+		t.Error("expected the hash to be stable")
+	}
+	secret.Data["id_rsa"] = []byte("key2")
+	if err := cl.Update(context.Background(), secret); err != nil {
+		t.Fatal(err)
+	}
+	rotated := hash()
+	if rotated == created {
+		t.Error("expected the hash to change when the secret is rotated")
+	}
+	secret.Labels = map[string]string{"team": "a"}
+	if err := cl.Update(context.Background(), secret); err != nil {
+		t.Fatal(err)
+	}
+	if hash() != rotated {
+		t.Error("expected the hash not to change when only the metadata of the secret changes")
+	}
+	account := &corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "mysvcaccount", Namespace: namespace},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+	}
+	if err := cl.Create(context.Background(), account); err != nil {
+		t.Fatal(err)
+	}
+	if hash() == rotated {
+		t.Error("expected the hash to change when the service account is created")
+	}
+	withAccount := hash()
+	gitops.UID = "other"
+	if hash() == withAccount {
+		t.Error("expected the hash to be salted with the UID of the GitOpsConfig")
+	}
+}
+
+// failingGetClient fails to get any object.
+type failingGetClient struct {
+	client.Client
+}
+
+func (c failingGetClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return apierrors.NewForbidden(corev1.Resource("secrets"), key.Name, nil)
+}
+
+func TestReconcileReferenceLookupError(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}, {Type: "ReferenceChange"}}
+	cl := fake.NewFakeClient(gitops)
+	r := &Reconciler{client: cl, apiReader: failingGetClient{cl}, scheme: scheme.Scheme}
+
+	// The Change trigger still starts a run
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: util.GetNN(gitops)})
+	if err != nil {
+		t.Fatalf("expected the referenced objects lookup error not to fail the reconcile, got %v", err)
+	}
+	jobs, err := findJobList(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Errorf("expected 1 job, got %d", len(jobs))
+	}
+}
+
+func TestReconcileReferenceChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		triggers []gitopsv1alpha1.GitOpsTrigger
+		wantJobs int
+		tracked  bool
+	}{
+		{"with trigger", []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}, {Type: "ReferenceChange"}}, 2, true},
+		{"without trigger", []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}, 1, false},
+	}
+	for _, tt := range tests {
+		gitops := defaultGitOpsConfig()
+		gitops.Spec.Triggers = tt.triggers
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "pio", Namespace: namespace},
+			Data:       map[string][]byte{"id_rsa": []byte("key1")},
+		}
+		cl := fake.NewFakeClient(gitops, secret)
+		r := &Reconciler{client: cl, scheme: scheme.Scheme}
+		reconcileStatus := func() gitopsv1alpha1.GitOpsConfigStatus {
+			t.Helper()
+			_, err := r.Reconcile(reconcile.Request{NamespacedName: util.GetNN(gitops)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			instance := &gitopsv1alpha1.GitOpsConfig{}
+			if err := cl.Get(context.Background(), util.GetNN(gitops), instance); err != nil {
+				t.Fatal(err)
+			}
+			return instance.Status
+		}
+
+		// The first run records the hash of the referenced objects, only with
+		// the trigger
+		first := reconcileStatus().ReferencesHash
+		if (first != "") != tt.tracked {
+			t.Fatalf("%s: expected the hash to be recorded %t, got %q", tt.name, tt.tracked, first)
+		}
+		jobs, err := findJobList(cl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		startTime := metav1.Now()
+		jobs[0].Status.Succeeded = 1
+		jobs[0].Status.StartTime = &startTime
+		if err := cl.Update(context.Background(), &jobs[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		secret.Data["id_rsa"] = []byte("key2")
+		if err := cl.Update(context.Background(), secret); err != nil {
+			t.Fatal(err)
+		}
+		if got := reconcileStatus().ReferencesHash; tt.tracked && (got == first || got == "") {
+			t.Errorf("%s: expected the new hash to be recorded, got %q", tt.name, got)
+		}
+		if jobs, _ = findJobList(cl); len(jobs) != tt.wantJobs {
+			t.Errorf("%s: expected %d jobs, got %d", tt.name, tt.wantJobs, len(jobs))
+		}
+		// The change is handled only once
+		reconcileStatus()
+		if jobs, _ = findJobList(cl); len(jobs) != tt.wantJobs {
+			t.Errorf("%s: expected %d jobs after another reconcile, got %d", tt.name, tt.wantJobs, len(jobs))
+		}
+	}
+}
@@ -18,108 +18,109 @@ package gitopsconfig
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
 	"github.com/KohlsTechnology/eunomia/pkg/util"
 	batchv1 "k8s.io/api/batch/v1"
-	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// statusUpdater updates Status of GitOpsConfig objects in the cluster when it
-// is used as a ResourceEventHandler on batchv1.Job objects. For more details,
-// see OnUpdate method. The OnAdd and OnDelete methods pass their argument to
-// OnUpdate.
-type statusUpdater struct {
-	client client.Client
-}
-
-var _ cache.ResourceEventHandler = &statusUpdater{}
-
-func (u *statusUpdater) OnAdd(newObj interface{})    { u.OnUpdate(nil, newObj) }
-func (u *statusUpdater) OnDelete(oldObj interface{}) { u.OnUpdate(oldObj, nil) }
-
-// OnUpdate finds a GitOpsConfig object owning newObj if it is a batchv1.Job
-// (or of oldObj if newObj is nil). Then, it updates the GitOpsConfig's Status
-// based on the Status of the Job.
-func (u *statusUpdater) OnUpdate(oldObj, newObj interface{}) {
-	// Extract Job objects from arguments
-	oldJob, ok := oldObj.(*batchv1.Job)
-	if !ok && oldObj != nil {
-		log.Error(nil, "non-Job object passed to statusUpdater", "oldObj", oldObj, "newObj", newObj)
-		return
-	}
-	newJob, ok := newObj.(*batchv1.Job)
-	if !ok && newObj != nil {
-		log.Error(nil, "non-Job object passed to statusUpdater", "oldObj", oldObj, "newObj", newObj)
-		return
+// statusResyncPeriod is how often the Status of each GitOpsConfig is
+// recomputed from its jobs, so that any missed Job events are eventually
+// taken into account.
+const statusResyncPeriod = 5 * time.Minute
+
+// syncStatus sets the Status of instance based on the newest of the Jobs it
+// owns (including the ones spawned by its CronJob). It only depends on the
+// current state of the cluster, so it can be safely called at any time; it's
+// called from the reconcile loop, which is triggered by changes to the owned
+// Jobs, and periodically.
+func syncStatus(ctx context.Context, kube client.Client, instance *gitopsv1alpha1.GitOpsConfig) error {
+	jobs, err := ownedJobs(ctx, kube, instance)
+	if err != nil {
+		return fmt.Errorf("unable to list jobs of GitOpsConfig %q: %w", instance.Name, err)
 	}
-
-	// In case of job deletion event, newJob is nil. However, we can still work
-	// with the oldJob, to make sure that any changes it contained were taken
-	// into account in Status.
-	if newJob == nil {
-		newJob = oldJob
+	job := newestJob(jobs)
+	if job == nil {
+		// No started Job found; cannot properly set GitOpsConfig.Status based on it
+		return nil
 	}
+	return updateStatus(ctx, kube, instance, func(status *gitopsv1alpha1.GitOpsConfigStatus) bool {
+		return applyJobStatus(status, job)
+	})
+}
 
-	if newJob.Status.StartTime == nil {
-		// Unstarted Job found; cannot properly set GitOpsConfig.Status based on it, ignoring
-		return
+// newestJob returns the job with the latest StartTime, or nil if none of the
+// jobs has started yet.
+func newestJob(jobs []batchv1.Job) *batchv1.Job {
+	var newest *batchv1.Job
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Status.StartTime == nil {
+			continue
+		}
+		if newest == nil || newest.Status.StartTime.Before(job.Status.StartTime) {
+			newest = job
+		}
 	}
+	return newest
+}
 
-	// Check if this is a Job that's owned by GitOpsConfig.
-	gitopsName := ""
-	if newJob.Labels != nil {
-		gitopsName = newJob.Labels[tagJobOwner]
+// applyJobStatus sets status based on the Status of job, and returns true if
+// anything was changed.
+func applyJobStatus(status *gitopsv1alpha1.GitOpsConfigStatus, job *batchv1.Job) bool {
+	if status.StartTime != nil && job.Status.StartTime.Before(status.StartTime) {
+		// Status was already set by a newer Job, which must have been deleted since then
+		return false
 	}
-	if gitopsName == "" {
-		// Got an event for a job not owned by GitOpsConfig - ignore it.
-		return
+	// A deferred run is still pending, and a rejected run stays rejected,
+	// until a newer Job starts.
+	if (isPending(status.State) || status.State == stateRejected) && status.StartTime != nil && !job.Status.StartTime.After(status.StartTime.Time) {
+		return false
 	}
 
-	// TODO: This function currently operates on changes, i.e. it's
-	// "edge-based". It would be better to use a "level-based" approach, i.e.:
-	// 1. query all jobs belonging to the same GitOpsConfig as newJob, and find the newest one among them
-	// 2. set status of GitOpsConfig based on status of the newest Job
-	// 3. additionally, run this procedure periodically for all GitOpsConfigs,
-	//    to ensure any missed changes are eventually caught and reflected in
-	//    GitOpsConfig.Status.
-
-	// Calculate status
-	status := gitopsv1alpha1.GitOpsConfigStatus{
-		StartTime:      newJob.Status.StartTime,
-		CompletionTime: newJob.Status.CompletionTime,
-	}
+	state := ""
 	switch {
-	case newJob.Status.Active > 0:
-		status.State = "InProgress"
-	case newJob.Status.Succeeded == 1:
-		status.State = "Success"
-	case newJob.Status.Succeeded == 0 && newJob.Status.Failed > 0:
-		status.State = "Failure"
-	}
-
-	// Update status
-	gitops := &gitopsv1alpha1.GitOpsConfig{}
-	err := u.client.Get(context.TODO(), util.NN{Name: gitopsName, Namespace: newJob.GetNamespace()}, gitops)
-	if err != nil {
-		log.Error(err, "cannot update GitOpsConfig")
-		return
+	case job.Status.Active > 0:
+		state = "InProgress"
+	case job.Status.Succeeded == 1:
+		state = "Success"
+	case job.Status.Succeeded == 0 && job.Status.Failed > 0:
+		state = "Failure"
 	}
-	// NOTE: OnUpdate calls may come reordered. We must try to ensure that some
-	// past Job won't accidentally overwrite a Status set based on a newer Job.
-	// This is expected to work correctly when there's at most one Job per
-	// GitOpsConfig running at a time (see #179).
-	if gitops.Status.StartTime != nil && status.StartTime.Before(gitops.Status.StartTime) {
-		log.Info("Status is already set, with newer StartTime - skipping; reordered events?", "GitOpsConfig", gitops.Name)
-		return
-	}
-	// TODO: don't update if status didn't change
-	gitops.Status = status
-	err = u.client.Status().Update(context.TODO(), gitops)
-	if err != nil {
-		// FIXME: find a way to retry this, starting from Get above, in case when errors.IsConflict(err)
-		log.Error(err, "Failed to update status", "GitOpsConfig", gitops.Name, "job", newJob.Name)
-		return
+	if status.State == state && status.Message == "" &&
+		status.StartTime.Equal(job.Status.StartTime) &&
+		status.CompletionTime.Equal(job.Status.CompletionTime) {
+		return false
 	}
+	status.State = state
+	status.Message = ""
+	status.StartTime = job.Status.StartTime
+	status.CompletionTime = job.Status.CompletionTime
+	return true
+}
+
+// updateStatus reads a fresh copy of instance from the cluster, applies mutate
+// to its Status, and writes it back if mutate returns true, retrying in case
+// of conflicts. On success, instance.Status is updated too.
+func updateStatus(ctx context.Context, kube client.Client, instance *gitopsv1alpha1.GitOpsConfig, mutate func(*gitopsv1alpha1.GitOpsConfigStatus) bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		fresh := &gitopsv1alpha1.GitOpsConfig{}
+		err := kube.Get(ctx, util.GetNN(instance), fresh)
+		if err != nil {
+			return err
+		}
+		if mutate(&fresh.Status) {
+			err = kube.Status().Update(ctx, fresh)
+			if err != nil {
+				return err
+			}
+		}
+		instance.Status = fresh.Status
+		recordState(instance)
+		return nil
+	})
 }
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	//nolint:staticcheck
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func ownedJob(name string, start time.Time, status batchv1.JobStatus) *batchv1.Job {
+	status.StartTime = &metav1.Time{Time: start}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{tagJobOwner: "gitops-operator"},
+		},
+		Status: status,
+	}
+}
+
+func TestApplyJobStatus(t *testing.T) {
+	start := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+	earlier := &metav1.Time{Time: start.Add(-time.Hour)}
+	later := &metav1.Time{Time: start.Add(time.Hour)}
+	job := ownedJob("job", start, batchv1.JobStatus{Failed: 1})
+
+	tests := []struct {
+		comment   string
+		status    gitopsv1alpha1.GitOpsConfigStatus
+		wantState string
+		changed   bool
+	}{
+		{"empty status", gitopsv1alpha1.GitOpsConfigStatus{}, "Failure", true},
+		{"older job", gitopsv1alpha1.GitOpsConfigStatus{State: "Success", StartTime: earlier}, "Failure", true},
+		{"newer job", gitopsv1alpha1.GitOpsConfigStatus{State: "Success", StartTime: later}, "Success", false},
+		{"unchanged", gitopsv1alpha1.GitOpsConfigStatus{State: "Failure", StartTime: job.Status.StartTime}, "Failure", false},
+		{"blocked after job", gitopsv1alpha1.GitOpsConfigStatus{State: stateBlocked, StartTime: job.Status.StartTime}, stateBlocked, false},
+		{"queued before job", gitopsv1alpha1.GitOpsConfigStatus{State: stateQueued, StartTime: earlier}, "Failure", true},
+	}
+	for _, tt := range tests {
+		status := tt.status
+		changed := applyJobStatus(&status, job)
+		if changed != tt.changed || status.State != tt.wantState {
+			t.Errorf("%s: expected (%q, %v), got (%q, %v)", tt.comment, tt.wantState, tt.changed, status.State, changed)
+		}
+	}
+}
+
+func TestReconcileStatusFromNewestJob(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	// Status was never updated, e.g. because Job events were missed while the operator was down
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	older := ownedJob("older", start, batchv1.JobStatus{Failed: 1})
+	newer := ownedJob("newer", start.Add(time.Minute), batchv1.JobStatus{Succeeded: 1})
+
+	cl := fake.NewFakeClient(gitops, newer, older)
+	r := &Reconciler{client: cl, scheme: scheme.Scheme}
+
+	result, err := r.Reconcile(reconcile.Request{
+		NamespacedName: util.GetNN(gitops),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter == 0 || result.RequeueAfter > statusResyncPeriod {
+		t.Errorf("expected periodic status resync, got: %+v", result)
+	}
+
+	crd := &gitopsv1alpha1.GitOpsConfig{}
+	err = cl.Get(context.Background(), util.GetNN(gitops), crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crd.Status.State != "Success" {
+		t.Errorf("expected State %q, got %q", "Success", crd.Status.State)
+	}
+	if !crd.Status.StartTime.Equal(newer.Status.StartTime) {
+		t.Errorf("expected StartTime %v, got %v", newer.Status.StartTime, crd.Status.StartTime)
+	}
+}
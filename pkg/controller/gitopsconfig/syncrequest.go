@@ -0,0 +1,91 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// SyncRequestedAnnotation requests a run of a GitOpsConfig each time it's set
+// to a new value, e.g. a timestamp:
+//
+//	kubectl annotate gitopsconfig app eunomia.kohls.io/sync-requested="$(date +%s)" --overwrite
+//
+// The handled value is recorded in status.lastHandledSyncRequest once the run
+// is started.
+const SyncRequestedAnnotation = "eunomia.kohls.io/sync-requested"
+
+// syncRequested returns the value of the sync-requested annotation of
+// instance if no run was started for it yet, or "" otherwise.
+func syncRequested(instance *gitopsv1alpha1.GitOpsConfig) string {
+	value := instance.GetAnnotations()[SyncRequestedAnnotation]
+	if value == instance.Status.LastHandledSyncRequest {
+		return ""
+	}
+	return value
+}
+
+// syncRequestChanged returns true if the sync-requested annotation was set to
+// a new value between oldMeta and newMeta.
+func syncRequestChanged(oldMeta, newMeta metav1.Object) bool {
+	value := newMeta.GetAnnotations()[SyncRequestedAnnotation]
+	return value != "" && value != oldMeta.GetAnnotations()[SyncRequestedAnnotation]
+}
+
+// RequestRun requests a run of instance by setting its sync-requested
+// annotation, so that the run is started as soon as possible: after the
+// running Job, or once it's no longer deferred. If revision isn't empty, it's
+// recorded as the pending revision of the templateSource, and of the
+// parameterSource if it's in the same repository, so that the run deploys it
+// instead of their ref.
+func (r *Reconciler) RequestRun(instance *gitopsv1alpha1.GitOpsConfig, revision string, now time.Time) error {
+	if revision != "" {
+		err := r.updateStatus(instance, func(status *gitopsv1alpha1.GitOpsConfigStatus) {
+			status.PendingTemplateRevision = revision
+			if instance.Spec.ParameterSource.URI == instance.Spec.TemplateSource.URI {
+				status.PendingParameterRevision = revision
+			}
+		})
+		if err != nil {
+			log.Error(err, "unable to record the requested revision", "instance", instance.Name, "revision", revision)
+			return fmt.Errorf("unable to record revision %q requested for GitOpsConfig %q: %w", revision, instance.Name, err)
+		}
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current := &gitopsv1alpha1.GitOpsConfig{}
+		if err := r.client.Get(context.TODO(), util.GetNN(instance), current); err != nil {
+			return err
+		}
+		if current.Annotations == nil {
+			current.Annotations = map[string]string{}
+		}
+		current.Annotations[SyncRequestedAnnotation] = now.UTC().Format(time.RFC3339Nano)
+		return r.client.Update(context.TODO(), current)
+	})
+	if err != nil {
+		log.Error(err, "unable to request a run", "instance", instance.Name)
+		return fmt.Errorf("unable to request a run of GitOpsConfig %q: %w", instance.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// templateProcessorContainer is the name of the container running the template
+// processor in the jobs created from the default templates.
+const templateProcessorContainer = "template-processor"
+
+// templateProcessor returns the TemplateProcessor referenced by instance, or
+// nil if it references none.
+func (r *Reconciler) templateProcessor(instance *gitopsv1alpha1.GitOpsConfig) (*gitopsv1alpha1.TemplateProcessor, error) {
+	name := instance.Spec.TemplateProcessorRef
+	if name == "" {
+		return nil, nil
+	}
+	processor := &gitopsv1alpha1.TemplateProcessor{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name}, processor)
+	if err != nil {
+		log.Error(err, "unable to get the template processor", "instance", instance.Name, "templateProcessor", name)
+		return nil, fmt.Errorf("unable to get TemplateProcessor %q of GitOpsConfig %q: %w", name, instance.Name, err)
+	}
+	return processor, nil
+}
+
+// applyTemplateProcessor sets the image and default arguments of the
+// TemplateProcessor referenced by instance in its spec, and returns the
+// environment variables required by the template processor. It returns an
+// error if the template processor doesn't support the resourceHandlingMode of
+// instance.
+func (r *Reconciler) applyTemplateProcessor(instance *gitopsv1alpha1.GitOpsConfig) ([]corev1.EnvVar, error) {
+	processor, err := r.templateProcessor(instance)
+	if err != nil || processor == nil {
+		return nil, err
+	}
+	if !supportsMode(processor, instance.Spec.ResourceHandlingMode) {
+		return nil, fmt.Errorf("TemplateProcessor %q of GitOpsConfig %q doesn't support the resourceHandlingMode %q", processor.Name, instance.Name, instance.Spec.ResourceHandlingMode)
+	}
+	instance.Spec.TemplateProcessorImage = processor.Spec.Image
+	if instance.Spec.TemplateProcessorArgs == "" {
+		instance.Spec.TemplateProcessorArgs = processor.Spec.Args
+	}
+	return processor.Spec.Env, nil
+}
+
+// supportsMode returns true if processor supports the resourceHandlingMode
+// mode.
+func supportsMode(processor *gitopsv1alpha1.TemplateProcessor, mode string) bool {
+	if len(processor.Spec.SupportedModes) == 0 {
+		return true
+	}
+	for _, supported := range processor.Spec.SupportedModes {
+		if supported == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// addProcessorEnv adds env to the template processor container of a pod
+// spec, unless the container already sets the variables.
+func addProcessorEnv(spec *corev1.PodSpec, env []corev1.EnvVar) {
+	if len(env) == 0 {
+		return
+	}
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		// Custom templates may name the container differently, when it's the only one
+		if container.Name != templateProcessorContainer && len(spec.Containers) > 1 {
+			continue
+		}
+		set := map[string]bool{}
+		for _, v := range container.Env {
+			set[v.Name] = true
+		}
+		for _, v := range env {
+			if !set[v.Name] {
+				container.Env = append(container.Env, v)
+			}
+		}
+	}
+}
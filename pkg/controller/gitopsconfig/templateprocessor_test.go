@@ -0,0 +1,115 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func helmProcessor() *gitopsv1alpha1.TemplateProcessor {
+	return &gitopsv1alpha1.TemplateProcessor{
+		ObjectMeta: metav1.ObjectMeta{Name: "helm"},
+		Spec: gitopsv1alpha1.TemplateProcessorSpec{
+			Image:          "quay.io/kohlstechnology/eunomia-helm:v0.2.0",
+			Args:           "--debug",
+			SupportedModes: []string{"Apply", "Delete"},
+			Env:            []corev1.EnvVar{{Name: "HELM_PLUGINS", Value: "/plugins"}, {Name: "HOME", Value: "/home/processor"}},
+		},
+	}
+}
+
+func TestTemplateProcessorJob(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		mode      string
+		args      string
+		action    string
+		wantImage string
+		wantArgs  string
+		wantErr   bool
+	}{
+		{"no processor", "", "Apply", "", "create", "myimage", "", false},
+		{"processor", "helm", "Apply", "", "create", "quay.io/kohlstechnology/eunomia-helm:v0.2.0", "--debug", false},
+		{"own args", "helm", "Apply", "--strict", "create", "quay.io/kohlstechnology/eunomia-helm:v0.2.0", "--strict", false},
+		{"unsupported mode", "helm", "Patch", "", "create", "", "", true},
+		{"missing processor", "jinja", "Apply", "", "create", "", "", true},
+		{"missing processor on deletion", "jinja", "Apply", "", "delete", "myimage", "", false},
+	}
+	for _, tt := range tests {
+		gitops := defaultGitOpsConfig()
+		gitops.Spec.TemplateProcessorRef = tt.ref
+		gitops.Spec.ResourceHandlingMode = tt.mode
+		gitops.Spec.TemplateProcessorArgs = tt.args
+		r := &Reconciler{client: fake.NewFakeClient(gitops, helmProcessor()), scheme: scheme.Scheme}
+
+		job, err := r.jobManifest(util.JobMergeData{Config: *gitops, Action: tt.action})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		container := job.Spec.Template.Spec.Containers[0]
+		env := map[string]string{}
+		for _, v := range container.Env {
+			env[v.Name] = v.Value
+		}
+		if container.Image != tt.wantImage {
+			t.Errorf("%s: expected image %q, got %q", tt.name, tt.wantImage, container.Image)
+		}
+		if env["TEMPLATE_PROCESSOR_ARGS"] != tt.wantArgs {
+			t.Errorf("%s: expected args %q, got %q", tt.name, tt.wantArgs, env["TEMPLATE_PROCESSOR_ARGS"])
+		}
+		if tt.ref == "helm" {
+			// The variables set by the job template aren't overridden
+			if env["HELM_PLUGINS"] != "/plugins" || env["HOME"] != "/tmp" {
+				t.Errorf("%s: unexpected env %v", tt.name, env)
+			}
+		}
+	}
+}
+
+func TestTemplateProcessorCronJob(t *testing.T) {
+	gitops := defaultGitOpsConfig()
+	gitops.Spec.TemplateProcessorRef = "helm"
+	r := &Reconciler{client: fake.NewFakeClient(gitops, helmProcessor()), scheme: scheme.Scheme}
+
+	cronJob, err := r.cronJobManifest(util.JobMergeData{Config: *gitops, Action: "create"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0]
+	if container.Image != "quay.io/kohlstechnology/eunomia-helm:v0.2.0" {
+		t.Errorf("expected the processor image, got %q", container.Image)
+	}
+	found := false
+	for _, v := range container.Env {
+		found = found || v.Name == "HELM_PLUGINS"
+	}
+	if !found {
+		t.Errorf("expected the processor env, got %v", container.Env)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cron parses standard 5-field cron expressions, as accepted by the
+// Kubernetes CronJob controller, and computes their activation times.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record if the day-of-month and day-of-week fields
+	// were unrestricted; this changes how the two fields are combined.
+	domStar, dowStar bool
+}
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	dom     = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Both 0 and 7 mean Sunday.
+	dow = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression in the "minute hour day-of-month month
+// day-of-week" format, or one of the @yearly, @monthly, @weekly, @daily and
+// @hourly descriptors.
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in cron expression %q, found %d", spec, len(fields))
+	}
+
+	s := &Schedule{}
+	var err error
+	if s.minute, _, err = parseField(fields[0], minutes); err != nil {
+		return nil, fmt.Errorf("invalid minute field in cron expression %q: %w", spec, err)
+	}
+	if s.hour, _, err = parseField(fields[1], hours); err != nil {
+		return nil, fmt.Errorf("invalid hour field in cron expression %q: %w", spec, err)
+	}
+	if s.dom, s.domStar, err = parseField(fields[2], dom); err != nil {
+		return nil, fmt.Errorf("invalid day-of-month field in cron expression %q: %w", spec, err)
+	}
+	if s.month, _, err = parseField(fields[3], months); err != nil {
+		return nil, fmt.Errorf("invalid month field in cron expression %q: %w", spec, err)
+	}
+	if s.dow, s.dowStar, err = parseField(fields[4], dow); err != nil {
+		return nil, fmt.Errorf("invalid day-of-week field in cron expression %q: %w", spec, err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 << 0
+	}
+	return s, nil
+}
+
+// parseField returns a bitset of values matched by a single comma-separated
+// cron field, and whether the field was a bare "*" (or "?").
+func parseField(field string, b bounds) (uint64, bool, error) {
+	if field == "*" || field == "?" {
+		return bitRange(b.min, b.max, 1), true, nil
+	}
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangeAndStep := strings.SplitN(part, "/", 2)
+		var (
+			lo, hi uint
+			step   uint = 1
+			err    error
+		)
+		switch r := rangeAndStep[0]; {
+		case r == "*":
+			lo, hi = b.min, b.max
+		case strings.Contains(r, "-"):
+			ends := strings.SplitN(r, "-", 2)
+			if lo, err = parseValue(ends[0], b); err != nil {
+				return 0, false, err
+			}
+			if hi, err = parseValue(ends[1], b); err != nil {
+				return 0, false, err
+			}
+		default:
+			if lo, err = parseValue(r, b); err != nil {
+				return 0, false, err
+			}
+			hi = lo
+			if len(rangeAndStep) == 2 {
+				// "N/step" means from N to the end of the range
+				hi = b.max
+			}
+		}
+		if len(rangeAndStep) == 2 {
+			n, err := strconv.ParseUint(rangeAndStep[1], 10, 8)
+			if err != nil || n == 0 {
+				return 0, false, fmt.Errorf("invalid step %q", rangeAndStep[1])
+			}
+			step = uint(n)
+		}
+		if lo > hi {
+			return 0, false, fmt.Errorf("invalid range %q: start is after end", part)
+		}
+		bits |= bitRange(lo, hi, step)
+	}
+	return bits, false, nil
+}
+
+func parseValue(s string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if uint(n) < b.min || uint(n) > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", n, b.min, b.max)
+	}
+	return uint(n), nil
+}
+
+func bitRange(lo, hi, step uint) uint64 {
+	var bits uint64
+	for i := lo; i <= hi; i += step {
+		bits |= 1 << i
+	}
+	return bits
+}
+
+// Next returns the earliest activation time of the schedule which is strictly
+// after t, in t's location. A zero time is returned if no activation can be
+// found within the next 5 years (e.g. for "0 0 30 2 *").
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+
+	for t.Year() <= yearLimit {
+		switch {
+		case 1<<uint(t.Month())&s.month == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case 1<<uint(t.Hour())&s.hour == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case 1<<uint(t.Minute())&s.minute == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches follows the cron convention: if both the day-of-month and
+// day-of-week fields are restricted, a day matching either one is accepted.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom != 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want string
+	}{
+		{"* * * * *", "2021-03-10T10:15:30Z", "2021-03-10T10:16:00Z"},
+		{"*/15 * * * *", "2021-03-10T10:15:00Z", "2021-03-10T10:30:00Z"},
+		{"0 * * * *", "2021-03-10T23:59:00Z", "2021-03-11T00:00:00Z"},
+		{"30 2 * * *", "2021-03-10T03:00:00Z", "2021-03-11T02:30:00Z"},
+		{"0 0 1 * *", "2021-12-15T00:00:00Z", "2022-01-01T00:00:00Z"},
+		{"0 9 * * mon-fri", "2021-03-12T10:00:00Z", "2021-03-15T09:00:00Z"},
+		{"0 0 * * 7", "2021-03-10T00:00:00Z", "2021-03-14T00:00:00Z"},
+		{"0 0 13 * 5", "2021-03-10T00:00:00Z", "2021-03-12T00:00:00Z"},
+		{"0 0 1 nov *", "2021-03-10T00:00:00Z", "2021-11-01T00:00:00Z"},
+		{"10-20/5 8 * * *", "2021-03-10T08:16:00Z", "2021-03-10T08:20:00Z"},
+		{"@weekly", "2021-03-10T00:00:00Z", "2021-03-14T00:00:00Z"},
+		{"0 0 29 2 *", "2021-03-10T00:00:00Z", "2024-02-29T00:00:00Z"},
+		{"0 0 30 2 *", "2021-03-10T00:00:00Z", "0001-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		got := s.Next(mustTime(t, tt.from))
+		if want := mustTime(t, tt.want); !got.Equal(want) {
+			t.Errorf("%q.Next(%s): expected %s, got %s", tt.spec, tt.from, want, got)
+		}
+	}
+}
+
+func TestNextInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("timezone database not available:", err)
+	}
+	s, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.Next(mustTime(t, "2021-03-10T12:00:00Z").In(loc))
+	if want := mustTime(t, "2021-03-10T15:00:00Z"); !got.Equal(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q): expected error, got nil", spec)
+		}
+	}
+}
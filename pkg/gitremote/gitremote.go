@@ -0,0 +1,290 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gitremote resolves the refs of remote Git repositories to commit
+// SHAs, like git ls-remote, with the credentials of the jobs cloning them.
+//
+// git runs in the operator's pod, so the configuration of the gitconfig
+// Secrets is never loaded: settings like core.sshCommand or a "!" credential
+// helper would run arbitrary commands with the operator's permissions. Only
+// the TLS and proxy settings of their .gitconfig, which can't run commands,
+// are read and given on the command line, along with their credentials,
+// known_hosts, CA certificate and SSH private keys, and only the HTTPS and
+// SSH protocols are allowed.
+package gitremote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// credentialsFile holds the credentials of the store credential helper.
+	credentialsFile = ".git-credentials"
+	// knownHostsFile holds the SSH host keys of the Git servers.
+	knownHostsFile = "known_hosts"
+	// caFile holds the CA certificate of the Git servers.
+	caFile = "ca.crt"
+	// gitconfigFile is the git configuration of the jobs; it's never loaded,
+	// only the settings of gitconfigKeys are read from it.
+	gitconfigFile = ".gitconfig"
+	// gitconfigDir is the directory of home holding the .gitconfig and the
+	// CA certificate it references. The names of the files of the Secrets
+	// can't contain a separator, so they don't clash with it.
+	gitconfigDir = "gitconfig"
+)
+
+// shaPattern matches full commit SHAs.
+var shaPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// privateKeyPattern matches the PEM and OpenSSH private keys.
+var privateKeyPattern = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----`)
+
+// allowedProtocols are the transport protocols git may use.
+var allowedProtocols = []string{"https", "ssh"}
+
+// gitconfigKeys are the settings of the .gitconfig of the Secrets which are
+// used; none of them runs a command.
+var gitconfigKeys = []string{"http.sslVerify", "http.sslCAInfo", "http.sslVersion", "http.proxy", "http.proxyAuthMethod"}
+
+// IsCommitSHA returns true if ref is a full commit SHA.
+func IsCommitSHA(ref string) bool {
+	return shaPattern.MatchString(ref)
+}
+
+// Source is a remote ref, with the configuration needed to access it.
+type Source struct {
+	URI string
+	Ref string
+
+	HTTPProxy  string
+	HTTPSProxy string
+	NOProxy    string
+
+	// Files are the files of the gitconfig Secret of the source, by name,
+	// e.g. ".gitconfig" and ".git-credentials". Only the settings of
+	// gitconfigKeys in .gitconfig, the credentials, known_hosts, ca.crt and
+	// the SSH private keys are used.
+	Files map[string][]byte
+}
+
+// Resolve returns the commit SHA which source.Ref points to. Branches take
+// precedence over tags; annotated tags are resolved to the commit they tag.
+// A Ref which is already a commit SHA is returned as is.
+func Resolve(ctx context.Context, source Source) (string, error) {
+	if IsCommitSHA(source.Ref) {
+		return source.Ref, nil
+	}
+	home, err := ioutil.TempDir("", "eunomia-git-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(home)
+	keys, err := writeFiles(home, source)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare the git credentials: %w", err)
+	}
+	settings, err := gitconfigSettings(ctx, home, source)
+	if err != nil {
+		return "", err
+	}
+
+	args := arguments(home, source, settings)
+	// the second pattern lists the commits tagged by annotated tags
+	args = append(args, "ls-remote", "--", source.URI, source.Ref, source.Ref+"^{}")
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = environment(home, keys, source)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git ls-remote %s %s failed: %w: %s", source.URI, source.Ref, err, strings.TrimSpace(stderr.String()))
+	}
+	sha, ok := findRef(out, source.Ref)
+	if !ok {
+		return "", fmt.Errorf("ref %q not found in %s", source.Ref, source.URI)
+	}
+	return sha, nil
+}
+
+// writeFiles writes the credentials, known_hosts, CA certificate and SSH
+// private keys of source to home, and returns the paths of the keys, sorted.
+// The other files, including .gitconfig, are ignored.
+func writeFiles(home string, source Source) ([]string, error) {
+	keys := []string{}
+	for name, content := range source.Files {
+		if name != filepath.Base(name) || strings.HasPrefix(name, "..") {
+			return nil, fmt.Errorf("invalid file name %q", name)
+		}
+		isKey := privateKeyPattern.Match(content)
+		if name != credentialsFile && name != knownHostsFile && name != caFile && !isKey {
+			continue
+		}
+		path := filepath.Join(home, name)
+		// ssh refuses private keys readable by others
+		if err := ioutil.WriteFile(path, content, 0600); err != nil {
+			return nil, err
+		}
+		if isKey {
+			keys = append(keys, path)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// gitconfigSettings returns the settings of gitconfigKeys in the .gitconfig
+// of source, as key=value. The file is read with git config --file, which
+// doesn't follow its includes, in the gitconfigDir of home. A CA certificate
+// referenced by http.sslCAInfo is used if it's a file of the Secret, like in
+// the jobs, which mount the Secret; the setting is ignored otherwise.
+func gitconfigSettings(ctx context.Context, home string, source Source) ([]string, error) {
+	content, ok := source.Files[gitconfigFile]
+	if !ok {
+		return nil, nil
+	}
+	dir := filepath.Join(home, gitconfigDir)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, gitconfigFile)
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return nil, err
+	}
+	settings := []string{}
+	for _, key := range gitconfigKeys {
+		args := []string{"config", "--file", path, "--get"}
+		if key == "http.sslVerify" {
+			// a key without value is true
+			args = append(args, "--bool")
+		}
+		cmd := exec.CommandContext(ctx, "git", append(args, key)...)
+		cmd.Env = []string{"HOME=" + home, "PATH=" + os.Getenv("PATH"), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL=/dev/null"}
+		out, err := cmd.Output()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			// the key isn't set
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from the .gitconfig: %w", key, err)
+		}
+		value := strings.TrimSuffix(string(out), "\n")
+		if key == "http.sslCAInfo" {
+			ca, ok := source.Files[filepath.Base(value)]
+			if !ok || filepath.Base(value) == gitconfigFile {
+				continue
+			}
+			value = filepath.Join(dir, filepath.Base(value))
+			if err := ioutil.WriteFile(value, ca, 0600); err != nil {
+				return nil, err
+			}
+		}
+		settings = append(settings, key+"="+value)
+	}
+	return settings, nil
+}
+
+// arguments returns the configuration of git, given on the command line:
+// the settings read from the .gitconfig of source are applied, the protocols
+// are restricted, and the credentials and CA certificate of source in home
+// are used.
+func arguments(home string, source Source, settings []string) []string {
+	args := []string{}
+	for _, setting := range settings {
+		args = append(args, "-c", setting)
+	}
+	args = append(args, "-c", "protocol.allow=never")
+	for _, protocol := range allowedProtocols {
+		args = append(args, "-c", "protocol."+protocol+".allow=always")
+	}
+	if _, ok := source.Files[credentialsFile]; ok {
+		args = append(args, "-c", "credential.helper=store --file="+filepath.Join(home, credentialsFile))
+	}
+	if _, ok := source.Files[caFile]; ok {
+		args = append(args, "-c", "http.sslCAInfo="+filepath.Join(home, caFile))
+	}
+	return args
+}
+
+// environment returns the environment of git: the system and global
+// configurations aren't loaded, HOME is set to home, ssh uses the keys and
+// the known_hosts in home, the proxies of source are set, and interactive
+// prompts are disabled. TLS certificates are verified unless http.sslVerify
+// is false in the .gitconfig; like in the jobs, SSH host keys aren't checked
+// without known_hosts.
+func environment(home string, keys []string, source Source) []string {
+	ssh := []string{"ssh", "-F", "/dev/null", "-o", "BatchMode=yes"}
+	for _, key := range keys {
+		ssh = append(ssh, "-o", "IdentitiesOnly=yes", "-i", quote(key))
+	}
+	if _, ok := source.Files[knownHostsFile]; ok {
+		ssh = append(ssh, "-o", "UserKnownHostsFile="+quote(filepath.Join(home, knownHostsFile)))
+	} else {
+		ssh = append(ssh, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+	}
+	env := []string{
+		"HOME=" + home,
+		"PATH=" + os.Getenv("PATH"),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_SSH_COMMAND=" + strings.Join(ssh, " "),
+	}
+	if source.HTTPProxy != "" {
+		env = append(env, "http_proxy="+source.HTTPProxy)
+	}
+	if source.HTTPSProxy != "" {
+		env = append(env, "https_proxy="+source.HTTPSProxy)
+	}
+	if source.NOProxy != "" {
+		env = append(env, "no_proxy="+source.NOProxy)
+	}
+	return env
+}
+
+// quote quotes s for the shell running GIT_SSH_COMMAND.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// findRef returns the SHA of ref in the output of git ls-remote.
+func findRef(out []byte, ref string) (string, bool) {
+	shas := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			shas[fields[1]] = fields[0]
+		}
+	}
+	for _, name := range []string{ref, "refs/heads/" + ref, "refs/tags/" + ref + "^{}", "refs/tags/" + ref} {
+		if sha, ok := shas[name]; ok {
+			return sha, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package giturl normalizes the URLs of Git repositories, so that the
+// different forms of the URL of a repository (https, ssh, scp-like) can be
+// compared with each other.
+package giturl
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Repo identifies a Git repository independently of the form of its URL.
+// Both fields are lower case, as the Git hosting services treat them case
+// insensitively.
+type Repo struct {
+	// Host is the host name of the Git server, without port, e.g. "github.com"
+	Host string
+	// Path is the path of the repository on the server, without ".git"
+	// suffix, e.g. "kohlstechnology/eunomia"
+	Path string
+}
+
+// String returns the canonical form of the repository, e.g.
+// "github.com/kohlstechnology/eunomia".
+func (r Repo) String() string {
+	return r.Host + "/" + r.Path
+}
+
+// Parse normalizes the Git URL rawURL. The supported forms are URLs with a
+// scheme, like "https://github.com/org/repo.git" and
+// "ssh://git@github.com:22/org/repo.git", and scp-like URLs, like
+// "git@github.com:org/repo.git".
+func Parse(rawURL string) (Repo, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	var host, path string
+	if strings.Contains(rawURL, "://") {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return Repo{}, fmt.Errorf("invalid Git URL %q: %w", rawURL, err)
+		}
+		host, path = u.Hostname(), u.Path
+	} else {
+		// scp-like syntax, [user@]host:path; the colon must come before any slash
+		colon := strings.Index(rawURL, ":")
+		if colon < 0 || strings.Contains(rawURL[:colon], "/") {
+			return Repo{}, fmt.Errorf("unsupported Git URL %q", rawURL)
+		}
+		host, path = rawURL[:colon], rawURL[colon+1:]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+	}
+
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	path = strings.Trim(path, "/")
+	if host == "" || path == "" {
+		return Repo{}, fmt.Errorf("no host or repository path in Git URL %q", rawURL)
+	}
+	return Repo{Host: strings.ToLower(host), Path: strings.ToLower(path)}, nil
+}
+
+// Match returns true if uri points to the repository of a webhook event,
+// which is identified by its URLs (e.g. clone, ssh and html URLs) and its
+// full name (e.g. "org/repo"). The host and path must match one of the event
+// URLs exactly; the full name is only used for events without URLs.
+func Match(uri, fullName string, eventURLs []string) bool {
+	repo, err := Parse(uri)
+	if err != nil {
+		return false
+	}
+	parsed := false
+	for _, eventURL := range eventURLs {
+		eventRepo, err := Parse(eventURL)
+		if err != nil {
+			continue
+		}
+		parsed = true
+		if eventRepo == repo {
+			return true
+		}
+	}
+	if parsed {
+		return false
+	}
+	fullName = strings.ToLower(strings.Trim(fullName, "/"))
+	return fullName != "" && repo.Path == fullName
+}
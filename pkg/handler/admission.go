@@ -0,0 +1,109 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/imagepolicy"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AdmissionPath is the path of the validating admission webhook enforcing
+// the image policy on GitOpsConfigs and TemplateProcessors.
+const AdmissionPath = "/validate"
+
+// maxAdmissionBodySize is the maximum size of the body of an admission review.
+const maxAdmissionBodySize = 3 * 1024 * 1024
+
+// AdmissionHandler manages the calls to POST /validate, the validating
+// admission webhook rejecting the GitOpsConfigs and TemplateProcessors whose
+// template processor image isn't allowed by the operator's image policy. The
+// jobs are checked again when they're created, as their templates may add
+// other images.
+func AdmissionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		log.Info("admission handler only accepts the POST method", "sent_method", r.Method)
+		w.WriteHeader(405)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxAdmissionBodySize))
+	if err != nil {
+		log.Info("unable to read admission review", "error", err.Error())
+		http.Error(w, "unable to read request body", 400)
+		return
+	}
+	review := admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		log.Info("invalid admission review")
+		http.Error(w, "request body is not a valid admission review", 400)
+		return
+	}
+
+	response := &admissionv1beta1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	if err := admit(review.Request); err != nil {
+		log.Info("admission denied by image policy", "kind", review.Request.Kind.Kind, "namespace", review.Request.Namespace, "name", review.Request.Name, "reason", err.Error())
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonForbidden,
+			Code:    403,
+			Message: err.Error(),
+		}
+	}
+	review.Request = nil
+	review.Response = response
+	writeJSON(w, 200, review)
+}
+
+// admit returns an error explaining why the object of request isn't allowed
+// by the image policy, or nil if it's allowed.
+func admit(request *admissionv1beta1.AdmissionRequest) error {
+	if request.Operation == admissionv1beta1.Delete {
+		return nil
+	}
+	switch request.Kind.Kind {
+	case "GitOpsConfig":
+		instance := gitopsv1alpha1.GitOpsConfig{}
+		if err := json.Unmarshal(request.Object.Raw, &instance); err != nil {
+			return fmt.Errorf("unable to decode GitOpsConfig: %w", err)
+		}
+		// The image of a referenced TemplateProcessor is checked when it's
+		// admitted, and without an image the job template must provide one,
+		// which is checked when the job is created.
+		if instance.Spec.TemplateProcessorRef != "" || instance.Spec.TemplateProcessorImage == "" {
+			return nil
+		}
+		if err := imagepolicy.Check(instance.Spec.TemplateProcessorImage); err != nil {
+			return fmt.Errorf("templateProcessorImage rejected by image policy: %w", err)
+		}
+	case "TemplateProcessor":
+		processor := gitopsv1alpha1.TemplateProcessor{}
+		if err := json.Unmarshal(request.Object.Raw, &processor); err != nil {
+			return fmt.Errorf("unable to decode TemplateProcessor: %w", err)
+		}
+		if err := imagepolicy.Check(processor.Spec.Image); err != nil {
+			return fmt.Errorf("image rejected by image policy: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KohlsTechnology/eunomia/pkg/imagepolicy"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+)
+
+func admissionReview(kind, operation, object string) string {
+	return `{
+		"apiVersion": "admission.k8s.io/v1beta1",
+		"kind": "AdmissionReview",
+		"request": {
+			"uid": "1234",
+			"kind": {"group": "eunomia.kohls.io", "version": "v1alpha1", "kind": "` + kind + `"},
+			"operation": "` + operation + `",
+			"object": ` + object + `
+		}
+	}`
+}
+
+func TestAdmissionHandler(t *testing.T) {
+	imagepolicy.SetGlobalPolicy(&imagepolicy.Policy{AllowedRepositories: []string{"quay.io/kohlstechnology"}})
+	defer imagepolicy.SetGlobalPolicy(nil)
+
+	tests := []struct {
+		comment     string
+		method      string
+		body        string
+		wantStatus  int
+		wantAllowed bool
+	}{
+		{"allowed config", "POST", admissionReview("GitOpsConfig", "CREATE",
+			`{"spec": {"templateProcessorImage": "quay.io/kohlstechnology/eunomia-helm:v0.2.0"}}`), 200, true},
+		{"denied config", "POST", admissionReview("GitOpsConfig", "UPDATE",
+			`{"spec": {"templateProcessorImage": "docker.io/evil/processor:latest"}}`), 200, false},
+		{"config with processor ref", "POST", admissionReview("GitOpsConfig", "CREATE",
+			`{"spec": {"templateProcessorImage": "docker.io/evil/processor:latest", "templateProcessorRef": "helm"}}`), 200, true},
+		{"allowed processor", "POST", admissionReview("TemplateProcessor", "CREATE",
+			`{"spec": {"image": "quay.io/kohlstechnology/eunomia-jinja:v0.2.0"}}`), 200, true},
+		{"denied processor", "POST", admissionReview("TemplateProcessor", "CREATE",
+			`{"spec": {"image": "alpine"}}`), 200, false},
+		{"deletion", "POST", admissionReview("TemplateProcessor", "DELETE", `null`), 200, true},
+		{"invalid review", "POST", `{"kind": "AdmissionReview"}`, 400, false},
+		{"wrong method", "GET", "", 405, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, AdmissionPath, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+
+		AdmissionHandler(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.comment, tt.wantStatus, w.Code)
+			continue
+		}
+		if tt.wantStatus != 200 {
+			continue
+		}
+		review := admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(w.Body.Bytes(), &review); err != nil || review.Response == nil {
+			t.Errorf("%s: invalid response %s", tt.comment, w.Body.String())
+			continue
+		}
+		if review.Response.UID != "1234" {
+			t.Errorf("%s: expected uid of the request, got %q", tt.comment, review.Response.UID)
+		}
+		if review.Response.Allowed != tt.wantAllowed {
+			t.Errorf("%s: expected allowed %v, got %v", tt.comment, tt.wantAllowed, review.Response.Allowed)
+		}
+		if !tt.wantAllowed && !strings.Contains(review.Response.Result.Message, "not from an allowed repository") {
+			t.Errorf("%s: unexpected message %q", tt.comment, review.Response.Result.Message)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// bitbucketEventHeader is the Bitbucket Server header key used to pass the event type.
+	bitbucketEventHeader = "X-Event-Key"
+	// bitbucketSignatureHeader is the Bitbucket Server header key used to pass the HMAC signature.
+	bitbucketSignatureHeader = "X-Hub-Signature"
+
+	bitbucketRefsChanged = "repo:refs_changed"
+)
+
+// bitbucketRefsChangedEvent contains the fields of Bitbucket Server
+// repo:refs_changed event payloads that are needed to find the matching
+// GitOpsConfigs.
+// See: https://confluence.atlassian.com/bitbucketserver/event-payload-938025882.html#Eventpayload-Push
+type bitbucketRefsChangedEvent struct {
+	EventKey   string `json:"eventKey"`
+	Repository struct {
+		Slug    string `json:"slug"`
+		Project struct {
+			Key string `json:"key"`
+		} `json:"project"`
+		Links struct {
+			// Clone contains the http and ssh clone URLs
+			Clone []struct {
+				Href string `json:"href"`
+			} `json:"clone"`
+		} `json:"links"`
+	} `json:"repository"`
+	Changes []struct {
+		Ref struct {
+			// ID is e.g. "refs/heads/master"
+			ID string `json:"id"`
+		} `json:"ref"`
+		// Type is one of ADD, UPDATE or DELETE
+		Type string `json:"type"`
+	} `json:"changes"`
+}
+
+// bitbucketServerProvider handles Bitbucket Server repo:refs_changed events.
+type bitbucketServerProvider struct{}
+
+var _ provider = bitbucketServerProvider{}
+
+func (bitbucketServerProvider) name() string { return "Bitbucket Server" }
+
+func (bitbucketServerProvider) deliveryID(r *http.Request) string {
+	return r.Header.Get("X-Request-Id")
+}
+
+func (bitbucketServerProvider) detect(r *http.Request) bool {
+	// Bitbucket Cloud uses the same header, but its events (e.g. "repo:push")
+	// are different, so they're ignored by parsePush.
+	return r.Header.Get(bitbucketEventHeader) != ""
+}
+
+func (bitbucketServerProvider) parsePush(r *http.Request, payload []byte) (*pushEvent, error) {
+	if r.Header.Get(bitbucketEventHeader) != bitbucketRefsChanged {
+		return nil, nil
+	}
+	event := &bitbucketRefsChangedEvent{}
+	err := json.Unmarshal(payload, event)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal Bitbucket Server refs changed event: %w", err)
+	}
+	push := &pushEvent{
+		// The project key is upper case, while clone URLs use it in lower case,
+		// e.g. https://bitbucket.example.com/scm/prj/eunomia.git
+		repoFullName: strings.ToLower(event.Repository.Project.Key) + "/" + event.Repository.Slug,
+	}
+	for _, link := range event.Repository.Links.Clone {
+		push.repoURLs = append(push.repoURLs, link.Href)
+	}
+	push.repoURLs = nonEmpty(push.repoURLs...)
+	for _, change := range event.Changes {
+		if change.Type == "DELETE" {
+			continue
+		}
+		push.refs = append(push.refs, change.Ref.ID)
+	}
+	return push, nil
+}
+
+// validate checks the "sha256=<hex>" HMAC signature of the payload, which
+// Bitbucket Server sends when the webhook has a secret.
+func (bitbucketServerProvider) validate(r *http.Request, payload []byte, secret string) error {
+	signature := r.Header.Get(bitbucketSignatureHeader)
+	if !strings.HasPrefix(signature, "sha256=") {
+		return fmt.Errorf("missing or unsupported %s header %q", bitbucketSignatureHeader, signature)
+	}
+	return validateHexHMAC(strings.TrimPrefix(signature, "sha256="), payload, secret)
+}
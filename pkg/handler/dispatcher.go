@@ -0,0 +1,182 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// maxRunRetries is the number of times the creation of a job requested
+	// by a webhook is retried before giving up.
+	maxRunRetries = 5
+	// runningJobRequeueDelay is how often a run requested by a webhook checks
+	// if the previous job of the GitOpsConfig is finished.
+	runningJobRequeueDelay = 10 * time.Second
+
+	// deliveryTTL is how long the IDs of the handled webhook deliveries are
+	// remembered, to ignore redeliveries.
+	deliveryTTL = time.Hour
+	// maxDeliveries limits the number of remembered delivery IDs.
+	maxDeliveries = 10000
+)
+
+// webhookReconciler is the part of gitopsconfig.Reconciler used to handle
+// webhook events.
+type webhookReconciler interface {
+	previewReconciler
+	Get(namespace, name string) (gitopsv1alpha1.GitOpsConfig, error)
+	HasRunningJob(instance *gitopsv1alpha1.GitOpsConfig) (bool, error)
+	CreateJob(jobtype string, instance *gitopsv1alpha1.GitOpsConfig) (reconcile.Result, error)
+}
+
+// Dispatcher handles the webhook calls, and starts the jobs of the matching
+// GitOpsConfigs asynchronously from a work queue. The runs requested within
+// the debounce delay are collapsed into one run per GitOpsConfig, and the
+// runs requested while a job of the GitOpsConfig is running are started when
+// it's finished.
+type Dispatcher struct {
+	reconciler webhookReconciler
+	queue      workqueue.RateLimitingInterface
+	debounce   time.Duration
+	deliveries *deliveryCache
+	// requireSecret makes the triggers without webhook secret ignore all the
+	// webhook events, as they can't be authenticated.
+	requireSecret bool
+}
+
+// NewDispatcher creates a Dispatcher, which must be added to the manager to
+// process its queue. If requireSecret is true, the GitOpsConfigs whose
+// Webhook or PullRequest trigger has no secret are never triggered by webhooks.
+func NewDispatcher(reconciler webhookReconciler, debounce time.Duration, requireSecret bool) *Dispatcher {
+	return &Dispatcher{
+		reconciler:    reconciler,
+		queue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "webhook"),
+		debounce:      debounce,
+		deliveries:    &deliveryCache{seen: map[string]time.Time{}},
+		requireSecret: requireSecret,
+	}
+}
+
+// Start processes the queue until stop is closed. It implements manager.Runnable.
+func (d *Dispatcher) Start(stop <-chan struct{}) error {
+	defer d.queue.ShutDown()
+	log.Info("Starting webhook dispatcher", "debounce", d.debounce.String())
+	go wait.Until(d.runWorker, time.Second, stop)
+	<-stop
+	log.Info("Stopping webhook dispatcher")
+	return nil
+}
+
+// enqueue requests a run of the GitOpsConfig with the passed key, after the
+// debounce delay.
+func (d *Dispatcher) enqueue(key types.NamespacedName) {
+	d.queue.AddAfter(key, d.debounce)
+}
+
+func (d *Dispatcher) runWorker() {
+	for d.processNextItem() {
+	}
+}
+
+func (d *Dispatcher) processNextItem() bool {
+	item, shutdown := d.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer d.queue.Done(item)
+
+	key := item.(types.NamespacedName)
+	err := d.run(key)
+	if err == nil {
+		d.queue.Forget(item)
+		return true
+	}
+	if d.queue.NumRequeues(item) < maxRunRetries {
+		log.Error(err, "Webhook unable to create job for instance, will retry", "instance", key.Name, "namespace", key.Namespace)
+		d.queue.AddRateLimited(item)
+		return true
+	}
+	log.Error(err, "Webhook unable to create job for instance, giving up", "instance", key.Name, "namespace", key.Namespace)
+	d.queue.Forget(item)
+	return true
+}
+
+// run starts a job for the GitOpsConfig with the passed key, or requeues it
+// if a job is already running.
+func (d *Dispatcher) run(key types.NamespacedName) error {
+	instance, err := d.reconciler.Get(key.Namespace, key.Name)
+	if isNotFound(err) {
+		log.Info("GitOpsConfig to run was deleted", "instance", key.Name, "namespace", key.Namespace)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	running, err := d.reconciler.HasRunningJob(&instance)
+	if err != nil {
+		return err
+	}
+	if running {
+		log.Info("Job is already running for this instance, postponing webhook run", "instance", key.Name, "namespace", key.Namespace)
+		d.queue.AddAfter(key, runningJobRequeueDelay)
+		return nil
+	}
+	log.Info("Webhook triggering job", "instance", key.Name, "namespace", key.Namespace)
+	_, err = d.reconciler.CreateJob("create", &instance)
+	if err != nil {
+		return fmt.Errorf("unable to create job for GitOpsConfig %q in namespace %q: %w", key.Name, key.Namespace, err)
+	}
+	return nil
+}
+
+// deliveryCache remembers the IDs of the recently handled webhook deliveries.
+type deliveryCache struct {
+	sync.Mutex
+	seen map[string]time.Time
+}
+
+// contains returns true if the delivery id was handled within deliveryTTL.
+func (c *deliveryCache) contains(id string, now time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+	handled, ok := c.seen[id]
+	return ok && now.Sub(handled) < deliveryTTL
+}
+
+// add remembers the delivery id, forgetting the expired ones if there are too
+// many.
+func (c *deliveryCache) add(id string, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.seen) >= maxDeliveries {
+		for seenID, handled := range c.seen {
+			if now.Sub(handled) >= deliveryTTL || len(c.seen) >= maxDeliveries {
+				delete(c.seen, seenID)
+			}
+		}
+	}
+	c.seen[id] = now
+}
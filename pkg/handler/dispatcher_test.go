@@ -0,0 +1,182 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type fakeWebhookReconciler struct {
+	fakePreviewReconciler
+	running   bool
+	createErr error
+	created   []string
+}
+
+func (f *fakeWebhookReconciler) Get(namespace, name string) (gitopsv1alpha1.GitOpsConfig, error) {
+	for _, instance := range f.list.Items {
+		if instance.Namespace == namespace && instance.Name == name {
+			return instance, nil
+		}
+	}
+	notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "gitopsconfigs"}, name)
+	return gitopsv1alpha1.GitOpsConfig{}, fmt.Errorf("wrapped: %w", notFound)
+}
+
+func (f *fakeWebhookReconciler) HasRunningJob(instance *gitopsv1alpha1.GitOpsConfig) (bool, error) {
+	return f.running, nil
+}
+
+func (f *fakeWebhookReconciler) CreateJob(jobtype string, instance *gitopsv1alpha1.GitOpsConfig) (reconcile.Result, error) {
+	if f.createErr != nil {
+		return reconcile.Result{}, f.createErr
+	}
+	f.created = append(f.created, instance.Name)
+	return reconcile.Result{}, nil
+}
+
+func webhookConfig(name, uri string, triggers ...gitopsv1alpha1.GitOpsTrigger) gitopsv1alpha1.GitOpsConfig {
+	git := gitopsv1alpha1.GitConfig{URI: uri, Ref: "master"}
+	return gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team"},
+		Spec:       gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: git, ParameterSource: git, Triggers: triggers},
+	}
+}
+
+func TestDispatcherWebhookHandler(t *testing.T) {
+	reconciler := &fakeWebhookReconciler{}
+	reconciler.list.Items = []gitopsv1alpha1.GitOpsConfig{
+		webhookConfig("app", "https://github.com/kohlstechnology/eunomia", gitopsv1alpha1.GitOpsTrigger{Type: "Webhook"}),
+		webhookConfig("periodic", "https://github.com/kohlstechnology/eunomia", gitopsv1alpha1.GitOpsTrigger{Type: "Periodic"}),
+		webhookConfig("other", "https://github.com/kohlstechnology/other", gitopsv1alpha1.GitOpsTrigger{Type: "Webhook"}),
+	}
+	d := NewDispatcher(reconciler, 50*time.Millisecond, false)
+	defer d.queue.ShutDown()
+
+	post := func(delivery, payload string) (int, webhookResponse) {
+		r := httptest.NewRequest("POST", "/webhook/", strings.NewReader(payload))
+		r.Header.Set("X-GitHub-Event", "push")
+		r.Header.Set("X-GitHub-Delivery", delivery)
+		w := httptest.NewRecorder()
+		d.WebhookHandler(w, r)
+		response := webhookResponse{}
+		if w.Code < 300 {
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+			}
+		}
+		return w.Code, response
+	}
+	payload := `{"ref": "refs/heads/master", "repository": {"full_name": "kohlstechnology/eunomia", "clone_url": "https://github.com/kohlstechnology/eunomia.git"}}`
+
+	code, response := post("delivery-1", payload)
+	if code != 202 || response.Event != "push" || !reflect.DeepEqual(response.Matched, []matchedConfig{{Namespace: "team", Name: "app"}}) {
+		t.Errorf("expected 202 with app matched, got %d %+v", code, response)
+	}
+	// A second push is collapsed into the same run
+	if code, _ = post("delivery-2", payload); code != 202 {
+		t.Errorf("expected 202, got %d", code)
+	}
+	// A redelivery is ignored
+	code, response = post("delivery-2", payload)
+	if code != 200 || !response.Duplicate || len(response.Matched) != 0 {
+		t.Errorf("expected redelivery to be ignored, got %d %+v", code, response)
+	}
+	if code, _ = post("delivery-3", `{"ref": "refs/heads/master", "repository": {"full_name": "kohlstechnology/unknown"}}`); code != 200 {
+		t.Errorf("expected 200 for push without matching configs, got %d", code)
+	}
+	if code, _ = post("delivery-4", `{"ref": `); code != 400 {
+		t.Errorf("expected 400 for invalid payload, got %d", code)
+	}
+
+	if !d.processNextItem() {
+		t.Fatal("expected queued run")
+	}
+	if !reflect.DeepEqual(reconciler.created, []string{"app"}) {
+		t.Errorf("expected a single job for app, got %v", reconciler.created)
+	}
+	if d.queue.Len() != 0 {
+		t.Errorf("expected empty queue, got %d items", d.queue.Len())
+	}
+	// Triggers without secret are ignored when secrets are required
+	d.requireSecret = true
+	code, response = post("delivery-5", payload)
+	if code != 200 || len(response.Matched) != 0 {
+		t.Errorf("expected trigger without secret to be ignored, got %d %+v", code, response)
+	}
+}
+
+func TestDispatcherRun(t *testing.T) {
+	key := types.NamespacedName{Namespace: "team", Name: "app"}
+	reconciler := &fakeWebhookReconciler{running: true}
+	reconciler.list.Items = []gitopsv1alpha1.GitOpsConfig{
+		webhookConfig("app", "https://github.com/kohlstechnology/eunomia", gitopsv1alpha1.GitOpsTrigger{Type: "Webhook"}),
+	}
+	d := NewDispatcher(reconciler, 0, false)
+	defer d.queue.ShutDown()
+
+	if err := d.run(key); err != nil || len(reconciler.created) != 0 {
+		t.Errorf("expected run to be postponed while a job is running, got %v, %v", err, reconciler.created)
+	}
+
+	reconciler.running = false
+	reconciler.createErr = errors.New("boom")
+	if err := d.run(key); !errors.Is(err, reconciler.createErr) {
+		t.Errorf("expected job creation error, got %v", err)
+	}
+
+	reconciler.createErr = nil
+	if err := d.run(key); err != nil || !reflect.DeepEqual(reconciler.created, []string{"app"}) {
+		t.Errorf("expected job to be created, got %v, %v", err, reconciler.created)
+	}
+
+	if err := d.run(types.NamespacedName{Namespace: "team", Name: "deleted"}); err != nil {
+		t.Errorf("expected deleted GitOpsConfig to be ignored, got %v", err)
+	}
+}
+
+func TestDeliveryCache(t *testing.T) {
+	c := &deliveryCache{seen: map[string]time.Time{}}
+	now := time.Now()
+	c.add("GitHub/1", now)
+	if !c.contains("GitHub/1", now.Add(time.Minute)) {
+		t.Error("expected recent delivery to be remembered")
+	}
+	if c.contains("GitHub/1", now.Add(deliveryTTL)) {
+		t.Error("expected expired delivery to be forgotten")
+	}
+	for i := 0; i < maxDeliveries+10; i++ {
+		c.add(fmt.Sprintf("GitHub/%d", i), now)
+	}
+	if len(c.seen) > maxDeliveries {
+		t.Errorf("expected at most %d deliveries, got %d", maxDeliveries, len(c.seen))
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// giteaEventHeader and gogsEventHeader are the Gitea and Gogs header keys used to pass the event type.
+	giteaEventHeader = "X-Gitea-Event"
+	gogsEventHeader  = "X-Gogs-Event"
+	// giteaSignatureHeader and gogsSignatureHeader are the Gitea and Gogs header keys used to pass the HMAC signature.
+	giteaSignatureHeader = "X-Gitea-Signature"
+	gogsSignatureHeader  = "X-Gogs-Signature"
+)
+
+// giteaPushEvent contains the fields of Gitea and Gogs push event payloads
+// that are needed to find the matching GitOpsConfigs.
+// See: https://docs.gitea.io/en-us/webhooks/
+type giteaPushEvent struct {
+	// Ref is e.g. "refs/heads/master"
+	Ref        string `json:"ref"`
+	Repository struct {
+		// FullName is e.g. "kohlstechnology/eunomia"
+		FullName string `json:"full_name"`
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+	Commits []commitFiles `json:"commits"`
+	// TotalCommits is the number of pushed commits, not sent by Gogs
+	TotalCommits int `json:"total_commits"`
+}
+
+// giteaProvider handles Gitea and Gogs push events.
+type giteaProvider struct{}
+
+var _ provider = giteaProvider{}
+
+func (giteaProvider) name() string { return "Gitea" }
+
+func (giteaProvider) deliveryID(r *http.Request) string {
+	if id := r.Header.Get("X-Gitea-Delivery"); id != "" {
+		return id
+	}
+	return r.Header.Get("X-Gogs-Delivery")
+}
+
+func (giteaProvider) detect(r *http.Request) bool {
+	return r.Header.Get(giteaEventHeader) != "" || r.Header.Get(gogsEventHeader) != ""
+}
+
+func (giteaProvider) parsePush(r *http.Request, payload []byte) (*pushEvent, error) {
+	eventType := r.Header.Get(giteaEventHeader)
+	if eventType == "" {
+		eventType = r.Header.Get(gogsEventHeader)
+	}
+	if eventType != "push" {
+		return nil, nil
+	}
+	event := &giteaPushEvent{}
+	err := json.Unmarshal(payload, event)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal Gitea push event: %w", err)
+	}
+	return &pushEvent{
+		repoFullName: event.Repository.FullName,
+		repoURLs:     nonEmpty(event.Repository.CloneURL, event.Repository.SSHURL, event.Repository.HTMLURL),
+		refs:         []string{event.Ref},
+		files:        changedFiles(event.Commits, event.TotalCommits),
+	}, nil
+}
+
+// validate checks the hex-encoded HMAC-SHA256 signature of the payload.
+func (giteaProvider) validate(r *http.Request, payload []byte, secret string) error {
+	signature := r.Header.Get(giteaSignatureHeader)
+	if signature == "" {
+		signature = r.Header.Get(gogsSignatureHeader)
+	}
+	return validateHexHMAC(signature, payload, secret)
+}
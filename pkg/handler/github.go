@@ -0,0 +1,119 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/google/go-github/github"
+)
+
+// githubProvider handles GitHub push and pull request events.
+type githubProvider struct{}
+
+var (
+	_ provider          = githubProvider{}
+	_ pullRequestParser = githubProvider{}
+)
+
+func (githubProvider) name() string { return "GitHub" }
+
+func (githubProvider) deliveryID(r *http.Request) string {
+	return r.Header.Get("X-GitHub-Delivery")
+}
+
+func (githubProvider) detect(r *http.Request) bool {
+	return github.WebHookType(r) != ""
+}
+
+func (githubProvider) parsePush(r *http.Request, payload []byte) (*pushEvent, error) {
+	webHookEvent, err := github.ParseWebHook(github.WebHookType(r), payload)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse GitHub %q event: %w", github.WebHookType(r), err)
+	}
+	e, ok := webHookEvent.(*github.PushEvent)
+	if !ok {
+		return nil, nil
+	}
+	repo := e.GetRepo()
+	return &pushEvent{
+		repoFullName: repo.GetFullName(),
+		repoURLs:     nonEmpty(repo.GetCloneURL(), repo.GetSSHURL(), repo.GetGitURL(), repo.GetHTMLURL()),
+		refs:         []string{e.GetRef()},
+		files:        githubChangedFiles(e),
+	}, nil
+}
+
+// githubMaxPushCommits is the maximum number of commits listed in a GitHub
+// push event.
+const githubMaxPushCommits = 20
+
+// githubChangedFiles returns the files changed by the commits of the push
+// event e, or nil if they are unknown. GitHub doesn't send the size of push
+// webhooks, so the commits are considered truncated when the maximum number of
+// commits is listed, or when their number differs from distinct_size.
+func githubChangedFiles(e *github.PushEvent) []string {
+	if len(e.Commits) >= githubMaxPushCommits || (e.DistinctSize != nil && e.GetDistinctSize() != len(e.Commits)) {
+		return nil
+	}
+	commits := make([]commitFiles, 0, len(e.Commits))
+	for _, c := range e.Commits {
+		commits = append(commits, commitFiles{Added: c.Added, Modified: c.Modified, Removed: c.Removed})
+	}
+	return changedFiles(commits, e.GetSize())
+}
+
+func (githubProvider) parsePullRequest(r *http.Request, payload []byte) (*pullRequestEvent, error) {
+	if github.WebHookType(r) != "pull_request" {
+		return nil, nil
+	}
+	webHookEvent, err := github.ParseWebHook(github.WebHookType(r), payload)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse GitHub %q event: %w", github.WebHookType(r), err)
+	}
+	e, ok := webHookEvent.(*github.PullRequestEvent)
+	if !ok {
+		return nil, nil
+	}
+	repo := e.GetRepo()
+	event := &pullRequestEvent{
+		repoFullName: repo.GetFullName(),
+		repoURLs:     nonEmpty(repo.GetCloneURL(), repo.GetSSHURL(), repo.GetGitURL(), repo.GetHTMLURL()),
+		baseRef:      e.GetPullRequest().GetBase().GetRef(),
+		number:       e.GetNumber(),
+		headSHA:      e.GetPullRequest().GetHead().GetSHA(),
+		fromFork:     e.GetPullRequest().GetHead().GetRepo().GetFullName() != repo.GetFullName(),
+	}
+	switch e.GetAction() {
+	case "opened", "reopened", "synchronize":
+	case "closed":
+		event.closed = true
+	default:
+		return nil, nil
+	}
+	return event, nil
+}
+
+func (githubProvider) validate(r *http.Request, payload []byte, secret string) error {
+	// The body was already read by the handler, so it must be restored for the validation
+	r.Body = ioutil.NopCloser(bytes.NewReader(payload))
+	_, err := github.ValidatePayload(r, []byte(secret))
+	return err
+}
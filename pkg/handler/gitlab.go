@@ -0,0 +1,115 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// gitlabEventHeader is the GitLab header key used to pass the event type.
+	gitlabEventHeader = "X-Gitlab-Event"
+	// gitlabTokenHeader is the GitLab header key used to pass the secret token.
+	gitlabTokenHeader = "X-Gitlab-Token"
+
+	gitlabPushHook    = "Push Hook"
+	gitlabTagPushHook = "Tag Push Hook"
+)
+
+// gitlabPushEvent contains the fields of GitLab push and tag push event
+// payloads that are needed to find the matching GitOpsConfigs.
+// See: https://docs.gitlab.com/ee/user/project/integrations/webhooks.html#push-events
+type gitlabPushEvent struct {
+	ObjectKind string `json:"object_kind"`
+	// Ref is e.g. "refs/heads/master" or "refs/tags/v1.0.0"
+	Ref     string `json:"ref"`
+	Project struct {
+		// PathWithNamespace is e.g. "kohlstechnology/eunomia"
+		PathWithNamespace string `json:"path_with_namespace"`
+		GitHTTPURL        string `json:"git_http_url"`
+		GitSSHURL         string `json:"git_ssh_url"`
+		WebURL            string `json:"web_url"`
+	} `json:"project"`
+	// Commits lists at most 20 of the TotalCommitsCount pushed commits
+	Commits           []commitFiles `json:"commits"`
+	TotalCommitsCount int           `json:"total_commits_count"`
+}
+
+// gitlabProvider handles GitLab push and tag push events.
+type gitlabProvider struct{}
+
+var _ provider = gitlabProvider{}
+
+func (gitlabProvider) name() string { return "GitLab" }
+
+func (gitlabProvider) deliveryID(r *http.Request) string {
+	return r.Header.Get("X-Gitlab-Event-UUID")
+}
+
+func (gitlabProvider) detect(r *http.Request) bool {
+	return r.Header.Get(gitlabEventHeader) != ""
+}
+
+func (gitlabProvider) parsePush(r *http.Request, payload []byte) (*pushEvent, error) {
+	eventType := r.Header.Get(gitlabEventHeader)
+	if eventType != gitlabPushHook && eventType != gitlabTagPushHook {
+		return nil, nil
+	}
+	event, err := parseGitLabPushEvent(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &pushEvent{
+		repoFullName: event.Project.PathWithNamespace,
+		repoURLs:     nonEmpty(event.Project.GitHTTPURL, event.Project.GitSSHURL, event.Project.WebURL),
+		refs:         []string{event.Ref},
+		files:        changedFiles(event.Commits, event.TotalCommitsCount),
+	}, nil
+}
+
+// validate checks that the X-Gitlab-Token header value matches the webhook
+// secret. Unlike GitHub, GitLab sends the secret token as is, instead of
+// signing the payload with it.
+func (gitlabProvider) validate(r *http.Request, payload []byte, secret string) error {
+	return validateGitLabToken(r.Header.Get(gitlabTokenHeader), secret)
+}
+
+func parseGitLabPushEvent(payload []byte) (*gitlabPushEvent, error) {
+	event := &gitlabPushEvent{}
+	err := json.Unmarshal(payload, event)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal GitLab push event: %w", err)
+	}
+	if event.ObjectKind != "push" && event.ObjectKind != "tag_push" {
+		return nil, fmt.Errorf("unexpected object_kind %q in GitLab push event", event.ObjectKind)
+	}
+	return event, nil
+}
+
+func validateGitLabToken(token, secret string) error {
+	if token == "" {
+		return errors.New("missing " + gitlabTokenHeader + " header")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return errors.New(gitlabTokenHeader + " header does not match the secret")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+func TestParseGitLabPushEvent(t *testing.T) {
+	tests := []struct {
+		comment string
+		payload string
+		repo    string
+		ref     string
+		wantErr bool
+	}{
+		{
+			comment: "push",
+			payload: `{"object_kind": "push", "ref": "refs/heads/master", "project": {"path_with_namespace": "kohlstechnology/eunomia"}}`,
+			repo:    "kohlstechnology/eunomia",
+			ref:     "refs/heads/master",
+		},
+		{
+			comment: "tag push",
+			payload: `{"object_kind": "tag_push", "ref": "refs/tags/0.1.4", "project": {"path_with_namespace": "group/subgroup/eunomia"}}`,
+			repo:    "group/subgroup/eunomia",
+			ref:     "refs/tags/0.1.4",
+		},
+		{
+			comment: "merge request",
+			payload: `{"object_kind": "merge_request"}`,
+			wantErr: true,
+		},
+		{
+			comment: "invalid JSON",
+			payload: `{"object_kind": `,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		event, err := parseGitLabPushEvent([]byte(tt.payload))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error, got nil", tt.comment)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.comment, err)
+			continue
+		}
+		if event.Project.PathWithNamespace != tt.repo || event.Ref != tt.ref {
+			t.Errorf("%q: expected %s@%s, got %s@%s", tt.comment, tt.repo, tt.ref, event.Project.PathWithNamespace, event.Ref)
+		}
+	}
+}
+
+func TestGitLabPushEventMatch(t *testing.T) {
+	r := httptest.NewRequest("POST", "/webhook", nil)
+	r.Header.Set("X-Gitlab-Event", "Push Hook")
+	event, err := gitlabProvider{}.parsePush(r, []byte(`{
+		"object_kind": "push",
+		"ref": "refs/heads/master",
+		"project": {
+			"path_with_namespace": "kohlstechnology/eunomia",
+			"git_http_url": "https://gitlab.com/kohlstechnology/eunomia.git",
+			"git_ssh_url": "git@gitlab.com:kohlstechnology/eunomia.git"
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uri, want := range map[string]bool{
+		"https://gitlab.com/kohlstechnology/eunomia.git":     true,
+		"git@gitlab.com:kohlstechnology/eunomia.git":         true,
+		"https://gitlab.example.com/kohlstechnology/eunomia": false,
+		"https://gitlab.com/kohlstechnology/eunomia-config":  false,
+	} {
+		gitops := &gitopsv1alpha1.GitOpsConfig{Spec: gitopsv1alpha1.GitOpsConfigSpec{
+			TemplateSource: gitopsv1alpha1.GitConfig{URI: uri, Ref: "master"},
+		}}
+		if got := pushEventMatch(gitops, event); got != want {
+			t.Errorf("%s: expected match %v, got %v", uri, want, got)
+		}
+	}
+}
+
+func TestValidateGitLabToken(t *testing.T) {
+	tests := []struct {
+		token   string
+		secret  string
+		wantErr bool
+	}{
+		{"s3cr3t", "s3cr3t", false},
+		{"", "s3cr3t", true},
+		{"wrong", "s3cr3t", true},
+	}
+	for _, tt := range tests {
+		err := validateGitLabToken(tt.token, tt.secret)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateGitLabToken(%q, %q): expected error %v, got %v", tt.token, tt.secret, tt.wantErr, err)
+		}
+	}
+}
@@ -17,20 +17,53 @@ limitations under the License.
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strings"
+	"time"
 
 	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
 	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
-	"github.com/google/go-github/github"
+	"github.com/KohlsTechnology/eunomia/pkg/giturl"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 var log = logf.Log.WithName("handler").WithValues("filename", "handler.go")
 
-// WebhookHandler manages the calls from github
-func WebhookHandler(w http.ResponseWriter, r *http.Request, reconciler gitopsconfig.Reconciler) {
+// errInvalidPayload is returned when handling a webhook event whose payload
+// is invalid, which is reported to the caller as a bad request.
+var errInvalidPayload = errors.New("invalid webhook payload")
+
+// webhookResponse is the JSON body of the responses to webhook calls.
+type webhookResponse struct {
+	Provider string `json:"provider"`
+	// Event is "push" or "pull_request", or empty if the event was ignored
+	Event    string `json:"event,omitempty"`
+	Delivery string `json:"delivery,omitempty"`
+	// Duplicate is true if the delivery was already handled
+	Duplicate bool `json:"duplicate,omitempty"`
+	// Matched are the GitOpsConfigs whose run was requested (for push events)
+	// or whose preview environments were updated (for pull request events)
+	Matched []matchedConfig `json:"matched"`
+}
+
+type matchedConfig struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// WebhookHandler manages the calls from GitHub, GitLab, Bitbucket Server and
+// Gitea (or Gogs). Push events request a run of the matching GitOpsConfigs,
+// which is started asynchronously. GitHub pull request events manage the
+// preview environments of the GitOpsConfigs having a PullRequest trigger.
+// It responds 202 with the list of the matching GitOpsConfigs if there are
+// any, and 200 otherwise.
+func (d *Dispatcher) WebhookHandler(w http.ResponseWriter, r *http.Request) {
 	log.Info("received webhook call")
 	if r.Method != "POST" {
 		log.Info("webhook handler only accepts the POST method", "sent_method", r.Method)
@@ -41,97 +74,191 @@ func WebhookHandler(w http.ResponseWriter, r *http.Request, reconciler gitopscon
 	payload, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error(err, "error reading webhook request body")
+		w.WriteHeader(400)
 		return
 	}
 	defer r.Body.Close()
 
-	webHookEvent, err := github.ParseWebHook(github.WebHookType(r), payload)
+	p := detectProvider(r)
+	response := webhookResponse{Provider: p.name(), Delivery: p.deliveryID(r), Matched: []matchedConfig{}}
+	deliveryKey := p.name() + "/" + response.Delivery
+	if response.Delivery != "" && d.deliveries.contains(deliveryKey, time.Now()) {
+		log.Info("ignoring redelivered webhook", "provider", p.name(), "delivery", response.Delivery)
+		response.Duplicate = true
+		writeJSON(w, 200, response)
+		return
+	}
+
+	err = d.handleEvent(r, p, payload, &response)
+	if errors.Is(err, errInvalidPayload) {
+		log.Error(err, "error handling webhook event", "provider", p.name())
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	if err != nil {
-		log.Error(err, "error parsing webhook event payload")
+		log.Error(err, "error handling webhook event", "provider", p.name())
+		w.WriteHeader(500)
 		return
 	}
+	if response.Delivery != "" {
+		d.deliveries.add(deliveryKey, time.Now())
+	}
 
-	switch e := webHookEvent.(type) {
-	case *github.PushEvent:
-		// A commit push was received, determine if there is are GitOpsConfigs that match the event
-		// The repository url and Git ref must match for the templateSource or parameterSource
-		{
-			list, err := reconciler.GetAll()
-			if err != nil {
-				log.Error(err, "error getting the list of GitOpsConfigs")
-				w.WriteHeader(500)
-				return
-			}
+	log.Info("webhook handling concluded correctly", "event", response.Event, "matched", len(response.Matched))
+	status := 200
+	if len(response.Matched) > 0 {
+		status = 202
+	}
+	writeJSON(w, status, response)
+}
 
-			targetList := gitopsv1alpha1.GitOpsConfigList{
-				TypeMeta: list.TypeMeta,
-				ListMeta: list.ListMeta,
-				Items:    make([]gitopsv1alpha1.GitOpsConfig, 0, len(list.Items)),
+// handleEvent handles the event sent by the provider p in the request r with
+// the passed payload, and fills response with the matching GitOpsConfigs.
+func (d *Dispatcher) handleEvent(r *http.Request, p provider, payload []byte, response *webhookResponse) error {
+	validate := func(secret string) error {
+		if secret == "" {
+			if d.requireSecret {
+				return errors.New("the trigger has no webhook secret, which is required")
 			}
+			return nil
+		}
+		return p.validate(r, payload, secret)
+	}
 
-			for _, instance := range list.Items {
-				if !gitopsconfig.ContainsTrigger(&instance, "Webhook") {
-					log.Info("skip instance without webhook trigger", "instance_name", instance.Name)
-					continue
-				}
+	if prParser, ok := p.(pullRequestParser); ok {
+		prEvent, err := prParser.parsePullRequest(r, payload)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidPayload, err)
+		}
+		if prEvent != nil {
+			response.Event = "pull_request"
+			matched, err := applyPreviews(d.reconciler, prEvent, validate)
+			response.Matched = append(response.Matched, matched...)
+			return err
+		}
+	}
 
-				log.Info("comparing instance and event metadata", "event_name", e.Repo.GetFullName(), "event_ref", e.GetRef(),
-					"template_uri", instance.Spec.TemplateSource.URI, "template_ref", instance.Spec.TemplateSource.Ref,
-					"parameter_uri", instance.Spec.ParameterSource.URI, "parameter_ref", instance.Spec.ParameterSource.Ref)
+	event, err := p.parsePush(r, payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidPayload, err)
+	}
+	if event == nil {
+		log.Info("unknown event type", "provider", p.name())
+		return nil
+	}
+	response.Event = "push"
 
-				if !repoURLAndRefMatch(&instance, e) {
-					log.Info("skip instance without matching repo url or git ref of the event", "instance_name", instance.Name)
-					continue
-				}
+	// A commit push was received, determine if there is are GitOpsConfigs that match the event
+	// The repository url and Git ref must match for the templateSource or parameterSource
+	list, err := d.reconciler.GetByRepoRef(event.repoURLs, event.refs)
+	if err != nil {
+		return fmt.Errorf("error getting the list of GitOpsConfigs: %w", err)
+	}
+	for _, instance := range matchingConfigs(list, event, validate) {
+		log.Info("Webhook requesting run", "instance", instance.GetName(), "namespace", instance.GetNamespace())
+		d.enqueue(types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name})
+		response.Matched = append(response.Matched, matchedConfig{Namespace: instance.Namespace, Name: instance.Name})
+	}
+	return nil
+}
 
-				log.Info("found matching instance", "instance_name", instance.Name)
-				targetList.Items = append(targetList.Items, instance)
-			}
+// matchingConfigs returns the GitOpsConfigs of list having a Webhook trigger,
+// whose repository url and Git ref match the push event for the
+// templateSource or parameterSource. validate is called with the webhook
+// secret of each GitOpsConfig (which may be empty), and the GitOpsConfig is
+// ignored if it returns an error.
+func matchingConfigs(list gitopsv1alpha1.GitOpsConfigList, event *pushEvent, validate func(secret string) error) []gitopsv1alpha1.GitOpsConfig {
+	matched := []gitopsv1alpha1.GitOpsConfig{}
+	for _, instance := range list.Items {
+		if !gitopsconfig.ContainsTrigger(&instance, "Webhook") {
+			log.Info("skip instance without webhook trigger", "instance_name", instance.Name)
+			continue
+		}
 
-			if len(targetList.Items) == 0 {
-				log.Info("no gitopsconfigs match the webhook event", "event_repo", e.Repo.GetFullName(), "event_ref", strings.TrimPrefix(e.GetRef(), "refs/heads/"))
-				return
-			}
+		log.Info("comparing instance and event metadata", "event_name", event.repoFullName, "event_refs", event.refs,
+			"template_uri", instance.Spec.TemplateSource.URI, "template_ref", instance.Spec.TemplateSource.Ref,
+			"parameter_uri", instance.Spec.ParameterSource.URI, "parameter_ref", instance.Spec.ParameterSource.Ref)
 
-			for _, instance := range targetList.Items {
-				//if secured discard those that do not validate
-				secret := getWebhookSecret(&instance)
-				if secret != "" {
-					_, err := github.ValidatePayload(r, []byte(secret))
-					if err != nil {
-						log.Error(err, "webhook payload could not be validated with instance secret --> ignoring", "instance", instance.GetName(), "namespace", instance.GetNamespace())
-						continue
-					}
-				}
-				log.Info("Webhook triggering job", "instance", instance.GetName(), "namespace", instance.GetNamespace())
-				_, err := reconciler.CreateJob("create", &instance)
-				if err != nil {
-					log.Error(err, "Webhook unable to create job for instance", "instance", instance.GetName(), "namespace", instance.GetNamespace())
-				}
-			}
+		if !pushEventMatch(&instance, event) {
+			log.Info("skip instance without matching repo url or git ref of the event", "instance_name", instance.Name)
+			continue
+		}
+
+		if !pushTouchesConfig(&instance, event) {
+			log.Info("skip instance without relevant files changed by the event", "instance_name", instance.Name)
+			continue
+		}
+
+		// discard those that do not validate with their secret
+		err := validate(getTriggerSecret(&instance, "Webhook"))
+		if err != nil {
+			log.Error(err, "webhook payload could not be validated with instance secret --> ignoring", "instance", instance.GetName(), "namespace", instance.GetNamespace())
+			continue
 		}
-	default:
-		{
-			log.Info("unknown event type", "type", github.WebHookType(r))
-			return
+		log.Info("found matching instance", "instance_name", instance.Name)
+		matched = append(matched, instance)
+	}
+
+	if len(matched) == 0 {
+		log.Info("no gitopsconfigs match the webhook event", "event_repo", event.repoFullName, "event_refs", event.refs)
+	}
+	return matched
+}
+
+// pushEventMatch returns true if instance matches the repository and any of
+// the refs of the push event.
+func pushEventMatch(instance *gitopsv1alpha1.GitOpsConfig, event *pushEvent) bool {
+	for _, ref := range event.refs {
+		if repoAndRefMatch(instance, event.repoFullName, event.repoURLs, ref) {
+			return true
 		}
 	}
-	log.Info("webhook handling concluded correctly")
+	return false
+}
+
+// repoAndRefMatch returns true if the templateSource or parameterSource of
+// instance points to the repository with the passed full name and URLs (see
+// giturl.Match), at ref.
+func repoAndRefMatch(instance *gitopsv1alpha1.GitOpsConfig, repoFullName string, repoURLs []string, ref string) bool {
+	return sourceMatch(instance.Spec.TemplateSource, repoFullName, repoURLs, ref) ||
+		sourceMatch(instance.Spec.ParameterSource, repoFullName, repoURLs, ref)
 }
 
-func repoURLAndRefMatch(instance *gitopsv1alpha1.GitOpsConfig, event *github.PushEvent) bool {
-	return event.Repo != nil && event.Repo.FullName != nil && event.Ref != nil &&
-		((strings.Contains(instance.Spec.TemplateSource.URI, *event.Repo.FullName) &&
-			instance.Spec.TemplateSource.Ref == strings.TrimPrefix(*event.Ref, "refs/heads/")) ||
-			(strings.Contains(instance.Spec.ParameterSource.URI, *event.Repo.FullName) &&
-				instance.Spec.ParameterSource.Ref == strings.TrimPrefix(*event.Ref, "refs/heads/")))
+// sourceMatch returns true if source points to the repository with the passed
+// full name and URLs, at ref, e.g. "refs/heads/master" for a source with the
+// ref "master", or "refs/tags/v1.0.0" for "v1.0.0" or "refs/tags/v1.0.0".
+func sourceMatch(source gitopsv1alpha1.GitConfig, repoFullName string, repoURLs []string, ref string) bool {
+	for _, name := range gitopsconfig.RefNames(ref) {
+		if source.Ref == name {
+			return giturl.Match(source.URI, repoFullName, repoURLs)
+		}
+	}
+	return false
 }
 
-func getWebhookSecret(instance *gitopsv1alpha1.GitOpsConfig) string {
+// getTriggerSecret returns the webhook secret of the trigger of instance with
+// the passed type.
+func getTriggerSecret(instance *gitopsv1alpha1.GitOpsConfig, triggerType string) string {
 	for _, trigger := range instance.Spec.Triggers {
-		if trigger.Type == "Webhook" {
+		if trigger.Type == triggerType {
 			return trigger.Secret
 		}
 	}
 	return ""
 }
+
+// isNotFound returns true if err is, or wraps, a NotFound API error.
+func isNotFound(err error) bool {
+	var status apierrors.APIStatus
+	return errors.As(err, &status) && status.Status().Reason == metav1.StatusReasonNotFound
+}
+
+// writeJSON writes the response with the passed status code and JSON body.
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		log.Error(err, "error writing webhook response")
+	}
+}
@@ -20,12 +20,9 @@ import (
 	"testing"
 
 	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
-	"github.com/google/go-github/github"
 )
 
-func newstring(v string) *string { return &v }
-
-func TestRepoURLAndRefMatch(t *testing.T) {
+func TestPushEventMatch(t *testing.T) {
 
 	defaultGit := gitopsv1alpha1.GitConfig{
 		URI: "https://github.com/kohlstechnology/eunomia",
@@ -35,19 +32,14 @@ func TestRepoURLAndRefMatch(t *testing.T) {
 	tests := []struct {
 		comment string
 		spec    gitopsv1alpha1.GitOpsConfigSpec
-		event   github.PushEvent
+		event   pushEvent
 		want    bool
 	}{
 		{
 			comment: "full match - branch",
 			spec:    gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: defaultGit, ParameterSource: defaultGit},
-			event: github.PushEvent{
-				Ref: newstring("master"),
-				Repo: &github.PushEventRepository{
-					FullName: newstring("kohlstechnology/eunomia"),
-				},
-			},
-			want: true,
+			event:   pushEvent{repoFullName: "kohlstechnology/eunomia", refs: []string{"master"}},
+			want:    true,
 		},
 		{
 			comment: "full match - git tag",
@@ -58,13 +50,8 @@ func TestRepoURLAndRefMatch(t *testing.T) {
 					Ref: "refs/tags/0.1.4",
 				},
 			},
-			event: github.PushEvent{
-				Ref: newstring("refs/tags/0.1.4"),
-				Repo: &github.PushEventRepository{
-					FullName: newstring("kohlstechnology/eunomia"),
-				},
-			},
-			want: true,
+			event: pushEvent{repoFullName: "kohlstechnology/eunomia", refs: []string{"refs/tags/0.1.4"}},
+			want:  true,
 		},
 		{
 			comment: "TemplateSource match",
@@ -75,13 +62,8 @@ func TestRepoURLAndRefMatch(t *testing.T) {
 					Ref: "master2",
 				},
 			},
-			event: github.PushEvent{
-				Ref: newstring("master"),
-				Repo: &github.PushEventRepository{
-					FullName: newstring("kohlstechnology/eunomia"),
-				},
-			},
-			want: true,
+			event: pushEvent{repoFullName: "kohlstechnology/eunomia", refs: []string{"master"}},
+			want:  true,
 		},
 		{
 			comment: "ParameterSource match",
@@ -92,13 +74,8 @@ func TestRepoURLAndRefMatch(t *testing.T) {
 				},
 				ParameterSource: defaultGit,
 			},
-			event: github.PushEvent{
-				Ref: newstring("master"),
-				Repo: &github.PushEventRepository{
-					FullName: newstring("kohlstechnology/eunomia"),
-				},
-			},
-			want: true,
+			event: pushEvent{repoFullName: "kohlstechnology/eunomia", refs: []string{"master"}},
+			want:  true,
 		},
 		{
 			comment: "Ref differs",
@@ -106,44 +83,56 @@ func TestRepoURLAndRefMatch(t *testing.T) {
 				TemplateSource:  defaultGit,
 				ParameterSource: defaultGit,
 			},
-			event: github.PushEvent{
-				Ref: newstring("refs/tags/0.1.4"),
-				Repo: &github.PushEventRepository{
-					FullName: newstring("kohlstechnology/eunomia"),
-				},
-			},
-			want: false,
+			event: pushEvent{repoFullName: "kohlstechnology/eunomia", refs: []string{"refs/tags/0.1.4"}},
+			want:  false,
 		},
 		{
 			comment: "URI differs",
 			spec:    gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: defaultGit, ParameterSource: defaultGit},
-			event: github.PushEvent{
-				Ref: newstring("master"),
-				Repo: &github.PushEventRepository{
-					FullName: newstring("kohlstechnology/git2consul-go"),
-				},
+			event:   pushEvent{repoFullName: "kohlstechnology/git2consul-go", refs: []string{"master"}},
+			want:    false,
+		},
+		{
+			comment: "repository URL match - one of several refs",
+			spec:    gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: defaultGit, ParameterSource: defaultGit},
+			event: pushEvent{
+				repoURLs: []string{"https://github.com/kohlstechnology/eunomia.git"},
+				refs:     []string{"refs/heads/develop", "refs/heads/master"},
 			},
-			want: false,
+			want: true,
 		},
 		{
 			comment: "URI and Ref differs",
 			spec:    gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: defaultGit, ParameterSource: defaultGit},
-			event: github.PushEvent{
-				Ref: newstring("master2"),
-				Repo: &github.PushEventRepository{
-					FullName: newstring("kohlstechnology/git2consul-go"),
-				},
-			},
-			want: false,
+			event:   pushEvent{repoFullName: "kohlstechnology/git2consul-go", refs: []string{"master2"}},
+			want:    false,
 		},
 	}
 
 	for _, tt := range tests {
 		gitops := &gitopsv1alpha1.GitOpsConfig{Spec: tt.spec}
-		pushEvent := &tt.event
-		result := repoURLAndRefMatch(gitops, pushEvent)
+		result := pushEventMatch(gitops, &tt.event)
 		if result != tt.want {
 			t.Errorf("%q: expected %v, got %v", tt.comment, tt.want, result)
 		}
 	}
 }
+
+func TestPushEventMatchTag(t *testing.T) {
+	config := func(ref string) *gitopsv1alpha1.GitOpsConfig {
+		source := gitopsv1alpha1.GitConfig{URI: "https://gitlab.com/group/eunomia.git", Ref: ref}
+		return &gitopsv1alpha1.GitOpsConfig{Spec: gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: source, ParameterSource: source}}
+	}
+	event := &pushEvent{repoFullName: "group/eunomia", refs: []string{"refs/tags/v1.0.0"}}
+
+	for _, ref := range []string{"v1.0.0", "refs/tags/v1.0.0"} {
+		if !pushEventMatch(config(ref), event) {
+			t.Errorf("expected tag push to match ref %q", ref)
+		}
+	}
+	for _, ref := range []string{"master", "v1.0", "refs/heads/v1.0.0"} {
+		if pushEventMatch(config(ref), event) {
+			t.Errorf("expected tag push not to match ref %q", ref)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"path"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// commitFiles are the files changed by a commit, as listed in the push
+// payloads of GitHub, GitLab and Gitea.
+type commitFiles struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// changedFiles returns the files changed by the commits of a push, or nil if
+// they are unknown: when the payload has no commits (e.g. for a new tag), or
+// lists only some of the totalCommits pushed commits.
+func changedFiles(commits []commitFiles, totalCommits int) []string {
+	if len(commits) == 0 || totalCommits > len(commits) {
+		return nil
+	}
+	files := []string{}
+	seen := map[string]bool{}
+	for _, commit := range commits {
+		for _, list := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range list {
+				if !seen[file] {
+					seen[file] = true
+					files = append(files, file)
+				}
+			}
+		}
+	}
+	return files
+}
+
+// pushTouchesConfig returns true if the push event changed files relevant to
+// instance. When the Webhook trigger has includePaths, the relevant files are
+// those matching them; otherwise all the files are, as the parameters may be
+// layered from outside the contextDir of the sources (e.g. "../default" in
+// hierarchy.lst). The files matching the excludePaths of the trigger are
+// never relevant. Pushes whose changed files are unknown are always relevant.
+func pushTouchesConfig(instance *gitopsv1alpha1.GitOpsConfig, event *pushEvent) bool {
+	if event.files == nil {
+		return true
+	}
+	trigger := gitopsv1alpha1.GitOpsTrigger{}
+	for _, t := range instance.Spec.Triggers {
+		if t.Type == "Webhook" {
+			trigger = t
+			break
+		}
+	}
+	if len(trigger.IncludePaths) == 0 && len(trigger.ExcludePaths) == 0 {
+		return true
+	}
+
+	for _, file := range event.files {
+		if matchAnyGlob(trigger.ExcludePaths, file) {
+			continue
+		}
+		if len(trigger.IncludePaths) == 0 || matchAnyGlob(trigger.IncludePaths, file) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob returns true if the slash-separated path name matches pattern,
+// which uses the path.Match syntax for each path element, plus "**" matching
+// any number of path elements, e.g. "apps/**/*.yaml".
+func matchGlob(pattern, name string) bool {
+	return matchElements(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(strings.Trim(name, "/"), "/"))
+}
+
+func matchElements(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElements(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
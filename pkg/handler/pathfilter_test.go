@@ -0,0 +1,173 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"apps/app1/**", "apps/app1/values.yaml", true},
+		{"apps/app1/**", "apps/app1/templates/deployment.yaml", true},
+		{"apps/app1/**", "apps/app10/values.yaml", false},
+		{"apps/*/values.yaml", "apps/app1/values.yaml", true},
+		{"apps/*/values.yaml", "apps/app1/env/values.yaml", false},
+		{"apps/**/values.yaml", "apps/app1/env/values.yaml", true},
+		{"apps/**/values.yaml", "apps/values.yaml", true},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/usage/README.md", true},
+		{"*.md", "docs/README.md", false},
+		{"/apps/app1/", "apps/app1", true},
+		{"apps/[", "apps/[", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q): expected %v, got %v", tt.pattern, tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	commits := []commitFiles{
+		{Added: []string{"a.yaml"}, Modified: []string{"b.yaml"}},
+		{Modified: []string{"a.yaml"}, Removed: []string{"c.yaml"}},
+	}
+	if got := changedFiles(commits, 2); !reflect.DeepEqual(got, []string{"a.yaml", "b.yaml", "c.yaml"}) {
+		t.Errorf("expected files of all commits, got %v", got)
+	}
+	if got := changedFiles(commits, 0); got == nil {
+		t.Error("expected files when the total number of commits is not sent")
+	}
+	if got := changedFiles(commits, 25); got != nil {
+		t.Errorf("expected unknown files for truncated commit list, got %v", got)
+	}
+	if got := changedFiles(nil, 0); got != nil {
+		t.Errorf("expected unknown files without commits, got %v", got)
+	}
+}
+
+func TestPushTouchesConfig(t *testing.T) {
+	monorepo := "https://github.com/org/monorepo"
+	config := func(templateDir, parameterDir string, trigger gitopsv1alpha1.GitOpsTrigger) *gitopsv1alpha1.GitOpsConfig {
+		trigger.Type = "Webhook"
+		return &gitopsv1alpha1.GitOpsConfig{Spec: gitopsv1alpha1.GitOpsConfigSpec{
+			TemplateSource:  gitopsv1alpha1.GitConfig{URI: monorepo, Ref: "master", ContextDir: templateDir},
+			ParameterSource: gitopsv1alpha1.GitConfig{URI: monorepo, Ref: "master", ContextDir: parameterDir},
+			Triggers:        []gitopsv1alpha1.GitOpsTrigger{trigger},
+		}}
+	}
+	event := func(files ...string) *pushEvent {
+		return &pushEvent{repoFullName: "org/monorepo", repoURLs: []string{monorepo + ".git"}, refs: []string{"refs/heads/master"}, files: append([]string{}, files...)}
+	}
+	none := gitopsv1alpha1.GitOpsTrigger{}
+
+	tests := []struct {
+		comment string
+		config  *gitopsv1alpha1.GitOpsConfig
+		event   *pushEvent
+		want    bool
+	}{
+		{"no filter", config("", "", none), event("other/file"), true},
+		{"unknown files", config("apps/app1", "params/app1", none), &pushEvent{refs: []string{"refs/heads/master"}}, true},
+		// Parameters may be layered from outside the contextDir, e.g. ../default
+		{"outside contextDirs without include paths", config("apps/app1", "params/app1", none), event("params/default/values.yaml"), true},
+		{"no changed files", config("apps/app1", "params/app1", none), event(), true},
+		{"include paths", config("apps/app1", "", gitopsv1alpha1.GitOpsTrigger{IncludePaths: []string{"apps/app1/**", "shared/**"}}), event("shared/lib.yaml"), true},
+		{"outside include paths", config("apps/app1", "", gitopsv1alpha1.GitOpsTrigger{IncludePaths: []string{"apps/app1/**", "shared/**"}}), event("apps/app2/deployment.yaml", "README.md"), false},
+		{"include paths with no changed files", config("apps/app1", "", gitopsv1alpha1.GitOpsTrigger{IncludePaths: []string{"apps/app1/**"}}), event(), false},
+		{"exclude paths", config("", "", gitopsv1alpha1.GitOpsTrigger{ExcludePaths: []string{"**/*.md"}}), event("README.md", "docs/usage.md"), false},
+		{"exclude paths with other files", config("", "", gitopsv1alpha1.GitOpsTrigger{ExcludePaths: []string{"**/*.md"}}), event("README.md", "apps/app1/deployment.yaml"), true},
+		{"exclude paths in include paths", config("apps/app1", "apps/app1", gitopsv1alpha1.GitOpsTrigger{IncludePaths: []string{"apps/app1/**"}, ExcludePaths: []string{"apps/app1/docs/**"}}), event("apps/app1/docs/index.yaml"), false},
+	}
+	for _, tt := range tests {
+		if got := pushTouchesConfig(tt.config, tt.event); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.comment, tt.want, got)
+		}
+	}
+}
+
+func TestProvidersChangedFiles(t *testing.T) {
+	tests := []struct {
+		comment string
+		headers map[string]string
+		payload string
+		want    []string
+	}{
+		{
+			comment: "GitHub",
+			headers: map[string]string{"X-GitHub-Event": "push"},
+			payload: `{"ref": "refs/heads/master", "size": 2, "commits": [{"added": ["a"], "modified": ["b"]}, {"removed": ["c"]}]}`,
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			comment: "GitHub truncated commits",
+			headers: map[string]string{"X-GitHub-Event": "push"},
+			payload: `{"ref": "refs/heads/master", "size": 30, "commits": [{"added": ["a"]}]}`,
+		},
+		{
+			comment: "GitHub maximum number of commits",
+			headers: map[string]string{"X-GitHub-Event": "push"},
+			payload: `{"ref": "refs/heads/master", "commits": [{"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}, {"added": ["a"]}]}`,
+		},
+		{
+			comment: "GitHub commits not matching distinct_size",
+			headers: map[string]string{"X-GitHub-Event": "push"},
+			payload: `{"ref": "refs/heads/master", "distinct_size": 3, "commits": [{"added": ["a"]}, {"removed": ["c"]}]}`,
+		},
+		{
+			comment: "GitHub without size",
+			headers: map[string]string{"X-GitHub-Event": "push"},
+			payload: `{"ref": "refs/heads/master", "distinct_size": 1, "commits": [{"added": ["a"]}]}`,
+			want:    []string{"a"},
+		},
+		{
+			comment: "GitLab",
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook"},
+			payload: `{"object_kind": "push", "ref": "refs/heads/master", "total_commits_count": 1, "commits": [{"added": ["a"], "modified": [], "removed": []}]}`,
+			want:    []string{"a"},
+		},
+		{
+			comment: "Gitea",
+			headers: map[string]string{"X-Gitea-Event": "push"},
+			payload: `{"ref": "refs/heads/master", "total_commits": 1, "commits": [{"modified": ["b"]}]}`,
+			want:    []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/webhook/", strings.NewReader(tt.payload))
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		event, err := detectProvider(r).parsePush(r, []byte(tt.payload))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.comment, err)
+		}
+		if !reflect.DeepEqual(event.files, tt.want) {
+			t.Errorf("%s: expected files %v, got %v", tt.comment, tt.want, event.files)
+		}
+	}
+}
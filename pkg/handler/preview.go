@@ -0,0 +1,85 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"github.com/KohlsTechnology/eunomia/pkg/gitremote"
+)
+
+// previewReconciler is the part of gitopsconfig.Reconciler used to manage
+// the preview environments of pull requests.
+type previewReconciler interface {
+	GetByRepoRef(repoURLs []string, refs []string) (gitopsv1alpha1.GitOpsConfigList, error)
+	ApplyPreview(template *gitopsv1alpha1.GitOpsConfig, pr gitopsconfig.PullRequest) error
+	DeletePreview(template *gitopsv1alpha1.GitOpsConfig, number int) error
+}
+
+// applyPreviews handles a pull request event by creating, updating or
+// deleting the preview environments of the GitOpsConfigs having a
+// PullRequest trigger, whose repository url and Git ref match the base of the
+// pull request. validate is called with the secret of the PullRequest trigger
+// of each GitOpsConfig (which may be empty), and the GitOpsConfig is ignored
+// if it returns an error. It returns the GitOpsConfigs whose preview
+// environment was managed, and an error if the event couldn't be handled.
+func applyPreviews(reconciler previewReconciler, event *pullRequestEvent, validate func(secret string) error) ([]matchedConfig, error) {
+	if !event.closed && !gitremote.IsCommitSHA(event.headSHA) {
+		return nil, fmt.Errorf("%w: invalid head commit SHA %q in pull request %d", errInvalidPayload, event.headSHA, event.number)
+	}
+
+	list, err := reconciler.GetByRepoRef(event.repoURLs, []string{event.baseRef})
+	if err != nil {
+		return nil, fmt.Errorf("error getting the list of GitOpsConfigs: %w", err)
+	}
+
+	matched := []matchedConfig{}
+
+	for _, instance := range list.Items {
+		if !gitopsconfig.ContainsTrigger(&instance, "PullRequest") {
+			continue
+		}
+		if !repoAndRefMatch(&instance, event.repoFullName, event.repoURLs, event.baseRef) {
+			log.Info("skip instance without matching repo url or git ref of the pull request", "instance_name", instance.Name)
+			continue
+		}
+		err := validate(getTriggerSecret(&instance, "PullRequest"))
+		if err != nil {
+			log.Error(err, "webhook payload could not be validated with instance secret --> ignoring", "instance", instance.GetName(), "namespace", instance.GetNamespace())
+			continue
+		}
+
+		if event.closed {
+			log.Info("Pull request closed, deleting preview", "instance", instance.GetName(), "namespace", instance.GetNamespace(), "number", event.number)
+			err = reconciler.DeletePreview(&instance, event.number)
+		} else if event.fromFork {
+			log.Info("skip pull request from fork", "instance", instance.GetName(), "namespace", instance.GetNamespace(), "number", event.number)
+			continue
+		} else {
+			log.Info("Pull request updated, applying preview", "instance", instance.GetName(), "namespace", instance.GetNamespace(), "number", event.number)
+			err = reconciler.ApplyPreview(&instance, gitopsconfig.PullRequest{RepoFullName: event.repoFullName, RepoURLs: event.repoURLs, Number: event.number, HeadSHA: event.headSHA})
+		}
+		if err != nil {
+			log.Error(err, "Webhook unable to manage preview for instance", "instance", instance.GetName(), "namespace", instance.GetNamespace())
+			continue
+		}
+		matched = append(matched, matchedConfig{Namespace: instance.Namespace, Name: instance.Name})
+	}
+	return matched, nil
+}
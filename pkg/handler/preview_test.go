@@ -0,0 +1,148 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const headSHA = "0123456789abcdef0123456789abcdef01234567"
+
+type fakePreviewReconciler struct {
+	list    gitopsv1alpha1.GitOpsConfigList
+	applied []gitopsconfig.PullRequest
+	deleted []int
+}
+
+func (f *fakePreviewReconciler) GetByRepoRef(repoURLs []string, refs []string) (gitopsv1alpha1.GitOpsConfigList, error) {
+	return f.list, nil
+}
+
+func (f *fakePreviewReconciler) ApplyPreview(template *gitopsv1alpha1.GitOpsConfig, pr gitopsconfig.PullRequest) error {
+	f.applied = append(f.applied, pr)
+	return nil
+}
+
+func (f *fakePreviewReconciler) DeletePreview(template *gitopsv1alpha1.GitOpsConfig, number int) error {
+	f.deleted = append(f.deleted, number)
+	return nil
+}
+
+func pullRequestPayload(action, headRepo string) string {
+	return fmt.Sprintf(`{
+  "action": %q,
+  "number": 42,
+  "pull_request": {
+    "head": {"ref": "feature", "sha": %q, "repo": {"full_name": %q}},
+    "base": {"ref": "master", "repo": {"full_name": "kohlstechnology/eunomia"}}
+  },
+  "repository": {"full_name": "kohlstechnology/eunomia", "clone_url": "https://github.com/kohlstechnology/eunomia.git"}
+}`, action, headSHA, headRepo)
+}
+
+func TestGitHubParsePullRequest(t *testing.T) {
+	cloneURLs := []string{"https://github.com/kohlstechnology/eunomia.git"}
+	tests := []struct {
+		action   string
+		headRepo string
+		want     *pullRequestEvent
+	}{
+		{"opened", "kohlstechnology/eunomia", &pullRequestEvent{repoFullName: "kohlstechnology/eunomia", repoURLs: cloneURLs, baseRef: "master", number: 42, headSHA: headSHA}},
+		{"synchronize", "someone/eunomia", &pullRequestEvent{repoFullName: "kohlstechnology/eunomia", repoURLs: cloneURLs, baseRef: "master", number: 42, headSHA: headSHA, fromFork: true}},
+		{"closed", "kohlstechnology/eunomia", &pullRequestEvent{repoFullName: "kohlstechnology/eunomia", repoURLs: cloneURLs, baseRef: "master", number: 42, headSHA: headSHA, closed: true}},
+		{"labeled", "kohlstechnology/eunomia", nil},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/webhook/", nil)
+		r.Header.Set("X-GitHub-Event", "pull_request")
+		got, err := githubProvider{}.parsePullRequest(r, []byte(pullRequestPayload(tt.action, tt.headRepo)))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.action, err)
+		}
+		if (got == nil) != (tt.want == nil) || (got != nil && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s: expected %+v, got %+v", tt.action, tt.want, got)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/webhook/", nil)
+	r.Header.Set("X-GitHub-Event", "push")
+	if got, err := (githubProvider{}).parsePullRequest(r, []byte(`{}`)); got != nil || err != nil {
+		t.Errorf("expected push event to be ignored, got %+v, %v", got, err)
+	}
+}
+
+func TestApplyPreviews(t *testing.T) {
+	git := gitopsv1alpha1.GitConfig{URI: "https://github.com/kohlstechnology/eunomia", Ref: "master"}
+	config := func(name string, triggers ...gitopsv1alpha1.GitOpsTrigger) gitopsv1alpha1.GitOpsConfig {
+		return gitopsv1alpha1.GitOpsConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team"},
+			Spec:       gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: git, ParameterSource: git, Triggers: triggers},
+		}
+	}
+	reconciler := &fakePreviewReconciler{list: gitopsv1alpha1.GitOpsConfigList{Items: []gitopsv1alpha1.GitOpsConfig{
+		config("template", gitopsv1alpha1.GitOpsTrigger{Type: "PullRequest"}),
+		config("secured", gitopsv1alpha1.GitOpsTrigger{Type: "PullRequest", Secret: "other"}),
+		config("webhook-only", gitopsv1alpha1.GitOpsTrigger{Type: "Webhook"}),
+	}}}
+	other := config("other-repo", gitopsv1alpha1.GitOpsTrigger{Type: "PullRequest"})
+	other.Spec.TemplateSource.URI = "https://github.com/kohlstechnology/eunomia-config"
+	other.Spec.ParameterSource.URI = other.Spec.TemplateSource.URI
+	reconciler.list.Items = append(reconciler.list.Items, other)
+	validate := func(secret string) error {
+		if secret != "" && secret != "s3cret" {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	sshURLs := []string{"git@github.com:kohlstechnology/eunomia.git"}
+	event := &pullRequestEvent{repoFullName: "kohlstechnology/eunomia", repoURLs: sshURLs, baseRef: "master", number: 42, headSHA: headSHA}
+	matched, err := applyPreviews(reconciler, event, validate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(matched, []matchedConfig{{Namespace: "team", Name: "template"}}) {
+		t.Errorf("expected only template to match, got %+v", matched)
+	}
+	want := gitopsconfig.PullRequest{RepoFullName: "kohlstechnology/eunomia", RepoURLs: sshURLs, Number: 42, HeadSHA: headSHA}
+	if !reflect.DeepEqual(reconciler.applied, []gitopsconfig.PullRequest{want}) {
+		t.Errorf("expected preview %+v to be applied once, got %+v", want, reconciler.applied)
+	}
+
+	event.fromFork = true
+	if _, err := applyPreviews(reconciler, event, validate); err != nil || len(reconciler.applied) != 1 {
+		t.Errorf("expected pull request from fork to be ignored, got %+v", reconciler.applied)
+	}
+
+	event.closed = true
+	if _, err := applyPreviews(reconciler, event, validate); err != nil || len(reconciler.deleted) != 1 || reconciler.deleted[0] != 42 {
+		t.Errorf("expected preview 42 to be deleted once, got %v", reconciler.deleted)
+	}
+
+	event = &pullRequestEvent{repoFullName: "kohlstechnology/eunomia", baseRef: "master", number: 43, headSHA: "master\nkey: value"}
+	if _, err := applyPreviews(reconciler, event, validate); !errors.Is(err, errInvalidPayload) {
+		t.Errorf("expected invalid head SHA to be rejected, got %v", err)
+	}
+}
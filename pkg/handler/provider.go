@@ -0,0 +1,134 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// pushEvent contains the details of a push webhook event needed to find the
+// matching GitOpsConfigs, independent of the Git hosting service.
+type pushEvent struct {
+	// repoFullName is the path of the repository, e.g. "kohlstechnology/eunomia"
+	repoFullName string
+	// repoURLs are the URLs of the repository, e.g. its clone and ssh URLs
+	repoURLs []string
+	// refs are the pushed Git refs, e.g. "refs/heads/master" or "refs/tags/v1.0.0"
+	refs []string
+	// files are the paths changed by the pushed commits, relative to the
+	// repository root, or nil if they are unknown
+	files []string
+}
+
+// pullRequestEvent contains the details of a pull request webhook event needed
+// to manage the preview environments of the matching GitOpsConfigs.
+type pullRequestEvent struct {
+	// repoFullName is the path of the base repository, e.g. "kohlstechnology/eunomia"
+	repoFullName string
+	// repoURLs are the URLs of the base repository, e.g. its clone and ssh URLs
+	repoURLs []string
+	// baseRef is the branch the pull request is merged into, e.g. "master"
+	baseRef string
+	number  int
+	headSHA string
+	// fromFork is true if the head of the pull request is in another repository
+	fromFork bool
+	// closed is true if the pull request was closed or merged
+	closed bool
+}
+
+// pullRequestParser is implemented by the providers supporting preview
+// environments for pull requests.
+type pullRequestParser interface {
+	// parsePullRequest extracts the pull request event from the request r
+	// with the passed payload. It returns nil (and no error) for other types
+	// of events, and for pull request actions not affecting the preview
+	// environments.
+	parsePullRequest(r *http.Request, payload []byte) (*pullRequestEvent, error)
+}
+
+// provider adapts the webhook requests of a Git hosting service.
+type provider interface {
+	// name identifies the provider in logs.
+	name() string
+	// detect returns true if the request r was sent by the provider.
+	detect(r *http.Request) bool
+	// deliveryID returns the unique ID of the webhook delivery, which is
+	// kept on redelivery, or "" if the request doesn't have one.
+	deliveryID(r *http.Request) string
+	// parsePush extracts the push event from the request r with the passed
+	// payload. It returns nil (and no error) for other types of events,
+	// which must be ignored.
+	parsePush(r *http.Request, payload []byte) (*pushEvent, error)
+	// validate returns an error if the request r with the passed payload
+	// cannot be authenticated with the webhook secret.
+	validate(r *http.Request, payload []byte, secret string) error
+}
+
+// providers are checked in order; the first one detecting the request is used
+// to handle it. Gitea also sends GitHub headers, so it must come before GitHub,
+// which is used when none of the others matched.
+var providers = []provider{
+	gitlabProvider{},
+	bitbucketServerProvider{},
+	giteaProvider{},
+	githubProvider{},
+}
+
+// detectProvider returns the provider which sent the request r.
+func detectProvider(r *http.Request) provider {
+	for _, p := range providers {
+		if p.detect(r) {
+			return p
+		}
+	}
+	return githubProvider{}
+}
+
+// nonEmpty returns the non-empty values, e.g. the URLs set in an event.
+func nonEmpty(values ...string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// validateHexHMAC checks that signature is the hex-encoded HMAC-SHA256 of
+// payload, using secret as the key.
+func validateHexHMAC(signature string, payload []byte, secret string) error {
+	if signature == "" {
+		return errors.New("missing signature")
+	}
+	messageMAC, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("error decoding signature %q: %w", signature, err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload) //nolint:errcheck
+	if !hmac.Equal(messageMAC, mac.Sum(nil)) {
+		return errors.New("payload signature check failed")
+	}
+	return nil
+}
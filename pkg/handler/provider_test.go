@@ -0,0 +1,146 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const secret = "s3cr3t"
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload)) //nolint:errcheck
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestProviders(t *testing.T) {
+	githubPayload := `{"ref": "refs/heads/master", "repository": {"full_name": "kohlstechnology/eunomia", "clone_url": "https://github.com/kohlstechnology/eunomia.git"}}`
+	bitbucketPayload := `{
+		"eventKey": "repo:refs_changed",
+		"repository": {
+			"slug": "eunomia",
+			"project": {"key": "PRJ"},
+			"links": {"clone": [
+				{"href": "ssh://git@bitbucket.example.com:7999/prj/eunomia.git", "name": "ssh"},
+				{"href": "https://bitbucket.example.com/scm/prj/eunomia.git", "name": "http"}
+			]}
+		},
+		"changes": [
+			{"ref": {"id": "refs/heads/master"}, "type": "UPDATE"},
+			{"ref": {"id": "refs/tags/v1.0.0"}, "type": "ADD"},
+			{"ref": {"id": "refs/heads/old"}, "type": "DELETE"}
+		]
+	}`
+	giteaPayload := `{"ref": "refs/heads/master", "repository": {"full_name": "kohlstechnology/eunomia", "ssh_url": "git@gitea.example.com:kohlstechnology/eunomia.git"}}`
+	gitlabPayload := `{"object_kind": "push", "ref": "refs/heads/master", "project": {"path_with_namespace": "kohlstechnology/eunomia", "git_http_url": "https://gitlab.com/kohlstechnology/eunomia.git"}}`
+
+	tests := []struct {
+		comment     string
+		headers     map[string]string
+		payload     string
+		wantName    string
+		wantEvent   *pushEvent
+		wantInvalid bool
+	}{
+		{
+			comment:   "GitHub push",
+			headers:   map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature": "sha256=" + sign(githubPayload), "Content-Type": "application/json"},
+			payload:   githubPayload,
+			wantName:  "GitHub",
+			wantEvent: &pushEvent{repoFullName: "kohlstechnology/eunomia", repoURLs: []string{"https://github.com/kohlstechnology/eunomia.git"}, refs: []string{"refs/heads/master"}},
+		},
+		{
+			comment:  "GitHub ping",
+			headers:  map[string]string{"X-GitHub-Event": "ping", "Content-Type": "application/json"},
+			payload:  `{"zen": "Keep it logically awesome."}`,
+			wantName: "GitHub",
+		},
+		{
+			comment:     "GitLab push with wrong token",
+			headers:     map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "wrong"},
+			payload:     gitlabPayload,
+			wantName:    "GitLab",
+			wantEvent:   &pushEvent{repoFullName: "kohlstechnology/eunomia", repoURLs: []string{"https://gitlab.com/kohlstechnology/eunomia.git"}, refs: []string{"refs/heads/master"}},
+			wantInvalid: true,
+		},
+		{
+			comment:  "Bitbucket Server refs changed",
+			headers:  map[string]string{"X-Event-Key": "repo:refs_changed", "X-Hub-Signature": "sha256=" + sign(bitbucketPayload)},
+			payload:  bitbucketPayload,
+			wantName: "Bitbucket Server",
+			wantEvent: &pushEvent{
+				repoFullName: "prj/eunomia",
+				repoURLs:     []string{"ssh://git@bitbucket.example.com:7999/prj/eunomia.git", "https://bitbucket.example.com/scm/prj/eunomia.git"},
+				refs:         []string{"refs/heads/master", "refs/tags/v1.0.0"},
+			},
+		},
+		{
+			comment:  "Bitbucket Cloud push",
+			headers:  map[string]string{"X-Event-Key": "repo:push"},
+			payload:  `{}`,
+			wantName: "Bitbucket Server",
+		},
+		{
+			comment:   "Gitea push",
+			headers:   map[string]string{"X-GitHub-Event": "push", "X-Gitea-Event": "push", "X-Gitea-Signature": sign(giteaPayload)},
+			payload:   giteaPayload,
+			wantName:  "Gitea",
+			wantEvent: &pushEvent{repoFullName: "kohlstechnology/eunomia", repoURLs: []string{"git@gitea.example.com:kohlstechnology/eunomia.git"}, refs: []string{"refs/heads/master"}},
+		},
+		{
+			comment:     "Gogs push with wrong signature",
+			headers:     map[string]string{"X-Gogs-Event": "push", "X-Gogs-Signature": sign("something else")},
+			payload:     giteaPayload,
+			wantName:    "Gitea",
+			wantEvent:   &pushEvent{repoFullName: "kohlstechnology/eunomia", repoURLs: []string{"git@gitea.example.com:kohlstechnology/eunomia.git"}, refs: []string{"refs/heads/master"}},
+			wantInvalid: true,
+		},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/webhook", strings.NewReader(tt.payload))
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		p := detectProvider(r)
+		if p.name() != tt.wantName {
+			t.Errorf("%q: expected provider %q, got %q", tt.comment, tt.wantName, p.name())
+			continue
+		}
+		event, err := p.parsePush(r, []byte(tt.payload))
+		if err != nil {
+			t.Errorf("%q: %v", tt.comment, err)
+			continue
+		}
+		if !reflect.DeepEqual(event, tt.wantEvent) {
+			t.Errorf("%q: expected event %+v, got %+v", tt.comment, tt.wantEvent, event)
+		}
+		if event == nil {
+			continue
+		}
+		err = p.validate(r, []byte(tt.payload), secret)
+		if (err != nil) != tt.wantInvalid {
+			t.Errorf("%q: expected invalid %v, got error %v", tt.comment, tt.wantInvalid, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// serverIdleTimeout is how long idle keep-alive connections are kept open.
+	serverIdleTimeout = 2 * time.Minute
+	// serverShutdownTimeout is how long the requests in progress are given to
+	// complete when the server is shut down.
+	serverShutdownTimeout = 30 * time.Second
+	// certCheckInterval is how often the TLS certificate files are checked
+	// for changes.
+	certCheckInterval = 10 * time.Second
+)
+
+// ServerOptions configures the Server.
+type ServerOptions struct {
+	// Addr is the TCP address to listen on, e.g. ":8080"
+	Addr string
+	// CertFile and KeyFile are the paths of the PEM-encoded TLS certificate
+	// and key. The server uses plain HTTP if they are empty.
+	CertFile string
+	KeyFile  string
+	// ReadTimeout and WriteTimeout limit the duration of reading a request,
+	// and of writing its response.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// MaxBodySize is the maximum size of request bodies in bytes; 0 means no
+	// limit.
+	MaxBodySize int64
+}
+
+// Server serves the webhook, trigger and health endpoints. It implements
+// manager.Runnable, so that it's shut down gracefully with the manager.
+type Server struct {
+	options ServerOptions
+	server  *http.Server
+	certs   *certReloader
+}
+
+// NewServer creates a Server serving handler. The TLS certificate and key, if
+// any, are loaded immediately, and reloaded when the files change.
+func NewServer(options ServerOptions, handler http.Handler) (*Server, error) {
+	if (options.CertFile == "") != (options.KeyFile == "") {
+		return nil, errors.New("both the TLS certificate and key files must be set")
+	}
+	s := &Server{
+		options: options,
+		server: &http.Server{
+			Addr:         options.Addr,
+			Handler:      limitBodySize(handler, options.MaxBodySize),
+			ReadTimeout:  options.ReadTimeout,
+			WriteTimeout: options.WriteTimeout,
+			IdleTimeout:  serverIdleTimeout,
+		},
+	}
+	if options.CertFile != "" {
+		s.certs = &certReloader{certFile: options.CertFile, keyFile: options.KeyFile}
+		err := s.certs.load()
+		if err != nil {
+			return nil, err
+		}
+		s.server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.certs.getCertificate,
+		}
+	}
+	return s, nil
+}
+
+// Start serves requests until stop is closed, and then waits for the requests
+// in progress to complete.
+func (s *Server) Start(stop <-chan struct{}) error {
+	errs := make(chan error, 1)
+	go func() {
+		log.Info("Starting the Web Server", "address", s.options.Addr, "tls", s.certs != nil)
+		if s.certs != nil {
+			// The certificate is provided by the TLS config
+			errs <- s.server.ListenAndServeTLS("", "")
+		} else {
+			errs <- s.server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("web server failed: %w", err)
+	case <-stop:
+	}
+	log.Info("Stopping the Web Server")
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("web server shutdown failed: %w", err)
+	}
+	return nil
+}
+
+// limitBodySize rejects the requests whose body is larger than maxSize bytes.
+// Requests without Content-Length fail when reading the body past the limit.
+func limitBodySize(handler http.Handler, maxSize int64) http.Handler {
+	if maxSize <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxSize {
+			log.Info("request body too large", "path", r.URL.Path, "size", r.ContentLength, "max_size", maxSize)
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// certReloader provides the TLS certificate loaded from certFile and keyFile,
+// and reloads it when the files are modified, e.g. when a mounted Secret is
+// updated. The last valid certificate is kept if the files are invalid.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	sync.Mutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	lastCheck   time.Time
+}
+
+// load reads the certificate and key files.
+func (c *certReloader) load() error {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return fmt.Errorf("unable to read TLS certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to read TLS key: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load TLS certificate %q and key %q: %w", c.certFile, c.keyFile, err)
+	}
+	c.cert = &cert
+	c.certModTime = certInfo.ModTime()
+	c.keyModTime = keyInfo.ModTime()
+	return nil
+}
+
+// reloadIfModified reloads the certificate if the files were modified since
+// they were loaded. It checks the files at most every certCheckInterval.
+func (c *certReloader) reloadIfModified(now time.Time) {
+	if now.Sub(c.lastCheck) < certCheckInterval {
+		return
+	}
+	c.lastCheck = now
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		log.Error(err, "unable to check TLS certificate, keeping the loaded one")
+		return
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		log.Error(err, "unable to check TLS key, keeping the loaded one")
+		return
+	}
+	if certInfo.ModTime().Equal(c.certModTime) && keyInfo.ModTime().Equal(c.keyModTime) {
+		return
+	}
+	err = c.load()
+	if err != nil {
+		log.Error(err, "unable to reload TLS certificate, keeping the loaded one")
+		return
+	}
+	log.Info("Reloaded TLS certificate", "cert_file", c.certFile)
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.reloadIfModified(time.Now())
+	return c.cert, nil
+}
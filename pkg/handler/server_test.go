@@ -0,0 +1,172 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for commonName and its key.
+func writeCert(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func certCommonName(t *testing.T, c *certReloader) string {
+	cert, err := c.getCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eunomia-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "first")
+
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	if name := certCommonName(t, c); name != "first" {
+		t.Errorf("expected first certificate, got %q", name)
+	}
+
+	// The modification times are compared, so make sure they change
+	writeCert(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(certFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	c.lastCheck = time.Time{}
+	if name := certCommonName(t, c); name != "second" {
+		t.Errorf("expected reloaded certificate, got %q", name)
+	}
+
+	// An invalid certificate is ignored
+	if err := ioutil.WriteFile(certFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	evenLater := later.Add(time.Minute)
+	if err := os.Chtimes(certFile, evenLater, evenLater); err != nil {
+		t.Fatal(err)
+	}
+	c.lastCheck = time.Time{}
+	if name := certCommonName(t, c); name != "second" {
+		t.Errorf("expected last valid certificate to be kept, got %q", name)
+	}
+
+	if _, err := NewServer(ServerOptions{CertFile: certFile}, http.NotFoundHandler()); err == nil {
+		t.Error("expected error for certificate without key")
+	}
+}
+
+func TestLimitBodySize(t *testing.T) {
+	handler := limitBodySize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			w.WriteHeader(400)
+		}
+	}), 10)
+
+	tests := []struct {
+		comment       string
+		body          string
+		contentLength int64
+		want          int
+	}{
+		{"small body", "0123456789", 10, 200},
+		{"large body", "0123456789a", 11, 413},
+		{"large body without length", "0123456789a", -1, 400},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/webhook/", strings.NewReader(tt.body))
+		r.ContentLength = tt.contentLength
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.comment, tt.want, w.Code)
+		}
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s, err := NewServer(ServerOptions{Addr: "127.0.0.1:0"}, http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- s.Start(stop)
+	}()
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected server to stop")
+	}
+}
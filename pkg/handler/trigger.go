@@ -0,0 +1,173 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+)
+
+// TriggerPath is the path prefix of the trigger endpoint, followed by the
+// namespace and name of the GitOpsConfig.
+const TriggerPath = "/trigger/"
+
+// maxTriggerBodySize is the maximum size of the body of a trigger call.
+const maxTriggerBodySize = 64 * 1024
+
+// revisionPattern matches the Git refs and commit SHAs accepted as revision.
+var revisionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// triggerReconciler is the part of gitopsconfig.Reconciler used by the
+// trigger endpoint.
+type triggerReconciler interface {
+	Get(namespace, name string) (gitopsv1alpha1.GitOpsConfig, error)
+	TriggerToken(instance *gitopsv1alpha1.GitOpsConfig) (string, error)
+	RequestRun(instance *gitopsv1alpha1.GitOpsConfig, revision string, now time.Time) error
+}
+
+// triggerRequest is the optional JSON body of a trigger call.
+type triggerRequest struct {
+	Revision string `json:"revision"`
+}
+
+// triggerResponse is the JSON body answering a successful trigger call.
+type triggerResponse struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Revision  string `json:"revision"`
+	State     string `json:"state,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// TriggerHandler manages the calls to POST /trigger/{namespace}/{name}, which
+// request a run of the GitOpsConfig, e.g. from CI pipelines. The caller is
+// authenticated by the bearer token stored in the Secret referenced by the
+// tokenSecretRef of the GitOpsConfig's Webhook trigger. The revision to deploy
+// can be passed in the "revision" query parameter or JSON body field; it
+// replaces the Git ref of the templateSource (and of the parameterSource, if
+// both are in the same repository) for this run only. The run is started by
+// the reconcile loop, once the running job finishes if any, and once it's no
+// longer deferred by suspension, sync windows or concurrency limits.
+func TriggerHandler(w http.ResponseWriter, r *http.Request, reconciler triggerReconciler) {
+	log.Info("received trigger call", "path", r.URL.Path)
+	if r.Method != "POST" {
+		log.Info("trigger handler only accepts the POST method", "sent_method", r.Method)
+		w.WriteHeader(405)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, TriggerPath), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		log.Info("invalid trigger path", "path", r.URL.Path)
+		w.WriteHeader(404)
+		return
+	}
+	namespace, name := parts[0], parts[1]
+
+	instance, err := reconciler.Get(namespace, name)
+	if err != nil {
+		if isNotFound(err) {
+			log.Info("no GitOpsConfig to trigger", "namespace", namespace, "name", name)
+			w.WriteHeader(404)
+			return
+		}
+		log.Error(err, "error getting the GitOpsConfig to trigger", "namespace", namespace, "name", name)
+		w.WriteHeader(500)
+		return
+	}
+	// Don't reveal which GitOpsConfigs exist to unauthenticated callers
+	if !gitopsconfig.ContainsTrigger(&instance, "Webhook") {
+		log.Info("GitOpsConfig has no webhook trigger", "namespace", namespace, "name", name)
+		w.WriteHeader(401)
+		return
+	}
+	token, err := reconciler.TriggerToken(&instance)
+	if err != nil {
+		log.Error(err, "error getting the trigger token", "namespace", namespace, "name", name)
+		w.WriteHeader(500)
+		return
+	}
+	if token == "" {
+		log.Info("GitOpsConfig has no trigger token", "namespace", namespace, "name", name)
+		w.WriteHeader(401)
+		return
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+		log.Info("invalid trigger token", "namespace", namespace, "name", name)
+		w.WriteHeader(401)
+		return
+	}
+
+	revision, err := triggerRevision(r)
+	if err != nil {
+		log.Info("invalid trigger request", "namespace", namespace, "name", name, "error", err.Error())
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	log.Info("trigger requesting run", "namespace", namespace, "name", name, "revision", revision)
+	err = reconciler.RequestRun(&instance, revision, time.Now())
+	if err != nil {
+		log.Error(err, "trigger unable to request a run of instance", "namespace", namespace, "name", name)
+		w.WriteHeader(500)
+		return
+	}
+
+	if revision == "" {
+		revision = instance.Spec.TemplateSource.Ref
+	}
+	writeJSON(w, 202, triggerResponse{
+		Namespace: namespace,
+		Name:      name,
+		Revision:  revision,
+		State:     instance.Status.State,
+		Message:   instance.Status.Message,
+	})
+}
+
+// triggerRevision returns the revision requested by the trigger call, if any.
+func triggerRevision(r *http.Request) (string, error) {
+	revision := r.URL.Query().Get("revision")
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxTriggerBodySize))
+	if err != nil {
+		return "", errors.New("unable to read request body")
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		request := triggerRequest{}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return "", errors.New("request body is not valid JSON")
+		}
+		if request.Revision != "" {
+			revision = request.Revision
+		}
+	}
+	if revision != "" && (!revisionPattern.MatchString(revision) || strings.Contains(revision, "..")) {
+		return "", errors.New("invalid revision")
+	}
+	return revision, nil
+}
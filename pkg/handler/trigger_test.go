@@ -0,0 +1,135 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type fakeTriggerReconciler struct {
+	instance  gitopsv1alpha1.GitOpsConfig
+	token     string
+	requested []string
+}
+
+func (f *fakeTriggerReconciler) Get(namespace, name string) (gitopsv1alpha1.GitOpsConfig, error) {
+	if namespace != f.instance.Namespace || name != f.instance.Name {
+		notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "gitopsconfigs"}, name)
+		return gitopsv1alpha1.GitOpsConfig{}, fmt.Errorf("wrapped: %w", notFound)
+	}
+	return f.instance, nil
+}
+
+func (f *fakeTriggerReconciler) TriggerToken(instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	return f.token, nil
+}
+
+func (f *fakeTriggerReconciler) RequestRun(instance *gitopsv1alpha1.GitOpsConfig, revision string, now time.Time) error {
+	f.requested = append(f.requested, revision)
+	return nil
+}
+
+func TestTriggerHandler(t *testing.T) {
+	instance := gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team"},
+		Spec: gitopsv1alpha1.GitOpsConfigSpec{
+			TemplateSource:  gitopsv1alpha1.GitConfig{URI: "https://github.com/org/app", Ref: "master"},
+			ParameterSource: gitopsv1alpha1.GitConfig{URI: "https://github.com/org/app", Ref: "master"},
+			Triggers:        []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook", TokenSecretRef: "app-trigger"}},
+		},
+	}
+
+	tests := []struct {
+		comment       string
+		method        string
+		path          string
+		token         string
+		body          string
+		wantStatus    int
+		wantRequested string
+		wantRevision  string
+	}{
+		{"default revision", "POST", "/trigger/team/app", "s3cret", "", 202, "", "master"},
+		{"query revision", "POST", "/trigger/team/app?revision=v1.2.0", "s3cret", "", 202, "v1.2.0", "v1.2.0"},
+		{"body revision", "POST", "/trigger/team/app", "s3cret", `{"revision": "0a1b2c3d"}`, 202, "0a1b2c3d", "0a1b2c3d"},
+		{"invalid revision", "POST", "/trigger/team/app", "s3cret", `{"revision": "master\nkey: value"}`, 400, "", ""},
+		{"invalid body", "POST", "/trigger/team/app", "s3cret", `revision=v1`, 400, "", ""},
+		{"wrong token", "POST", "/trigger/team/app", "guess", "", 401, "", ""},
+		{"missing token", "POST", "/trigger/team/app", "", "", 401, "", ""},
+		{"unknown config", "POST", "/trigger/team/other", "s3cret", "", 404, "", ""},
+		{"invalid path", "POST", "/trigger/team", "s3cret", "", 404, "", ""},
+		{"wrong method", "GET", "/trigger/team/app", "s3cret", "", 405, "", ""},
+	}
+	for _, tt := range tests {
+		reconciler := &fakeTriggerReconciler{instance: instance, token: "s3cret"}
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+
+		TriggerHandler(w, r, reconciler)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.comment, tt.wantStatus, w.Code)
+			continue
+		}
+		if tt.wantStatus != 202 {
+			if len(reconciler.requested) != 0 {
+				t.Errorf("%s: expected no run to be requested", tt.comment)
+			}
+			continue
+		}
+		if len(reconciler.requested) != 1 {
+			t.Errorf("%s: expected 1 run to be requested, got %d", tt.comment, len(reconciler.requested))
+			continue
+		}
+		if got := reconciler.requested[0]; got != tt.wantRequested {
+			t.Errorf("%s: expected requested revision %q, got %q", tt.comment, tt.wantRequested, got)
+		}
+		if !strings.Contains(w.Body.String(), fmt.Sprintf(`"revision":%q`, tt.wantRevision)) {
+			t.Errorf("%s: expected revision in response, got %s", tt.comment, w.Body.String())
+		}
+	}
+}
+
+func TestTriggerHandlerWithoutToken(t *testing.T) {
+	reconciler := &fakeTriggerReconciler{instance: gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team"},
+		Spec: gitopsv1alpha1.GitOpsConfigSpec{
+			Triggers: []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook"}},
+		},
+	}}
+	r := httptest.NewRequest("POST", "/trigger/team/app", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+
+	TriggerHandler(w, r, reconciler)
+
+	if w.Code != 401 || len(reconciler.requested) != 0 {
+		t.Errorf("expected call to be rejected, got status %d and %d requested runs", w.Code, len(reconciler.requested))
+	}
+}
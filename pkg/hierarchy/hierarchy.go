@@ -0,0 +1,473 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hierarchy merges the parameter files of a GitOpsConfig according to
+// its hierarchy.lst. Each line of hierarchy.lst is a directory, relative to
+// the directory holding hierarchy.lst; the YAML files of the directories are
+// merged in order, so that the last ones take precedence. Maps are merged
+// recursively, and lists are replaced unless another strategy is set with a
+// directive:
+//
+//	#@list-merge containers.env merge-by:name
+//
+// Variables are substituted in the directories, e.g. ../${NAMESPACE}. They're
+// only substituted in the string values, e.g. "https://${NAMESPACE}.example.com",
+// when enabled with the option or with the directive:
+//
+//	#@substitute-values
+package hierarchy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// DefaultFile is the name of the hierarchy file.
+const DefaultFile = "hierarchy.lst"
+
+// directivePrefix starts the directive lines of the hierarchy file; they're
+// comments for the hierarchy command.
+const directivePrefix = "#@"
+
+// substituteValuesDirective enables the substitution of the variables in the
+// values.
+const substituteValuesDirective = "substitute-values"
+
+// ListStrategy defines how a list is merged with the list it overrides.
+type ListStrategy string
+
+const (
+	// ListReplace replaces the list; this is the default.
+	ListReplace ListStrategy = "replace"
+	// ListAppend appends the items to the list.
+	ListAppend ListStrategy = "append"
+	// ListAppendUnique appends the items which aren't in the list yet.
+	ListAppendUnique ListStrategy = "append-unique"
+	// listMergeByPrefix starts the strategies merging the map items which
+	// have the same value for a key, e.g. "merge-by:name"; the other items
+	// are appended.
+	listMergeByPrefix = "merge-by:"
+)
+
+// ParseListStrategy validates a list strategy.
+func ParseListStrategy(text string) (ListStrategy, error) {
+	strategy := ListStrategy(text)
+	switch {
+	case strategy == ListReplace, strategy == ListAppend, strategy == ListAppendUnique:
+		return strategy, nil
+	case strings.HasPrefix(text, listMergeByPrefix) && len(text) > len(listMergeByPrefix):
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("invalid list merge strategy %q; supported values are replace, append, append-unique and merge-by:<key>", text)
+	}
+}
+
+// Options configures a merge.
+type Options struct {
+	// File is the name of the hierarchy file. Default is hierarchy.lst.
+	File string
+	// Variables are substituted in the directories, and in the values if
+	// enabled. The environment variables aren't used.
+	Variables map[string]string
+	// SubstituteValues enables the substitution of the variables in the
+	// string values, like the substitute-values directive.
+	SubstituteValues bool
+	// ListStrategies sets the strategy of the lists by path, e.g. "env" or
+	// "containers.env"; "*" sets the default strategy. They take precedence
+	// over the directives of the hierarchy file.
+	ListStrategies map[string]ListStrategy
+}
+
+// Result holds the merged parameters.
+type Result struct {
+	// Values are the merged parameters
+	Values map[string]interface{}
+	// Files are the merged files in order, relative to the base directory
+	Files []string
+	// Sources maps the path of each value, e.g. "app.ports[1].name", to the
+	// file which set it
+	Sources map[string]string
+}
+
+// YAML returns the merged parameters as YAML.
+func (r *Result) YAML() ([]byte, error) {
+	return yaml.Marshal(r.Values)
+}
+
+// Provenance writes the path of each value with the file which set it, one
+// per line and sorted by path.
+func (r *Result) Provenance(w io.Writer) error {
+	paths := make([]string, 0, len(r.Sources))
+	for path := range r.Sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", path, r.Sources[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Merge merges the YAML files of the directories listed in the hierarchy
+// file of base. Without hierarchy file, the YAML files of base are merged.
+func Merge(base string, options Options) (*Result, error) {
+	name := options.File
+	if name == "" {
+		name = DefaultFile
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := options.Variables[name]
+		return value, ok
+	}
+
+	dirs, strategies, substitute, err := readHierarchy(filepath.Join(base, name), lookup)
+	if errors.Is(err, os.ErrNotExist) {
+		dirs, strategies = []string{"."}, map[string]ListStrategy{}
+	} else if err != nil {
+		return nil, err
+	}
+	for path, strategy := range options.ListStrategies {
+		if _, err := ParseListStrategy(string(strategy)); err != nil {
+			return nil, err
+		}
+		strategies[path] = strategy
+	}
+
+	m := &merger{strategies: strategies, sources: map[string]string{}}
+	result := &Result{Values: map[string]interface{}{}, Files: []string{}, Sources: m.sources}
+	for _, dir := range dirs {
+		files, err := yamlFiles(filepath.Join(base, dir))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			rel, err := filepath.Rel(base, file)
+			if err != nil {
+				return nil, err
+			}
+			rel = filepath.ToSlash(rel)
+			docs, err := readDocuments(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read parameter file %s: %w", rel, err)
+			}
+			for _, doc := range docs {
+				result.Values = m.merge(result.Values, doc, "", rel).(map[string]interface{})
+			}
+			result.Files = append(result.Files, rel)
+		}
+	}
+	if substitute || options.SubstituteValues {
+		substituteValues(result.Values, lookup)
+	}
+	return result, nil
+}
+
+// readHierarchy returns the directories and the list strategies of the
+// hierarchy file at path, and whether it enables the substitution of the
+// variables in the values.
+func readHierarchy(path string, lookup func(string) (string, bool)) ([]string, map[string]ListStrategy, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer f.Close()
+	dirs := []string{}
+	strategies := map[string]ListStrategy{}
+	substitute := false
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == directivePrefix+substituteValuesDirective {
+			substitute = true
+			continue
+		}
+		if strings.HasPrefix(text, directivePrefix) {
+			valuePath, strategy, err := parseDirective(strings.TrimPrefix(text, directivePrefix))
+			if err != nil {
+				return nil, nil, false, fmt.Errorf("%s line %d: %w", filepath.Base(path), line, err)
+			}
+			strategies[valuePath] = strategy
+			continue
+		}
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" {
+			continue
+		}
+		dir, err := expandPath(text, lookup)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("%s line %d: %w", filepath.Base(path), line, err)
+		}
+		dirs = append(dirs, dir)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, false, err
+	}
+	return dirs, strategies, substitute, nil
+}
+
+// parseDirective parses the directive text, without prefix, e.g.
+// "list-merge env append".
+func parseDirective(text string) (string, ListStrategy, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 3 || fields[0] != "list-merge" {
+		return "", "", fmt.Errorf("invalid directive %q; expected list-merge <path> <strategy> or substitute-values", text)
+	}
+	strategy, err := ParseListStrategy(fields[2])
+	return fields[1], strategy, err
+}
+
+// expandPath substitutes the variables in the directory path. Undefined
+// variables are an error, as they would silently select another directory.
+func expandPath(path string, lookup func(string) (string, bool)) (string, error) {
+	missing := []string{}
+	expanded := os.Expand(path, func(name string) string {
+		value, ok := lookup(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variables %s in directory %q", strings.Join(missing, ", "), path)
+	}
+	return expanded, nil
+}
+
+// yamlFiles returns the YAML files of dir, sorted by name.
+func yamlFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parameter directory: %w", err)
+	}
+	files := []string{}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// readDocuments returns the non-empty YAML documents of file.
+func readDocuments(file string) ([]map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(content)))
+	docs := []map[string]interface{}{}
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var values map[string]interface{}
+		if err := yaml.Unmarshal(doc, &values); err != nil {
+			return nil, err
+		}
+		if values != nil {
+			docs = append(docs, values)
+		}
+	}
+}
+
+// merger merges values, recording which file set each of them.
+type merger struct {
+	strategies map[string]ListStrategy
+	sources    map[string]string
+}
+
+// indexPattern matches the list indexes of the paths of the values, which
+// are ignored when looking up the strategy of a list.
+var indexPattern = regexp.MustCompile(`\[\d+\]`)
+
+func (m *merger) strategy(path string) ListStrategy {
+	if strategy, ok := m.strategies[indexPattern.ReplaceAllString(path, "")]; ok {
+		return strategy
+	}
+	if strategy, ok := m.strategies["*"]; ok {
+		return strategy
+	}
+	return ListReplace
+}
+
+// merge returns src merged into dst, where src comes from file. dst may be
+// modified.
+func (m *merger) merge(dst, src interface{}, path, file string) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			return m.replace(s, path, file)
+		}
+		for key, value := range s {
+			d[key] = m.merge(d[key], value, keyPath(path, key), file)
+		}
+		return d
+	case []interface{}:
+		d, ok := dst.([]interface{})
+		if !ok {
+			return m.replace(s, path, file)
+		}
+		return m.mergeList(d, s, path, file)
+	default:
+		return m.replace(src, path, file)
+	}
+}
+
+func (m *merger) mergeList(dst, src []interface{}, path, file string) interface{} {
+	strategy := m.strategy(path)
+	key := strings.TrimPrefix(string(strategy), listMergeByPrefix)
+	if strategy == ListReplace {
+		return m.replace(src, path, file)
+	}
+	for _, item := range src {
+		switch {
+		case strategy == ListAppendUnique && indexOf(dst, item) >= 0:
+			continue
+		case strategy != ListAppend && strategy != ListAppendUnique:
+			if i := indexByKey(dst, item, key); i >= 0 {
+				dst[i] = m.merge(dst[i], item, indexPath(path, i), file)
+				continue
+			}
+		}
+		m.record(item, indexPath(path, len(dst)), file)
+		dst = append(dst, item)
+	}
+	return dst
+}
+
+// replace records that value, from file, replaces the value at path.
+func (m *merger) replace(value interface{}, path, file string) interface{} {
+	for p := range m.sources {
+		if p == path || strings.HasPrefix(p, path+".") || strings.HasPrefix(p, path+"[") {
+			delete(m.sources, p)
+		}
+	}
+	m.record(value, path, file)
+	return value
+}
+
+// record sets file as the source of value and the values it contains.
+func (m *merger) record(value interface{}, path, file string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			m.sources[path] = file
+		}
+		for key, item := range v {
+			m.record(item, keyPath(path, key), file)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			m.sources[path] = file
+		}
+		for i, item := range v {
+			m.record(item, indexPath(path, i), file)
+		}
+	default:
+		m.sources[path] = file
+	}
+}
+
+func keyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func indexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+func indexOf(list []interface{}, item interface{}) int {
+	for i := range list {
+		if reflect.DeepEqual(list[i], item) {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexByKey returns the index of the map in list having the same value for
+// key as item, or -1.
+func indexByKey(list []interface{}, item interface{}, key string) int {
+	fields, ok := item.(map[string]interface{})
+	if !ok {
+		return -1
+	}
+	value, ok := fields[key]
+	if !ok {
+		return -1
+	}
+	for i := range list {
+		if other, ok := list[i].(map[string]interface{}); ok && reflect.DeepEqual(other[key], value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// variablePattern matches the ${NAME} references in the values; the $NAME
+// form isn't substituted, to leave alone the values using $ for other
+// purposes.
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// substituteValues substitutes the defined variables in the string values
+// contained in value. The references to undefined variables are kept.
+func substituteValues(value interface{}, lookup func(string) (string, bool)) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = substituteValues(item, lookup)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = substituteValues(item, lookup)
+		}
+	case string:
+		return variablePattern.ReplaceAllStringFunc(v, func(ref string) string {
+			if value, ok := lookup(ref[2 : len(ref)-1]); ok {
+				return value
+			}
+			return ref
+		})
+	}
+	return value
+}
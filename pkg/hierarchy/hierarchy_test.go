@@ -0,0 +1,229 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hierarchy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "hierarchy-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func parse(t *testing.T, text string) map[string]interface{} {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(text), &values); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestMergeExample(t *testing.T) {
+	result, err := Merge("../../examples/hello-world-hierarchy/demo", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Values["namespace"] != "eunomia-hello-world-demo-hierarchy" || result.Values["appname"] != "hello-world-hierarchy" || result.Values["imageTag"] != "1.0" {
+		t.Errorf("unexpected values %v", result.Values)
+	}
+	wantFiles := []string{"../default/values.yaml", "../empty/values.yaml", "../level2/values.yaml", "values.yaml"}
+	if !reflect.DeepEqual(result.Files, wantFiles) {
+		t.Errorf("expected files %v, got %v", wantFiles, result.Files)
+	}
+	wantSources := map[string]string{
+		"namespace":       "../level2/values.yaml",
+		"appname":         "values.yaml",
+		"service.enabled": "../default/values.yaml",
+	}
+	for path, want := range wantSources {
+		if got := result.Sources[path]; got != want {
+			t.Errorf("expected %s to come from %s, got %s", path, want, got)
+		}
+	}
+}
+
+func TestMergeListStrategies(t *testing.T) {
+	files := map[string]string{
+		"app/hierarchy.lst": "#@list-merge env merge-by:name\n#@list-merge tags append-unique\n../defaults # lowest priority\n./\n",
+		"defaults/values.yaml": `
+env: [{name: A, value: "1"}, {name: B, value: "2"}]
+tags: [a, b]
+ports: [80]
+hosts: [x]
+`,
+		"app/values.yaml": `
+env: [{name: B, value: "3"}, {name: C, value: "4"}]
+tags: [b, c]
+ports: [443]
+hosts: [y]
+`,
+	}
+	tests := []struct {
+		comment    string
+		strategies map[string]ListStrategy
+		want       string
+	}{
+		{
+			"directives",
+			nil,
+			`{env: [{name: A, value: "1"}, {name: B, value: "3"}, {name: C, value: "4"}], tags: [a, b, c], ports: [443], hosts: [y]}`,
+		},
+		{
+			"options override directives and set the default",
+			map[string]ListStrategy{"tags": ListReplace, "*": ListAppend},
+			`{env: [{name: A, value: "1"}, {name: B, value: "3"}, {name: C, value: "4"}], tags: [b, c], ports: [80, 443], hosts: [x, y]}`,
+		},
+	}
+	for _, tt := range tests {
+		dir := writeFiles(t, files)
+		defer os.RemoveAll(dir)
+		result, err := Merge(filepath.Join(dir, "app"), Options{ListStrategies: tt.strategies})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.comment, err)
+		}
+		if want := parse(t, tt.want); !reflect.DeepEqual(result.Values, want) {
+			t.Errorf("%s: expected %v, got %v", tt.comment, want, result.Values)
+		}
+	}
+}
+
+func TestMergeSources(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app/hierarchy.lst":    "#@list-merge env merge-by:name\n../defaults\n./\n",
+		"defaults/values.yaml": "env: [{name: A, value: '1'}]\nhosts: [x, z]\nservice: {port: 80, tls: {enabled: true}}\n",
+		"app/values.yaml":      "env: [{name: A, value: '2'}, {name: B, value: '3'}]\nhosts: [y]\nservice: {tls: false}\n",
+	})
+	defer os.RemoveAll(dir)
+	result, err := Merge(filepath.Join(dir, "app"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"env[0].name":  "values.yaml",
+		"env[0].value": "values.yaml",
+		"env[1].name":  "values.yaml",
+		"env[1].value": "values.yaml",
+		"hosts[0]":     "values.yaml",
+		"service.port": "../defaults/values.yaml",
+		"service.tls":  "values.yaml",
+	}
+	if !reflect.DeepEqual(result.Sources, want) {
+		t.Errorf("expected sources %v, got %v", want, result.Sources)
+	}
+	out := &bytes.Buffer{}
+	if err := result.Provenance(out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "hosts[0]\tvalues.yaml\nservice.port\t../defaults/values.yaml\n") {
+		t.Errorf("unexpected provenance %q", out.String())
+	}
+}
+
+func TestMergeVariables(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app/hierarchy.lst":    "../defaults\n../${PROJECT}\n",
+		"app/substituted.lst":  "#@substitute-values\n../defaults\n../${PROJECT}\n",
+		"defaults/values.yaml": "host: ${PROJECT}.${DOMAIN}\nprice: $5\n",
+		"team1/values.yml":     "replicas: 2\n",
+		"team2/values.yml":     "replicas: 3\n",
+		"app/README.md":        "not a parameter file\n",
+	})
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "app")
+	variables := map[string]string{"PROJECT": "team1"}
+
+	result, err := Merge(base, Options{Variables: variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := parse(t, `{host: "${PROJECT}.${DOMAIN}", price: "$5", replicas: 2}`)
+	if !reflect.DeepEqual(result.Values, want) {
+		t.Errorf("expected the values not to be substituted by default, got %v", result.Values)
+	}
+
+	substituted := parse(t, `{host: "team1.${DOMAIN}", price: "$5", replicas: 2}`)
+	result, err = Merge(base, Options{Variables: variables, SubstituteValues: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Values, substituted) {
+		t.Errorf("expected %v with the option, got %v", substituted, result.Values)
+	}
+	result, err = Merge(base, Options{File: "substituted.lst", Variables: variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Values, substituted) {
+		t.Errorf("expected %v with the directive, got %v", substituted, result.Values)
+	}
+
+	// The environment isn't used
+	os.Setenv("PROJECT", "team2")
+	defer os.Unsetenv("PROJECT")
+	if _, err := Merge(base, Options{}); err == nil || !strings.Contains(err.Error(), "undefined variables PROJECT") {
+		t.Errorf("expected an error for the undefined variable, got %v", err)
+	}
+}
+
+func TestMergeWithoutHierarchy(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.yaml": "x: 1\ny: [1]\n---\ny: [2]\n",
+		"b.yaml": "x: 2\n",
+	})
+	defer os.RemoveAll(dir)
+	result, err := Merge(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := parse(t, "{x: 2, y: [2]}"); !reflect.DeepEqual(result.Values, want) {
+		t.Errorf("expected %v, got %v", want, result.Values)
+	}
+}
+
+func TestInvalidStrategies(t *testing.T) {
+	for _, text := range []string{"merge", "merge-by:", "prepend"} {
+		if _, err := ParseListStrategy(text); err == nil {
+			t.Errorf("expected %q to be invalid", text)
+		}
+	}
+	dir := writeFiles(t, map[string]string{"hierarchy.lst": "#@list-merge env\n./\n"})
+	defer os.RemoveAll(dir)
+	if _, err := Merge(dir, Options{}); err == nil || !strings.Contains(err.Error(), "hierarchy.lst line 1") {
+		t.Errorf("expected an error for the invalid directive, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package imagepolicy restricts the images which the jobs of GitOpsConfigs
+// can run, e.g. the template processor images.
+package imagepolicy
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var log = logf.Log.WithName("imagepolicy").WithValues("filename", "imagepolicy.go")
+
+// digestPattern matches the digest of an image reference.
+var digestPattern = regexp.MustCompile(`@sha256:[a-f0-9]{64}$`)
+
+// Policy restricts the images allowed in the jobs.
+type Policy struct {
+	// AllowedRepositories are the registries (e.g. "quay.io"), repository
+	// prefixes (e.g. "quay.io/kohlstechnology") and repositories (e.g.
+	// "quay.io/kohlstechnology/eunomia-helm") of the allowed images. Docker
+	// Hub images are matched on their full name, e.g.
+	// "docker.io/library/alpine". If empty, all repositories are allowed.
+	AllowedRepositories []string `json:"allowedRepositories,omitempty"`
+	// RequireDigest rejects the images not referenced by digest, e.g.
+	// "quay.io/kohlstechnology/eunomia-helm@sha256:...".
+	RequireDigest bool `json:"requireDigest,omitempty"`
+}
+
+// globalPolicy is the policy enforced by the operator, nil if any image is
+// allowed.
+var globalPolicy *Policy
+
+// InitializeGlobalPolicy reads the policy enforced by the operator from a
+// YAML file. It must be called at controller boot time, before any image is
+// checked.
+func InitializeGlobalPolicy(fileName string) error {
+	text, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		log.Error(err, "error reading image policy file", "filename", fileName)
+		return fmt.Errorf("error reading image policy file %q: %w", fileName, err)
+	}
+	policy := &Policy{}
+	err = yaml.Unmarshal(text, policy)
+	if err != nil {
+		log.Error(err, "error parsing image policy file", "filename", fileName)
+		return fmt.Errorf("error parsing image policy file %q: %w", fileName, err)
+	}
+	SetGlobalPolicy(policy)
+	return nil
+}
+
+// SetGlobalPolicy sets the policy enforced by the operator; nil allows any
+// image. It must be called at controller boot time, before any image is
+// checked.
+func SetGlobalPolicy(policy *Policy) {
+	globalPolicy = policy
+}
+
+// Check returns an error explaining why image isn't allowed by the policy
+// enforced by the operator, or nil if it's allowed.
+func Check(image string) error {
+	return globalPolicy.Check(image)
+}
+
+// CheckPod returns an error explaining why one of the images of the
+// containers of spec isn't allowed by the policy enforced by the operator, or
+// nil if they're all allowed.
+func CheckPod(spec *corev1.PodSpec) error {
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, container := range containers {
+		err := Check(container.Image)
+		if err != nil {
+			return fmt.Errorf("container %q: %w", container.Name, err)
+		}
+	}
+	return nil
+}
+
+// Check returns an error explaining why image isn't allowed by p, or nil if
+// it's allowed. A nil policy allows any image.
+func (p *Policy) Check(image string) error {
+	if p == nil {
+		return nil
+	}
+	if image == "" {
+		return errors.New("no image")
+	}
+	if p.RequireDigest && !digestPattern.MatchString(image) {
+		return fmt.Errorf("image %q is not referenced by digest", image)
+	}
+	if len(p.AllowedRepositories) == 0 {
+		return nil
+	}
+	repo := repository(image)
+	for _, allowed := range p.AllowedRepositories {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if repo == allowed || strings.HasPrefix(repo, allowed+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %q is not from an allowed repository", image)
+}
+
+// repository returns the full name of the repository of image, without its
+// tag or digest, e.g. "docker.io/library/alpine" for "alpine:3.12".
+func repository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// A colon after the last slash starts the tag, while a colon before is
+	// the port of the registry
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return "docker.io/library/" + image
+	}
+	if !strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost" {
+		return "docker.io/" + image
+	}
+	return image
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagepolicy
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRepository(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"alpine", "docker.io/library/alpine"},
+		{"alpine:3.12", "docker.io/library/alpine"},
+		{"bitnami/kubectl:1.17", "docker.io/bitnami/kubectl"},
+		{"quay.io/kohlstechnology/eunomia-helm:latest", "quay.io/kohlstechnology/eunomia-helm"},
+		{"registry.local:5000/eunomia/base", "registry.local:5000/eunomia/base"},
+		{"localhost/base:dev", "localhost/base"},
+		{"quay.io/kohlstechnology/eunomia-base@sha256:" + strings.Repeat("a", 64), "quay.io/kohlstechnology/eunomia-base"},
+	}
+	for _, tt := range tests {
+		if got := repository(tt.image); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.image, tt.want, got)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	digest := "@sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		name    string
+		policy  *Policy
+		image   string
+		allowed bool
+	}{
+		{"no policy", nil, "anything", true},
+		{"registry", &Policy{AllowedRepositories: []string{"quay.io"}}, "quay.io/kohlstechnology/eunomia-helm:latest", true},
+		{"prefix", &Policy{AllowedRepositories: []string{"quay.io/kohlstechnology/"}}, "quay.io/kohlstechnology/eunomia-helm:latest", true},
+		{"partial segment", &Policy{AllowedRepositories: []string{"quay.io/kohls"}}, "quay.io/kohlstechnology/eunomia-helm:latest", false},
+		{"other registry", &Policy{AllowedRepositories: []string{"quay.io"}}, "quay.io.evil.com/eunomia-helm", false},
+		{"docker hub", &Policy{AllowedRepositories: []string{"docker.io/library"}}, "alpine:3.12", true},
+		{"digest required", &Policy{RequireDigest: true}, "quay.io/kohlstechnology/eunomia-helm:latest", false},
+		{"digest", &Policy{RequireDigest: true, AllowedRepositories: []string{"quay.io"}}, "quay.io/kohlstechnology/eunomia-helm" + digest, true},
+		{"tag and digest", &Policy{RequireDigest: true}, "quay.io/kohlstechnology/eunomia-helm:v1" + digest, true},
+		{"no image", &Policy{}, "", false},
+	}
+	for _, tt := range tests {
+		err := tt.policy.Check(tt.image)
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s: expected allowed %v, got %v", tt.name, tt.allowed, err)
+		}
+	}
+}
+
+func TestInitializeGlobalPolicy(t *testing.T) {
+	defer SetGlobalPolicy(nil)
+	file, err := ioutil.TempFile("", "image-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("allowedRepositories:\n- quay.io/kohlstechnology\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if err := InitializeGlobalPolicy(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &corev1.PodSpec{
+		InitContainers: []corev1.Container{{Name: "init", Image: "quay.io/kohlstechnology/eunomia-base"}},
+		Containers:     []corev1.Container{{Name: "template-processor", Image: "quay.io/kohlstechnology/eunomia-helm"}},
+	}
+	if err := CheckPod(spec); err != nil {
+		t.Errorf("expected the pod to be allowed, got %v", err)
+	}
+	spec.InitContainers[0].Image = "alpine"
+	if err := CheckPod(spec); err == nil || !strings.Contains(err.Error(), `"init"`) {
+		t.Errorf("expected the init container to be rejected, got %v", err)
+	}
+
+	if err := InitializeGlobalPolicy("missing.yaml"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
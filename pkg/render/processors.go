@@ -0,0 +1,189 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// environment holds the paths which the processTemplates.sh scripts of the
+// template processor images get from environment variables.
+type environment struct {
+	config       *gitopsv1alpha1.GitOpsConfig
+	templateDir  string // CLONED_TEMPLATE_GIT_DIR
+	parameterDir string // CLONED_PARAMETER_GIT_DIR
+	valuesFile   string // /tmp/eunomia_values_processed.yaml
+	manifestDir  string // MANIFEST_DIR
+}
+
+// namespace returns the value of NAMESPACE in the job.
+func (e *environment) namespace() string {
+	if e.config.Spec.TargetNamespace != "" {
+		return e.config.Spec.TargetNamespace
+	}
+	if e.config.Namespace != "" {
+		return e.config.Namespace
+	}
+	return "default"
+}
+
+// processorArgs returns TEMPLATE_PROCESSOR_ARGS split in words, like the
+// unquoted expansion in the scripts.
+func (e *environment) processorArgs() []string {
+	return strings.Fields(e.config.Spec.TemplateProcessorArgs)
+}
+
+// variables returns the environment variables set in the job.
+func (e *environment) variables() map[string]string {
+	return map[string]string{
+		"NAMESPACE":                e.namespace(),
+		"GITOPSCONFIG_NAME":        e.config.Name,
+		"TEMPLATE_PROCESSOR_ARGS":  e.config.Spec.TemplateProcessorArgs,
+		"CLONED_TEMPLATE_GIT_DIR":  e.templateDir,
+		"CLONED_PARAMETER_GIT_DIR": e.parameterDir,
+		"MANIFEST_DIR":             e.manifestDir,
+	}
+}
+
+// vars returns the environment of the commands, i.e. the current
+// environment with the variables set in the job.
+func (e *environment) vars() []string {
+	vars := os.Environ()
+	for name, value := range e.variables() {
+		vars = append(vars, name+"="+value)
+	}
+	return vars
+}
+
+// command returns a command running in the job's environment, whose output
+// is written to stdout.
+func (e *environment) command(stdout io.Writer, name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Env = e.vars()
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// processors reproduce the processTemplates.sh scripts of the template
+// processor images, writing the manifests to manifestDir. The processors
+// applying the resources themselves are nil.
+var processors = map[string]func(*environment) error{
+	"base":                processBase,
+	"helm":                processHelm,
+	"jinja":               processJinja,
+	"ocp-template":        processOCPTemplate,
+	"applier":             nil,
+	"openshift-provision": nil,
+}
+
+// processBase copies the templates as they are.
+func processBase(e *environment) error {
+	return filepath.Walk(e.templateDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(e.templateDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(e.manifestDir, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, content, 0644)
+	})
+}
+
+// processHelm renders the Helm chart in templateDir with the merged
+// parameters as values.
+func processHelm(e *environment) error {
+	args := []string{"template", "-f", e.valuesFile}
+	args = append(args, e.processorArgs()...)
+	args = append(args, "--output-dir", e.manifestDir, "--namespace", e.namespace(), e.templateDir)
+	if err := e.command(os.Stderr, "helm", args...).Run(); err != nil {
+		return fmt.Errorf("helm failed: %w", err)
+	}
+	return nil
+}
+
+// processJinja renders each *.j2 file in templateDir with the merged
+// parameters, to a file named without the extension.
+func processJinja(e *environment) error {
+	templates, err := filepath.Glob(filepath.Join(e.templateDir, "*.j2"))
+	if err != nil {
+		return err
+	}
+	for _, template := range templates {
+		name := strings.TrimSuffix(filepath.Base(template), filepath.Ext(template))
+		if err := e.runToFile(filepath.Join(e.manifestDir, name), "j2", template, e.valuesFile, "--import-env", "env"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processOCPTemplate processes the OpenShift template.yaml in templateDir
+// with parameters.ini, after substituting the environment variables in it.
+func processOCPTemplate(e *environment) error {
+	parameters, err := ioutil.ReadFile(filepath.Join(e.parameterDir, "parameters.ini"))
+	if err != nil {
+		return err
+	}
+	vars := map[string]string{}
+	for _, v := range e.vars() {
+		if i := strings.Index(v, "="); i > 0 {
+			vars[v[:i]] = v[i+1:]
+		}
+	}
+	substituted := os.Expand(string(parameters), func(name string) string { return vars[name] })
+	paramFile := filepath.Join(filepath.Dir(e.valuesFile), "parameters_subst.ini")
+	if err := ioutil.WriteFile(paramFile, []byte(substituted), 0644); err != nil {
+		return err
+	}
+	args := []string{"process", "-f", filepath.Join(e.templateDir, "template.yaml"), "--param-file=" + paramFile}
+	args = append(args, e.processorArgs()...)
+	return e.runToFile(filepath.Join(e.manifestDir, "manifests.yaml"), "oc", args...)
+}
+
+// runToFile runs a command, writing its output to path.
+func (e *environment) runToFile(path, name string, args ...string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := e.command(out, name, args...).Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render reproduces locally the pipeline of the create jobs of
+// GitOpsConfigs: the parameters are merged according to hierarchy.lst, the
+// templates are processed by the template processor of the GitOpsConfig, and
+// the owner and applied labels are added to the resulting resources. Nothing
+// is sent to a cluster.
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5" //nolint:gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/hierarchy"
+	"github.com/ghodss/yaml"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// OwnerLabel holds the OwnerLabelValue of the GitOpsConfig owning a
+	// resource.
+	OwnerLabel = "gitopsconfig.eunomia.kohls.io/owner"
+	// AppliedLabel holds the Unix time of the job which last applied a
+	// resource.
+	AppliedLabel = "gitopsconfig.eunomia.kohls.io/applied"
+
+	// valuesFile is the name of the file holding the merged parameters, as
+	// in the jobs.
+	valuesFile = "eunomia_values_processed.yaml"
+)
+
+// manifestFile matches the names of the files handled by the resource
+// manager of the jobs.
+var manifestFile = regexp.MustCompile(`(?i)\.(ya?ml|json)$`)
+
+// OwnerLabelValue returns the value of the owner label of the resources of
+// the GitOpsConfig name in namespace. Label values must start and end with an
+// alphanumeric character and be at most 63 characters long, so it's the MD5
+// hash of the names, between "own." and ".own", as computed by the previous
+// shell scripts (echo "$NAMESPACE $GITOPSCONFIG_NAME" | md5sum).
+func OwnerLabelValue(namespace, name string) string {
+	sum := md5.Sum([]byte(namespace + " " + name + "\n")) //nolint:gosec
+	return "own." + hex.EncodeToString(sum[:]) + ".own"
+}
+
+// Options configures a render.
+type Options struct {
+	// Config is the GitOpsConfig to render.
+	Config *gitopsv1alpha1.GitOpsConfig
+	// TemplateDir and ParameterDir are local checkouts of the template and
+	// parameter repositories; the contextDirs of the sources of Config are
+	// relative to them.
+	TemplateDir  string
+	ParameterDir string
+	// Processor overrides the template processor selected from the image of
+	// Config, e.g. "helm".
+	Processor string
+	// Timestamp is the value of the applied label. Default is the current
+	// Unix time.
+	Timestamp string
+	// MergeParameters merges the parameters in dir according to its
+	// hierarchy.lst, and returns the result as YAML. Default is
+	// hierarchy.Merge, with the environment variables of the jobs.
+	MergeParameters func(dir string) ([]byte, error)
+}
+
+// Manifest is a rendered file.
+type Manifest struct {
+	// Path of the file, relative to the manifest directory of the job
+	Path string
+	// Content holds the labeled resources of the file, as YAML documents
+	Content []byte
+}
+
+// Render runs the pipeline of a create job for options.Config, and returns
+// the manifests which the job would apply, sorted by path.
+func Render(options Options) ([]Manifest, error) {
+	config := options.Config
+	processorName := options.Processor
+	if processorName == "" {
+		processorName = ProcessorForImage(config.Spec.TemplateProcessorImage)
+	}
+	process, ok := processors[processorName]
+	if !ok {
+		return nil, fmt.Errorf("unknown template processor %q", processorName)
+	}
+	if process == nil {
+		return nil, fmt.Errorf("template processor %q applies the resources itself and can't be rendered", processorName)
+	}
+
+	workDir, err := ioutil.TempDir("", "eunomia-render-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	env := &environment{
+		config:       config,
+		templateDir:  filepath.Join(options.TemplateDir, config.Spec.TemplateSource.ContextDir),
+		parameterDir: filepath.Join(options.ParameterDir, config.Spec.ParameterSource.ContextDir),
+		valuesFile:   filepath.Join(workDir, valuesFile),
+		manifestDir:  filepath.Join(workDir, "manifests"),
+	}
+	if info, err := os.Stat(env.templateDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("template directory %s does not exist", env.templateDir)
+	}
+	if err := os.Mkdir(env.manifestDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the manifest directory: %w", err)
+	}
+
+	merge := options.MergeParameters
+	if merge == nil {
+		merge = func(dir string) ([]byte, error) {
+			result, err := hierarchy.Merge(dir, hierarchy.Options{Variables: env.variables()})
+			if err != nil {
+				return nil, err
+			}
+			return result.YAML()
+		}
+	}
+	values, err := merge(env.parameterDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge the parameters in %s: %w", env.parameterDir, err)
+	}
+	if err := ioutil.WriteFile(env.valuesFile, values, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write the merged parameters: %w", err)
+	}
+
+	if err := process(env); err != nil {
+		return nil, fmt.Errorf("template processor %s failed: %w", processorName, err)
+	}
+
+	timestamp := options.Timestamp
+	if timestamp == "" {
+		timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	return collectManifests(env.manifestDir, OwnerLabelValue(config.Namespace, config.Name), timestamp)
+}
+
+// collectManifests reads the YAML and JSON files in dir, and adds the owner
+// and applied labels to the resources they contain.
+func collectManifests(dir, owner, timestamp string) ([]Manifest, error) {
+	manifests := []Manifest{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !manifestFile.MatchString(info.Name()) {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		labeled, err := AddLabels(content, owner, timestamp)
+		if err != nil {
+			return fmt.Errorf("failed to label the resources in %s: %w", path, err)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, Manifest{Path: filepath.ToSlash(rel), Content: labeled})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Path < manifests[j].Path })
+	return manifests, nil
+}
+
+// AddLabels sets the owner and applied labels on each resource of the YAML
+// or JSON documents in content, and returns them as YAML documents. Empty
+// documents are dropped.
+func AddLabels(content []byte, owner, timestamp string) ([]byte, error) {
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(content)))
+	result := &bytes.Buffer{}
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var resource map[string]interface{}
+		if err := yaml.Unmarshal(doc, &resource); err != nil {
+			return nil, err
+		}
+		if resource == nil {
+			continue
+		}
+		metadata, ok := resource["metadata"].(map[string]interface{})
+		if !ok {
+			metadata = map[string]interface{}{}
+			resource["metadata"] = metadata
+		}
+		labels, ok := metadata["labels"].(map[string]interface{})
+		if !ok {
+			labels = map[string]interface{}{}
+			metadata["labels"] = labels
+		}
+		labels[OwnerLabel] = owner
+		labels[AppliedLabel] = timestamp
+		out, err := yaml.Marshal(resource)
+		if err != nil {
+			return nil, err
+		}
+		if result.Len() > 0 {
+			result.WriteString("---\n")
+		}
+		result.Write(out)
+	}
+	return result.Bytes(), nil
+}
+
+// ProcessorForImage returns the name of the template processor built into
+// image, e.g. "helm" for "quay.io/kohlstechnology/eunomia-helm:latest".
+// Images not built by Eunomia are assumed to extend the base processor.
+func ProcessorForImage(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	switch name = strings.TrimPrefix(name, "eunomia-"); name {
+	case "ocp-templates":
+		return "ocp-template"
+	case "helm", "jinja", "applier", "openshift-provision":
+		return name
+	default:
+		return "base"
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRenderBase(t *testing.T) {
+	repo, err := ioutil.TempDir("", "render-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	writeFiles(t, repo, map[string]string{
+		"templates/app.yaml":           "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n  labels:\n    app: hello\n---\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: app\n",
+		"templates/nested/secret.json": `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "app"}}`,
+		"templates/README.md":          "not a manifest",
+		"parameters/values.yaml":       "replicas: 1\n",
+	})
+	config := &gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello", Namespace: "team"},
+		Spec: gitopsv1alpha1.GitOpsConfigSpec{
+			TemplateSource:         gitopsv1alpha1.GitConfig{ContextDir: "templates"},
+			ParameterSource:        gitopsv1alpha1.GitConfig{ContextDir: "parameters"},
+			TemplateProcessorImage: "quay.io/kohlstechnology/eunomia-base:latest",
+		},
+	}
+	mergedDir := ""
+	manifests, err := Render(Options{
+		Config:       config,
+		TemplateDir:  repo,
+		ParameterDir: repo,
+		Timestamp:    "1600000000",
+		MergeParameters: func(dir string) ([]byte, error) {
+			mergedDir = dir
+			return []byte("replicas: 1\n"), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mergedDir != filepath.Join(repo, "parameters") {
+		t.Errorf("expected the parameters in %s to be merged, got %s", filepath.Join(repo, "parameters"), mergedDir)
+	}
+	if len(manifests) != 2 || manifests[0].Path != "app.yaml" || manifests[1].Path != "nested/secret.json" {
+		t.Fatalf("expected app.yaml and nested/secret.json, got %v", manifests)
+	}
+	app := string(manifests[0].Content)
+	if strings.Count(app, "---") != 1 || strings.Count(app, OwnerLabel+": "+OwnerLabelValue("team", "hello")) != 2 || strings.Count(app, AppliedLabel+`: "1600000000"`) != 2 {
+		t.Errorf("expected 2 labeled resources, got:\n%s", app)
+	}
+	if !strings.Contains(app, "app: hello") {
+		t.Errorf("expected the existing labels to be kept, got:\n%s", app)
+	}
+	if !strings.Contains(string(manifests[1].Content), "kind: Secret") {
+		t.Errorf("expected the JSON resource to be converted to YAML, got:\n%s", manifests[1].Content)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	config := &gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello"},
+		Spec:       gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{ContextDir: "missing"}},
+	}
+	tests := []struct {
+		comment   string
+		processor string
+		want      string
+	}{
+		{"unknown processor", "kustomize", "unknown template processor"},
+		{"applying processor", "applier", "can't be rendered"},
+		{"missing template directory", "base", "does not exist"},
+	}
+	for _, tt := range tests {
+		_, err := Render(Options{Config: config, TemplateDir: os.TempDir(), Processor: tt.processor})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.comment, tt.want, err)
+		}
+	}
+}
+
+func TestProcessorForImage(t *testing.T) {
+	tests := map[string]string{
+		"quay.io/kohlstechnology/eunomia-helm:latest":          "helm",
+		"quay.io/kohlstechnology/eunomia-ocp-templates:v0.1.0": "ocp-template",
+		"localhost:5000/eunomia-jinja@sha256:0123":             "jinja",
+		"eunomia-applier": "applier",
+		"quay.io/kohlstechnology/eunomia-base:latest":    "base",
+		"registry.example.com/team/custom-processor:1.0": "base",
+		"": "base",
+	}
+	for image, want := range tests {
+		if got := ProcessorForImage(image); got != want {
+			t.Errorf("%q: expected %s, got %s", image, want, got)
+		}
+	}
+}
+
+func TestOwnerLabelValue(t *testing.T) {
+	tests := []struct {
+		namespace string
+		name      string
+		want      string
+	}{
+		// echo "$NAMESPACE $GITOPSCONFIG_NAME" | md5sum
+		{"team", "app", "own.0f30320e9036258f169295d6b551f14f.own"},
+		{"my-namespace", "my-gitopsconfig", "own.2e98695355a70af1f2a7c9f2416c2c84.own"},
+	}
+	for _, tt := range tests {
+		if got := OwnerLabelValue(tt.namespace, tt.name); got != tt.want {
+			t.Errorf("OwnerLabelValue(%q, %q) = %q, want %q", tt.namespace, tt.name, got, tt.want)
+		}
+	}
+}
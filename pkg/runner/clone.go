@@ -0,0 +1,135 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// clone clones source at its ref, which can be a branch, a tag or a commit
+// SHA (e.g. a revision requested through the trigger endpoint), or at its
+// default branch without ref, and updates its submodules.
+func (r *Runner) clone(ctx context.Context, source Source) error {
+	r.Log.Info("Cloning repository", "uri", source.URI, "ref", source.Ref, "dir", source.Dir)
+	env, err := r.gitEnvironment(source)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(source.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", source.Dir, err)
+	}
+
+	// A shallow clone only works for branches and tags
+	args := []string{"clone", "--depth", "1", "--shallow-submodules"}
+	if source.Ref != "" {
+		args = append(args, "-b", source.Ref)
+	}
+	err = r.run(ctx, "", env, "git", append(args, "--", source.URI, source.Dir)...)
+	if err != nil && source.Ref != "" {
+		r.Log.Info("Shallow clone failed, cloning the whole repository", "uri", source.URI, "ref", source.Ref)
+		if err := emptyDir(source.Dir); err != nil {
+			return fmt.Errorf("failed to clean up %s: %w", source.Dir, err)
+		}
+		if err := r.run(ctx, "", env, "git", "clone", "--", source.URI, source.Dir); err != nil {
+			return err
+		}
+		if err := r.run(ctx, source.Dir, env, "git", "checkout", source.Ref); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err := r.run(ctx, source.Dir, env, "git", "submodule", "init"); err != nil {
+		return err
+	}
+	return r.run(ctx, source.Dir, env, "git", "submodule", "update", "--recursive", "--remote")
+}
+
+// gitEnvironment copies the files of the gitconfig Secret of source to the
+// home directory, and returns the environment variables setting the proxies
+// of source. Without gitconfig Secret, TLS certificates aren't verified.
+func (r *Runner) gitEnvironment(source Source) ([]string, error) {
+	env := []string{}
+	if source.HTTPProxy != "" {
+		env = append(env, "http_proxy="+source.HTTPProxy)
+	}
+	if source.HTTPSProxy != "" {
+		env = append(env, "https_proxy="+source.HTTPSProxy)
+	}
+	if source.NOProxy != "" {
+		env = append(env, "no_proxy="+source.NOProxy)
+	}
+	if info, err := os.Stat(source.GitConfig); source.GitConfig == "" || err != nil || !info.IsDir() {
+		return append(env, "GIT_SSL_NO_VERIFY=true"), nil
+	}
+	if err := copyGitConfig(source.GitConfig, r.Config.Home); err != nil {
+		return nil, fmt.Errorf("failed to copy the git configuration from %s: %w", source.GitConfig, err)
+	}
+	return env, nil
+}
+
+// copyGitConfig copies the files of the Secret mounted at dir to home. The
+// "..data" directories and links created by Kubernetes are skipped.
+func copyGitConfig(dir, home string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "..") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Secret files are links to the ..data directory
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// ssh refuses private keys readable by others
+		if err := ioutil.WriteFile(filepath.Join(home, entry.Name()), content, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emptyDir removes the content of dir.
+func emptyDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyGitConfig(t *testing.T) {
+	secret, err := ioutil.TempDir("", "runner-secret-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(secret)
+	home, err := ioutil.TempDir("", "runner-home-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	// Mimic the layout of a mounted Secret
+	data := filepath.Join(secret, "..2021_01_01")
+	if err := os.Mkdir(data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(data, ".gitconfig"), []byte("[http]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Base(data), filepath.Join(secret, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..data", ".gitconfig"), filepath.Join(secret, ".gitconfig")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyGitConfig(secret, home); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ioutil.ReadDir(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != ".gitconfig" {
+		t.Fatalf("expected only .gitconfig to be copied, got %v", entries)
+	}
+	if entries[0].Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", entries[0].Mode().Perm())
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runner
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// cluster holds the clients of the cluster in which the resources are
+// managed.
+type cluster struct {
+	client dynamic.Interface
+	mapper meta.RESTMapper
+	// resources returns the types of resources which can be listed and
+	// deleted.
+	resources func() ([]resourceType, error)
+}
+
+// kube returns the clients of the cluster, built from the kubeconfig written
+// by prepareEnvironment.
+func (r *Runner) kube() (*cluster, error) {
+	if r.cluster != nil {
+		return r.cluster()
+	}
+	cfg, err := clientcmd.BuildConfigFromFlags("", filepath.Join(r.Config.Home, ".kube", "config"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the kubeconfig: %w", err)
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the Kubernetes client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the discovery client: %w", err)
+	}
+	cached := memory.NewMemCacheClient(discoveryClient)
+	return &cluster{
+		client: client,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(cached),
+		resources: func() ([]resourceType, error) {
+			return deletableResources(cached)
+		},
+	}, nil
+}
+
+// deletableResources returns the types of resources served by the cluster
+// which can be listed and deleted, in their preferred versions.
+func deletableResources(client discovery.DiscoveryInterface) ([]resourceType, error) {
+	lists, err := client.ServerPreferredResources()
+	// Some groups may fail, e.g. if an aggregated API server is down; the
+	// resources of the other groups are still pruned.
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	lists = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "delete"}}, lists)
+	types := []resourceType{}
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range list.APIResources {
+			types = append(types, resourceType{
+				gvr:        gv.WithResource(resource.Name),
+				namespaced: resource.Namespaced,
+			})
+		}
+	}
+	return types, nil
+}
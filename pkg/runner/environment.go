@@ -0,0 +1,112 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+)
+
+// apiServer is the address of the Kubernetes API inside the cluster.
+const apiServer = "https://kubernetes.default.svc:443"
+
+// prepareEnvironment resolves the namespace, and prepares the environment of
+// the template processor and kubectl: the CA bundles of the cluster are set
+// in CA_BUNDLE and SERVICE_CA_BUNDLE, and a kubeconfig using the service
+// account of the job, with the namespace as default, is written to the home
+// directory.
+func (r *Runner) prepareEnvironment() error {
+	config := r.Config
+	if config.Namespace == "" {
+		namespace, err := ioutil.ReadFile(filepath.Join(config.ServiceAccountDir, "namespace"))
+		if err != nil {
+			return fmt.Errorf("NAMESPACE is not set and the namespace of the service account can't be read: %w", err)
+		}
+		config.Namespace = strings.TrimSpace(string(namespace))
+	}
+
+	kubeconfig := filepath.Join(config.Home, ".kube", "config")
+	if err := os.MkdirAll(filepath.Dir(kubeconfig), 0700); err != nil {
+		return fmt.Errorf("failed to create the kubeconfig directory: %w", err)
+	}
+	content, err := yaml.Marshal(r.kubeconfig())
+	if err != nil {
+		return fmt.Errorf("failed to encode the kubeconfig: %w", err)
+	}
+	if err := ioutil.WriteFile(kubeconfig, content, 0600); err != nil {
+		return fmt.Errorf("failed to write the kubeconfig: %w", err)
+	}
+
+	r.env = append(os.Environ(), "HOME="+config.Home, "KUBECONFIG="+kubeconfig)
+	for name, value := range r.variables() {
+		r.env = append(r.env, name+"="+value)
+	}
+	r.Log.Info("Environment prepared", "namespace", config.Namespace, "kubeconfig", kubeconfig)
+	return nil
+}
+
+// variables returns the variables resolved by the runner, which are set in
+// the environment of the template processor and substituted in the
+// directories of hierarchy.lst, and in the parameters if it enables it.
+func (r *Runner) variables() map[string]string {
+	dir := r.Config.ServiceAccountDir
+	variables := map[string]string{
+		"NAMESPACE":         r.Config.Namespace,
+		"GITOPSCONFIG_NAME": r.Config.Name,
+		"CA_BUNDLE":         filepath.Join(dir, "ca.crt"),
+	}
+	// service-ca.crt is only included by default in OpenShift
+	if _, err := os.Stat(filepath.Join(dir, "service-ca.crt")); err == nil {
+		variables["SERVICE_CA_BUNDLE"] = filepath.Join(dir, "service-ca.crt")
+	}
+	return variables
+}
+
+// kubeconfig returns the kubeconfig of the job's service account.
+func (r *Runner) kubeconfig() *clientcmdv1.Config {
+	dir := r.Config.ServiceAccountDir
+	return &clientcmdv1.Config{
+		APIVersion: "v1",
+		Kind:       "Config",
+		Clusters: []clientcmdv1.NamedCluster{{
+			Name: "cluster",
+			Cluster: clientcmdv1.Cluster{
+				Server:               apiServer,
+				CertificateAuthority: filepath.Join(dir, "ca.crt"),
+			},
+		}},
+		AuthInfos: []clientcmdv1.NamedAuthInfo{{
+			Name:     "job",
+			AuthInfo: clientcmdv1.AuthInfo{TokenFile: filepath.Join(dir, "token")},
+		}},
+		Contexts: []clientcmdv1.NamedContext{{
+			Name: "current",
+			Context: clientcmdv1.Context{
+				Cluster:   "cluster",
+				AuthInfo:  "job",
+				Namespace: r.Config.Namespace,
+			},
+		}},
+		CurrentContext: "current",
+	}
+}
@@ -0,0 +1,362 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/render"
+	"github.com/ghodss/yaml"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// manifestFile matches the names of the files holding resources.
+var manifestFile = regexp.MustCompile(`(?i)\.(ya?ml|json)$`)
+
+// createResources handles the manifests according to the CREATE_MODE.
+func (r *Runner) createResources(ctx context.Context) (Result, error) {
+	config := r.Config
+	dir := config.ManifestDir
+	// A directory holding only hidden files like .gitkeep means the user
+	// purposefully tracked an empty directory.
+	visible, err := hasVisibleEntries(dir)
+	if err != nil {
+		return Result{ManagedResources: -1}, fail(ReasonInvalidManifests, err)
+	}
+	if !visible {
+		r.Log.Info("Manifest directory empty, skipping")
+		return Result{ManagedResources: -1}, nil
+	}
+	files, err := manifestFiles(dir)
+	if err != nil {
+		return Result{ManagedResources: -1}, fail(ReasonInvalidManifests, err)
+	}
+	if len(files) == 0 {
+		return Result{ManagedResources: -1}, fail(ReasonInvalidManifests, errors.New("no files with .yaml, .yml, or .json extension in manifest directory"))
+	}
+
+	r.Log.Info("Managing resources", "mode", config.CreateMode, "files", len(files))
+	switch config.CreateMode {
+	case "Apply":
+		timestamp := strconv.FormatInt(r.currentTime().Unix(), 10)
+		owner := render.OwnerLabelValue(config.Namespace, config.Name)
+		c, err := r.kube()
+		if err != nil {
+			return Result{ManagedResources: -1}, fail(ReasonEnvironmentFailed, err)
+		}
+		if err := r.prepareManifests(ctx, c, files, owner, timestamp); err != nil {
+			return Result{ManagedResources: -1}, fail(ReasonInvalidManifests, err)
+		}
+		if err := r.kubectl(ctx, "apply", "-R", "-f", dir); err != nil {
+			return Result{ManagedResources: -1}, fail(ReasonApplyFailed, err)
+		}
+		if err := r.prune(ctx, c, owner, timestamp); err != nil {
+			return Result{ManagedResources: -1}, fail(ReasonPruneFailed, err)
+		}
+	case "Create", "Patch", "Replace":
+		if err := r.kubectl(ctx, strings.ToLower(config.CreateMode), "-R", "-f", dir); err != nil {
+			return Result{ManagedResources: -1}, fail(ReasonApplyFailed, err)
+		}
+	case "Delete":
+		if err := r.kubectl(ctx, "delete", "--wait=false", "-R", "-f", dir); err != nil {
+			return Result{ManagedResources: -1}, fail(ReasonApplyFailed, err)
+		}
+		return Result{ManagedResources: -1}, nil
+	case "None":
+		return Result{ManagedResources: -1}, nil
+	}
+
+	count, err := countResources(files)
+	if err != nil {
+		return Result{ManagedResources: -1}, fail(ReasonInvalidManifests, err)
+	}
+	r.Log.Info("Resources managed", "count", count)
+	return Result{ManagedResources: count}, nil
+}
+
+// deleteResources deletes the resources of the GitOpsConfig, unless its
+// DELETE_MODE is None.
+func (r *Runner) deleteResources(ctx context.Context) error {
+	if r.Config.DeleteMode == "None" {
+		r.Log.Info("DELETE_MODE is set to None, skipping deletion")
+		return nil
+	}
+	c, err := r.kube()
+	if err != nil {
+		return fail(ReasonEnvironmentFailed, err)
+	}
+	return fail(ReasonPruneFailed, r.prune(ctx, c, render.OwnerLabelValue(r.Config.Namespace, r.Config.Name), ""))
+}
+
+// kubectl runs kubectl with the kubeconfig of the job.
+func (r *Runner) kubectl(ctx context.Context, args ...string) error {
+	r.Log.Info("Running kubectl", "args", args)
+	return r.run(ctx, "", nil, r.Config.Kubectl, args...)
+}
+
+// currentTime returns the current time.
+func (r *Runner) currentTime() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// prepareManifests adds the owner and applied labels to the resources of
+// files, and sets the resourceVersion of those which already exist in the
+// cluster, so that applying them fails with a conflict if they're modified
+// in the meantime.
+// See: https://github.com/kubernetes/community/blob/master/contributors/devel/sig-architecture/api-conventions.md#concurrency-control-and-consistency
+func (r *Runner) prepareManifests(ctx context.Context, c *cluster, files []string, owner, timestamp string) error {
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		labeled, err := render.AddLabels(content, owner, timestamp)
+		if err != nil {
+			return fmt.Errorf("failed to label the resources in %s: %w", file, err)
+		}
+		versioned, err := r.setResourceVersions(ctx, c, labeled)
+		if err != nil {
+			return fmt.Errorf("failed to set the resource versions in %s: %w", file, err)
+		}
+		if err := ioutil.WriteFile(file, versioned, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setResourceVersions sets the resourceVersion of the resources of the YAML
+// documents in content which exist in the cluster. The resources whose type
+// isn't known yet, e.g. custom resources whose definition is applied at the
+// same time, and those which can't be read, are left as they are.
+func (r *Runner) setResourceVersions(ctx context.Context, c *cluster, content []byte) ([]byte, error) {
+	docs, err := readDocuments(content)
+	if err != nil {
+		return nil, err
+	}
+	result := &bytes.Buffer{}
+	for _, doc := range docs {
+		obj := &unstructured.Unstructured{Object: doc}
+		version, err := c.resourceVersion(ctx, obj, r.Config.Namespace)
+		if err != nil {
+			// kubectl apply reports the errors affecting the resource
+			r.Log.Info("Unable to get the resource version", "kind", obj.GetKind(), "name", obj.GetName(), "error", err.Error())
+		}
+		if version != "" {
+			r.Log.V(1).Info("Got resource version", "kind", obj.GetKind(), "namespace", obj.GetNamespace(), "name", obj.GetName(), "resourceVersion", version)
+			obj.SetResourceVersion(version)
+		}
+		out, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		if result.Len() > 0 {
+			result.WriteString("---\n")
+		}
+		result.Write(out)
+	}
+	return result.Bytes(), nil
+}
+
+// prune deletes the resources labeled with owner, except those applied at
+// timestamp or later; without timestamp, all of them are deleted. Like the
+// previous shell scripts, the namespaced resources are only looked up in the
+// namespace of the job.
+func (r *Runner) prune(ctx context.Context, c *cluster, owner, timestamp string) error {
+	if r.Config.DeleteMode == "None" {
+		r.Log.Info("DELETE_MODE is set to None, skipping pruning")
+		return nil
+	}
+	applied, _ := strconv.ParseInt(timestamp, 10, 64)
+	types, err := c.resources()
+	if err != nil {
+		return fmt.Errorf("failed to discover the resource types: %w", err)
+	}
+	seen := map[string]bool{}
+	for _, t := range types {
+		client := c.client.Resource(t.gvr)
+		var list *unstructured.UnstructuredList
+		if t.namespaced {
+			list, err = client.Namespace(r.Config.Namespace).List(metav1.ListOptions{LabelSelector: render.OwnerLabel + "=" + owner})
+		} else {
+			list, err = client.List(metav1.ListOptions{LabelSelector: render.OwnerLabel + "=" + owner})
+		}
+		if err != nil {
+			if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) || apierrors.IsMethodNotSupported(err) {
+				r.Log.V(1).Info("Skipping resource type", "resource", t.gvr.String(), "error", err.Error())
+				continue
+			}
+			return fmt.Errorf("failed to list %s: %w", t.gvr.String(), err)
+		}
+		for i := range list.Items {
+			item := &list.Items[i]
+			// The same resources can be served by several API groups
+			if seen[string(item.GetUID())] {
+				continue
+			}
+			seen[string(item.GetUID())] = true
+			if timestamp != "" {
+				itemApplied, _ := strconv.ParseInt(item.GetLabels()[render.AppliedLabel], 10, 64)
+				if itemApplied >= applied {
+					continue
+				}
+			}
+			r.Log.Info("Deleting resource", "kind", item.GetKind(), "namespace", item.GetNamespace(), "name", item.GetName())
+			propagation := metav1.DeletePropagationBackground
+			options := &metav1.DeleteOptions{PropagationPolicy: &propagation}
+			if t.namespaced {
+				err = client.Namespace(item.GetNamespace()).Delete(item.GetName(), options)
+			} else {
+				err = client.Delete(item.GetName(), options)
+			}
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete %s %s: %w", item.GetKind(), item.GetName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// hasVisibleEntries returns true if dir contains files or directories whose
+// names don't start with a dot.
+func hasVisibleEntries(dir string) (bool, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// manifestFiles returns the YAML and JSON files in dir and its
+// subdirectories.
+func manifestFiles(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && manifestFile.MatchString(info.Name()) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// countResources returns the number of resources in files.
+func countResources(files []string) (int, error) {
+	count := 0
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return 0, err
+		}
+		docs, err := readDocuments(content)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the resources in %s: %w", file, err)
+		}
+		count += len(docs)
+	}
+	return count, nil
+}
+
+// readDocuments returns the non-empty YAML or JSON documents of content.
+func readDocuments(content []byte) ([]map[string]interface{}, error) {
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(content)))
+	docs := []map[string]interface{}{}
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var resource map[string]interface{}
+		if err := yaml.Unmarshal(doc, &resource); err != nil {
+			return nil, err
+		}
+		if resource != nil {
+			docs = append(docs, resource)
+		}
+	}
+}
+
+// resourceVersion returns the resourceVersion of obj in the cluster, or ""
+// if it doesn't exist or its type isn't known. Namespaced resources without
+// namespace are looked up in namespace.
+func (c *cluster) resourceVersion(ctx context.Context, obj *unstructured.Unstructured, namespace string) (string, error) {
+	gvk := obj.GroupVersionKind()
+	if gvk.Kind == "" || obj.GetName() == "" {
+		return "", nil
+	}
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	client := c.client.Resource(mapping.Resource)
+	var live *unstructured.Unstructured
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if obj.GetNamespace() != "" {
+			namespace = obj.GetNamespace()
+		}
+		live, err = client.Namespace(namespace).Get(obj.GetName(), metav1.GetOptions{})
+	} else {
+		live, err = client.Get(obj.GetName(), metav1.GetOptions{})
+	}
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s %s: %w", gvk.Kind, obj.GetName(), err)
+	}
+	return live.GetResourceVersion(), nil
+}
+
+// resourceType is a type of resource which can be listed and deleted.
+type resourceType struct {
+	gvr        schema.GroupVersionResource
+	namespaced bool
+}
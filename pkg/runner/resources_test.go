@@ -0,0 +1,185 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/KohlsTechnology/eunomia/pkg/render"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// clusterRoles is the resource of ClusterRoles.
+var clusterRoles = schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}
+
+// configMap returns a ConfigMap labeled with owner and applied, unless
+// they're empty.
+func configMap(name, namespace, owner, applied string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetName(name)
+	obj.SetNamespace(namespace)
+	obj.SetUID(types.UID(namespace + "/" + name))
+	setLabels(obj, owner, applied)
+	return obj
+}
+
+// clusterRole returns a ClusterRole labeled with owner and applied.
+func clusterRole(name, owner, applied string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("rbac.authorization.k8s.io/v1")
+	obj.SetKind("ClusterRole")
+	obj.SetName(name)
+	obj.SetUID(types.UID(name))
+	setLabels(obj, owner, applied)
+	return obj
+}
+
+func setLabels(obj *unstructured.Unstructured, owner, applied string) {
+	labels := map[string]string{}
+	if owner != "" {
+		labels[render.OwnerLabel] = owner
+	}
+	if applied != "" {
+		labels[render.AppliedLabel] = applied
+	}
+	obj.SetLabels(labels)
+}
+
+func TestPrune(t *testing.T) {
+	owner := render.OwnerLabelValue("team", "app")
+	tests := []struct {
+		name       string
+		timestamp  string
+		deleteMode string
+		want       []string
+	}{
+		{"outdated", "1600000000", "Delete", []string{"current", "current-role", "other", "other-namespace"}},
+		{"all", "", "Delete", []string{"other", "other-namespace"}},
+		{"none", "", "None", []string{"current", "current-role", "old", "old-role", "other", "other-namespace"}},
+	}
+	for _, tt := range tests {
+		c, client := testCluster(
+			configMap("old", "team", owner, "1500000000"),
+			configMap("current", "team", owner, "1600000000"),
+			configMap("other", "team", render.OwnerLabelValue("team", "other"), "1500000000"),
+			// Namespaced resources are only pruned in the namespace of the job
+			configMap("other-namespace", "other", owner, "1500000000"),
+			clusterRole("old-role", owner, "1500000000"),
+			clusterRole("current-role", owner, "1600000000"),
+		)
+		r := &Runner{Config: &Config{Namespace: "team", Name: "app", DeleteMode: tt.deleteMode}, Log: logf.Log}
+		if err := r.prune(context.TODO(), c, owner, tt.timestamp); err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+
+		remaining := []string{}
+		for _, resource := range []schema.GroupVersionResource{configMaps, clusterRoles} {
+			list, err := client.Resource(resource).List(metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range list.Items {
+				remaining = append(remaining, item.GetName())
+			}
+		}
+		sort.Strings(remaining)
+		if !equal(remaining, tt.want) {
+			t.Errorf("%s: expected remaining resources %v, got %v", tt.name, tt.want, remaining)
+		}
+	}
+}
+
+func TestCountResources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runner-manifests-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.yaml":        "kind: ConfigMap\n---\n# comment\n---\nkind: Secret\n",
+		"sub/b.json":    `{"kind": "Service"}`,
+		"sub/notes.txt": "kind: Ignored",
+		".hidden.yml":   "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifests, err := manifestFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 3 {
+		t.Errorf("expected 3 manifest files, got %v", manifests)
+	}
+	count, err := countResources(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 resources, got %d", count)
+	}
+	visible, err := hasVisibleEntries(dir)
+	if err != nil || !visible {
+		t.Errorf("expected visible entries, got %t, %v", visible, err)
+	}
+}
+
+func TestHasVisibleEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runner-manifests-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, ".gitkeep"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	visible, err := hasVisibleEntries(dir)
+	if err != nil || visible {
+		t.Errorf("expected no visible entries, got %t, %v", visible, err)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
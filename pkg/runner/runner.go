@@ -0,0 +1,378 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package runner implements the pipeline of the jobs of GitOpsConfigs, run by
+// the eunomia-runner entrypoint of the template processor images: the
+// template and parameter repositories are cloned, the parameters are merged
+// according to hierarchy.lst, the templates are processed by the
+// processTemplates.sh script of the image, and the resulting resources are
+// labeled, applied and pruned. It's configured by the same environment
+// variables as the scripts it replaces, which are set by the job templates.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/hierarchy"
+	"github.com/go-logr/logr"
+)
+
+// Reason identifies the step of a run which failed. It's logged, and written
+// to the termination message of the job's container, e.g.
+// "exitReason=CloneFailed".
+type Reason string
+
+// The reasons of failed runs.
+const (
+	ReasonInvalidConfig        Reason = "InvalidConfig"
+	ReasonCloneFailed          Reason = "CloneFailed"
+	ReasonContextDirNotFound   Reason = "ContextDirNotFound"
+	ReasonEnvironmentFailed    Reason = "EnvironmentFailed"
+	ReasonParameterMergeFailed Reason = "ParameterMergeFailed"
+	ReasonProcessorFailed      Reason = "TemplateProcessorFailed"
+	ReasonInvalidManifests     Reason = "InvalidManifests"
+	ReasonApplyFailed          Reason = "ApplyFailed"
+	ReasonPruneFailed          Reason = "PruneFailed"
+)
+
+// exitCodes are the exit codes of the runner for each reason, so that the
+// failed step can be told from the status of the job's pod.
+var exitCodes = map[Reason]int{
+	ReasonInvalidConfig:        2,
+	ReasonCloneFailed:          3,
+	ReasonContextDirNotFound:   4,
+	ReasonEnvironmentFailed:    5,
+	ReasonParameterMergeFailed: 6,
+	ReasonProcessorFailed:      7,
+	ReasonInvalidManifests:     8,
+	ReasonApplyFailed:          9,
+	ReasonPruneFailed:          10,
+}
+
+// ExitCode returns the exit code of the runner when a run failed for reason.
+func (reason Reason) ExitCode() int {
+	if code, ok := exitCodes[reason]; ok {
+		return code
+	}
+	return 1
+}
+
+// Error is the error of a failed run.
+type Error struct {
+	Reason Reason
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// fail returns an Error for reason, unless err is nil.
+func fail(reason Reason, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Reason: reason, Err: err}
+}
+
+// ReasonOf returns the reason of err, or "" if it's not an Error.
+func ReasonOf(err error) Reason {
+	var runErr *Error
+	if errors.As(err, &runErr) {
+		return runErr.Reason
+	}
+	return ""
+}
+
+// Source is a Git repository cloned by the runner.
+type Source struct {
+	URI string // TEMPLATE_GIT_URI
+	Ref string // TEMPLATE_GIT_REF
+
+	HTTPProxy  string // TEMPLATE_GIT_HTTP_PROXY
+	HTTPSProxy string // TEMPLATE_GIT_HTTPS_PROXY
+	NOProxy    string // TEMPLATE_GIT_NO_PROXY
+
+	// GitConfig is the directory holding the files of the gitconfig Secret
+	// of the source, copied to the home directory before cloning.
+	GitConfig string // TEMPLATE_GITCONFIG
+	// Dir is where the repository is cloned.
+	Dir string // TEMPLATE_GIT_DIR
+	// ContextDir is the directory of the clone holding the templates or the
+	// parameters.
+	ContextDir string // CLONED_TEMPLATE_GIT_DIR
+}
+
+// Config configures a run. Its fields are read from the environment variables
+// set by the job templates.
+type Config struct {
+	// Action is "create" or "delete".
+	Action string // ACTION
+	// Namespace is the namespace of the resources not specifying one.
+	Namespace string // NAMESPACE
+	// Name is the name of the GitOpsConfig.
+	Name string // GITOPSCONFIG_NAME
+
+	Template  Source // TEMPLATE_*
+	Parameter Source // PARAMETER_*
+
+	ManifestDir string // MANIFEST_DIR
+	CreateMode  string // CREATE_MODE
+	DeleteMode  string // DELETE_MODE
+
+	// Home is the home directory of the commands run by the runner.
+	Home string
+	// ValuesFile is where the merged parameters are written for the
+	// template processor.
+	ValuesFile string
+	// ServiceAccountDir holds the token, CA bundles and namespace of the
+	// job's service account.
+	ServiceAccountDir string
+	// Processor is the command processing the templates.
+	Processor string
+	// Kubectl is the kubectl command.
+	Kubectl string // kubectl
+}
+
+const (
+	// defaultHome is the home directory of the jobs.
+	defaultHome = "/tmp"
+	// defaultValuesFile is where the template processors expect the merged
+	// parameters.
+	defaultValuesFile = "/tmp/eunomia_values_processed.yaml"
+	// defaultServiceAccountDir is where Kubernetes mounts the credentials
+	// of the service account.
+	defaultServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// defaultProcessor is the script of the template processor images.
+	defaultProcessor = "processTemplates.sh"
+)
+
+// ConfigFromEnv returns the configuration of a run from the environment
+// variables returned by getenv, e.g. os.Getenv.
+func ConfigFromEnv(getenv func(string) string) (*Config, error) {
+	source := func(prefix string) Source {
+		return Source{
+			URI:        getenv(prefix + "_GIT_URI"),
+			Ref:        getenv(prefix + "_GIT_REF"),
+			HTTPProxy:  getenv(prefix + "_GIT_HTTP_PROXY"),
+			HTTPSProxy: getenv(prefix + "_GIT_HTTPS_PROXY"),
+			NOProxy:    getenv(prefix + "_GIT_NO_PROXY"),
+			GitConfig:  getenv(prefix + "_GITCONFIG"),
+			Dir:        getenv(prefix + "_GIT_DIR"),
+			ContextDir: getenv("CLONED_" + prefix + "_GIT_DIR"),
+		}
+	}
+	config := &Config{
+		Action:            getenv("ACTION"),
+		Namespace:         getenv("NAMESPACE"),
+		Name:              getenv("GITOPSCONFIG_NAME"),
+		Template:          source("TEMPLATE"),
+		Parameter:         source("PARAMETER"),
+		ManifestDir:       getenv("MANIFEST_DIR"),
+		CreateMode:        getenv("CREATE_MODE"),
+		DeleteMode:        getenv("DELETE_MODE"),
+		Home:              defaultHome,
+		ValuesFile:        defaultValuesFile,
+		ServiceAccountDir: defaultServiceAccountDir,
+		Processor:         defaultProcessor,
+		Kubectl:           getenv("kubectl"),
+	}
+	if config.Kubectl == "" {
+		config.Kubectl = "kubectl"
+	}
+
+	missing := []string{}
+	require := func(name, value string) {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	require("GITOPSCONFIG_NAME", config.Name)
+	switch config.Action {
+	case "create":
+		require("TEMPLATE_GIT_URI", config.Template.URI)
+		require("TEMPLATE_GIT_DIR", config.Template.Dir)
+		require("CLONED_TEMPLATE_GIT_DIR", config.Template.ContextDir)
+		require("PARAMETER_GIT_URI", config.Parameter.URI)
+		require("PARAMETER_GIT_DIR", config.Parameter.Dir)
+		require("CLONED_PARAMETER_GIT_DIR", config.Parameter.ContextDir)
+		require("MANIFEST_DIR", config.ManifestDir)
+		switch config.CreateMode {
+		case "Apply", "Create", "Delete", "Patch", "Replace", "None":
+		default:
+			return nil, fmt.Errorf("invalid CREATE_MODE %q", config.CreateMode)
+		}
+	case "delete":
+	default:
+		return nil, fmt.Errorf("invalid ACTION %q", config.Action)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing environment variables %s", strings.Join(missing, ", "))
+	}
+	return config, nil
+}
+
+// Runner runs the pipeline of a job.
+type Runner struct {
+	Config *Config
+	Log    logr.Logger
+	// Stdout and Stderr receive the output of the commands run by the
+	// runner, e.g. git and the template processor.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// env holds the environment of the commands, once it's prepared.
+	env []string
+	// now returns the current time; it's time.Now if nil.
+	now func() time.Time
+	// cluster returns the clients of the cluster; it's newCluster if nil.
+	cluster func() (*cluster, error)
+}
+
+// Result is the outcome of a successful run.
+type Result struct {
+	// ManagedResources is the number of resources applied, or -1 if the run
+	// didn't apply resources.
+	ManagedResources int
+}
+
+// Run runs the pipeline of the job. On failure, the error is an Error holding
+// the reason of the failure.
+func (r *Runner) Run(ctx context.Context) (Result, error) {
+	config := r.Config
+	r.Log.Info("Starting run", "action", config.Action, "namespace", config.Namespace, "gitopsconfig", config.Name)
+	if config.Action == "delete" {
+		if err := fail(ReasonEnvironmentFailed, r.prepareEnvironment()); err != nil {
+			return Result{ManagedResources: -1}, err
+		}
+		return Result{ManagedResources: -1}, r.deleteResources(ctx)
+	}
+
+	if err := fail(ReasonCloneFailed, r.clone(ctx, config.Template)); err != nil {
+		return Result{ManagedResources: -1}, err
+	}
+	// In git, if a directory contains no files, it isn't tracked
+	if info, err := os.Stat(config.Template.ContextDir); err != nil || !info.IsDir() {
+		rel := strings.TrimPrefix(strings.TrimPrefix(config.Template.ContextDir, config.Template.Dir), "/")
+		return Result{ManagedResources: -1}, fail(ReasonContextDirNotFound,
+			fmt.Errorf("directory %s does not exist in the remote repository; if you want an empty directory to be tracked by git, add a .gitkeep file inside", rel))
+	}
+	if err := fail(ReasonCloneFailed, r.clone(ctx, config.Parameter)); err != nil {
+		return Result{ManagedResources: -1}, err
+	}
+	if err := os.MkdirAll(config.ManifestDir, 0755); err != nil {
+		return Result{ManagedResources: -1}, fail(ReasonEnvironmentFailed, fmt.Errorf("failed to create the manifest directory: %w", err))
+	}
+	if err := fail(ReasonEnvironmentFailed, r.prepareEnvironment()); err != nil {
+		return Result{ManagedResources: -1}, err
+	}
+	if err := fail(ReasonParameterMergeFailed, r.mergeParameters()); err != nil {
+		return Result{ManagedResources: -1}, err
+	}
+	if err := fail(ReasonProcessorFailed, r.processTemplates(ctx)); err != nil {
+		return Result{ManagedResources: -1}, err
+	}
+	return r.createResources(ctx)
+}
+
+// mergeParameters merges the parameters according to their hierarchy.lst,
+// and writes them to the values file.
+func (r *Runner) mergeParameters() error {
+	dir := r.Config.Parameter.ContextDir
+	r.Log.Info("Merging parameters", "dir", dir)
+	result, err := hierarchy.Merge(dir, hierarchy.Options{Variables: r.variables()})
+	if err != nil {
+		return fmt.Errorf("failed to merge the parameters in %s: %w", dir, err)
+	}
+	values, err := result.YAML()
+	if err != nil {
+		return fmt.Errorf("failed to encode the merged parameters: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.Config.ValuesFile), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.Config.ValuesFile, values, 0644)
+}
+
+// processTemplates runs the template processor of the image, which writes
+// the manifests to the manifest directory.
+func (r *Runner) processTemplates(ctx context.Context) error {
+	r.Log.Info("Processing templates", "processor", r.Config.Processor, "dir", r.Config.Template.ContextDir)
+	cmd := exec.CommandContext(ctx, r.Config.Processor)
+	cmd.Env = r.env
+	cmd.Stdout = r.Stdout
+	cmd.Stderr = r.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", r.Config.Processor, err)
+	}
+	return nil
+}
+
+// run runs a command in dir with the environment of the runner, extended by
+// env. Its output is forwarded to the runner's output, and the end of its
+// error output is included in the returned error.
+func (r *Runner) run(ctx context.Context, dir string, env []string, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(append([]string{}, r.baseEnv()...), env...)
+	stderr := &tailBuffer{max: 1024}
+	cmd.Stdout = r.Stdout
+	cmd.Stderr = io.MultiWriter(r.Stderr, stderr)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// baseEnv returns the environment of the commands: the prepared environment
+// if any, or else the current one with HOME set.
+func (r *Runner) baseEnv() []string {
+	if r.env != nil {
+		return r.env
+	}
+	return append(os.Environ(), "HOME="+r.Config.Home)
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max  int
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > b.max {
+		b.data = b.data[len(b.data)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.data)
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/render"
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// newRepo creates a Git repository holding files, and returns its path and
+// the SHA of its commit.
+func newRepo(t *testing.T, files map[string]string) (string, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "runner-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "-b", "main")
+	git("add", ".")
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	return dir, git("rev-parse", "HEAD")
+}
+
+// writeScript writes an executable shell script to path.
+func writeScript(t *testing.T, path, script string) {
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testRunner returns a runner of a create job for the templates and
+// parameters repositories, working in a temporary directory. The processor
+// copies the templates to the manifest directory, and kubectl logs its
+// arguments to the "kubectl.log" file of the work directory.
+func testRunner(t *testing.T, templates, parameters string) (*Runner, string) {
+	work, err := ioutil.TempDir("", "runner-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceAccount := filepath.Join(work, "serviceaccount")
+	if err := os.Mkdir(serviceAccount, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"namespace": "team\n", "token": "token", "ca.crt": ""} {
+		if err := ioutil.WriteFile(filepath.Join(serviceAccount, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := &Config{
+		Action: "create",
+		Name:   "app",
+		Template: Source{
+			URI:        "file://" + templates,
+			Ref:        "main",
+			Dir:        filepath.Join(work, "git", "templates"),
+			ContextDir: filepath.Join(work, "git", "templates", "deploy"),
+		},
+		Parameter: Source{
+			URI:        "file://" + parameters,
+			Ref:        "main",
+			Dir:        filepath.Join(work, "git", "parameters"),
+			ContextDir: filepath.Join(work, "git", "parameters", "params"),
+		},
+		ManifestDir:       filepath.Join(work, "git", "manifests"),
+		CreateMode:        "Apply",
+		DeleteMode:        "Delete",
+		Home:              work,
+		ValuesFile:        filepath.Join(work, "values.yaml"),
+		ServiceAccountDir: serviceAccount,
+		Processor:         filepath.Join(work, "processTemplates.sh"),
+		Kubectl:           filepath.Join(work, "kubectl"),
+	}
+	writeScript(t, config.Processor, fmt.Sprintf(`cp -R "%s/." "%s/"`, config.Template.ContextDir, config.ManifestDir))
+	writeScript(t, config.Kubectl, fmt.Sprintf(`echo "$@" >>"%s"`, filepath.Join(work, "kubectl.log")))
+	r := &Runner{Config: config, Log: logf.Log, Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	return r, work
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	create := map[string]string{
+		"ACTION":                   "create",
+		"NAMESPACE":                "team",
+		"GITOPSCONFIG_NAME":        "app",
+		"TEMPLATE_GIT_URI":         "https://github.com/org/templates",
+		"TEMPLATE_GIT_REF":         "main",
+		"TEMPLATE_GIT_HTTP_PROXY":  "http://proxy:8080",
+		"TEMPLATE_GIT_DIR":         "/git/templates",
+		"TEMPLATE_GITCONFIG":       "/template-gitconfig",
+		"CLONED_TEMPLATE_GIT_DIR":  "/git/templates/deploy",
+		"PARAMETER_GIT_URI":        "https://github.com/org/parameters",
+		"PARAMETER_GIT_DIR":        "/git/parameters",
+		"CLONED_PARAMETER_GIT_DIR": "/git/parameters/",
+		"MANIFEST_DIR":             "/git/manifests",
+		"CREATE_MODE":              "Apply",
+		"DELETE_MODE":              "Delete",
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		unset   string
+		wantErr string
+	}{
+		{"create", create, "", ""},
+		{"missing variable", create, "MANIFEST_DIR", "missing environment variables MANIFEST_DIR"},
+		{"invalid mode", map[string]string{"ACTION": "create", "GITOPSCONFIG_NAME": "app", "CREATE_MODE": "Merge"}, "", `invalid CREATE_MODE "Merge"`},
+		{"delete", map[string]string{"ACTION": "delete", "GITOPSCONFIG_NAME": "app"}, "", ""},
+		{"invalid action", map[string]string{"ACTION": "update", "GITOPSCONFIG_NAME": "app"}, "", `invalid ACTION "update"`},
+	}
+	for _, tt := range tests {
+		getenv := func(name string) string {
+			if name == tt.unset {
+				return ""
+			}
+			return tt.env[name]
+		}
+		config, err := ConfigFromEnv(getenv)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: expected error %q, got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if config.Kubectl != "kubectl" || config.Home != "/tmp" || config.ValuesFile != "/tmp/eunomia_values_processed.yaml" {
+			t.Errorf("%s: unexpected defaults %+v", tt.name, config)
+		}
+		if tt.name == "create" {
+			want := Source{
+				URI:        "https://github.com/org/templates",
+				Ref:        "main",
+				HTTPProxy:  "http://proxy:8080",
+				GitConfig:  "/template-gitconfig",
+				Dir:        "/git/templates",
+				ContextDir: "/git/templates/deploy",
+			}
+			if config.Template != want {
+				t.Errorf("%s: expected template source %+v, got %+v", tt.name, want, config.Template)
+			}
+		}
+	}
+}
+
+func TestRunApply(t *testing.T) {
+	templates, _ := newRepo(t, map[string]string{
+		"deploy/configmap.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  env: dev\n",
+		"deploy/README.md":      "not a manifest",
+	})
+	defer os.RemoveAll(templates)
+	parameters, _ := newRepo(t, map[string]string{
+		"params/hierarchy.lst": "base\n${NAMESPACE}\n",
+		"params/base/a.yaml":   "replicas: 1\nnamespace: base\n",
+		"params/team/b.yaml":   "namespace: ${NAMESPACE}\n",
+	})
+	defer os.RemoveAll(parameters)
+	r, work := testRunner(t, templates, parameters)
+	defer os.RemoveAll(work)
+
+	existing := configMap("app", "team", render.OwnerLabelValue("team", "app"), "1500000000")
+	existing.SetResourceVersion("42")
+	c, client := testCluster(existing)
+	r.cluster = func() (*cluster, error) { return c, nil }
+	r.now = func() time.Time { return time.Unix(1600000000, 0) }
+
+	result, err := r.Run(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ManagedResources != 1 {
+		t.Errorf("expected 1 managed resource, got %d", result.ManagedResources)
+	}
+	if r.Config.Namespace != "team" {
+		t.Errorf("expected the namespace of the service account, got %q", r.Config.Namespace)
+	}
+
+	values, err := ioutil.ReadFile(filepath.Join(work, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The variables are only substituted in the directories by default
+	if string(values) != "namespace: ${NAMESPACE}\nreplicas: 1\n" {
+		t.Errorf("unexpected merged parameters %q", values)
+	}
+
+	manifest, err := ioutil.ReadFile(filepath.Join(r.Config.ManifestDir, "configmap.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource := map[string]interface{}{}
+	if err := yaml.Unmarshal(manifest, &resource); err != nil {
+		t.Fatal(err)
+	}
+	metadata := resource["metadata"].(map[string]interface{})
+	labels := metadata["labels"].(map[string]interface{})
+	if labels[render.OwnerLabel] != render.OwnerLabelValue("team", "app") || labels[render.AppliedLabel] != "1600000000" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+	if metadata["resourceVersion"] != "42" {
+		t.Errorf("expected the resource version of the existing resource, got %v", metadata["resourceVersion"])
+	}
+
+	log, err := ioutil.ReadFile(filepath.Join(work, "kubectl.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(log) != "apply -R -f "+r.Config.ManifestDir+"\n" {
+		t.Errorf("unexpected kubectl calls %q", log)
+	}
+	kubeconfig, err := ioutil.ReadFile(filepath.Join(work, ".kube", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(kubeconfig), "namespace: team") || !strings.Contains(string(kubeconfig), apiServer) {
+		t.Errorf("unexpected kubeconfig %s", kubeconfig)
+	}
+	// The fake kubectl didn't apply the resource, so it's pruned as outdated
+	list, err := client.Resource(configMaps).Namespace("team").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 0 {
+		t.Errorf("expected the resource to be pruned, got %v", list.Items)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	templates, sha := newRepo(t, map[string]string{"deploy/.gitkeep": ""})
+	defer os.RemoveAll(templates)
+	parameters, _ := newRepo(t, map[string]string{"params/a.yaml": "a: 1\n"})
+	defer os.RemoveAll(parameters)
+	invalidParameters, _ := newRepo(t, map[string]string{"params/a.yaml": "a: [\n"})
+	defer os.RemoveAll(invalidParameters)
+
+	tests := []struct {
+		name       string
+		modify     func(r *Runner)
+		wantReason Reason
+	}{
+		{"empty manifests", func(r *Runner) {}, ""},
+		{"commit ref", func(r *Runner) { r.Config.Template.Ref = sha }, ""},
+		{"missing ref", func(r *Runner) { r.Config.Template.Ref = "missing" }, ReasonCloneFailed},
+		{"missing context dir", func(r *Runner) { r.Config.Template.ContextDir += "/missing" }, ReasonContextDirNotFound},
+		{"invalid parameters", func(r *Runner) { r.Config.Parameter.URI = "file://" + invalidParameters }, ReasonParameterMergeFailed},
+		{"failing processor", func(r *Runner) { writeScript(t, r.Config.Processor, "exit 3") }, ReasonProcessorFailed},
+		{"no manifests", func(r *Runner) {
+			writeScript(t, r.Config.Processor, fmt.Sprintf(`touch "%s/notes.txt"`, r.Config.ManifestDir))
+		}, ReasonInvalidManifests},
+		{"failing kubectl", func(r *Runner) {
+			writeScript(t, r.Config.Processor, fmt.Sprintf(`echo "kind: ConfigMap" >"%s/cm.yaml"`, r.Config.ManifestDir))
+			writeScript(t, r.Config.Kubectl, "exit 1")
+		}, ReasonApplyFailed},
+	}
+	for _, tt := range tests {
+		r, work := testRunner(t, templates, parameters)
+		c, _ := testCluster()
+		r.cluster = func() (*cluster, error) { return c, nil }
+		tt.modify(r)
+
+		_, err := r.Run(context.TODO())
+		if reason := ReasonOf(err); reason != tt.wantReason {
+			t.Errorf("%s: expected reason %q, got %q (%v)", tt.name, tt.wantReason, reason, err)
+		}
+		os.RemoveAll(work)
+	}
+}
+
+func TestRunDelete(t *testing.T) {
+	owned := configMap("app", "team", render.OwnerLabelValue("team", "app"), "1600000000")
+	other := configMap("other", "team", render.OwnerLabelValue("team", "other"), "1600000000")
+	for _, mode := range []string{"Delete", "None"} {
+		r, work := testRunner(t, "", "")
+		r.Config = &Config{Action: "delete", Name: "app", DeleteMode: mode, Home: work, ServiceAccountDir: r.Config.ServiceAccountDir}
+		c, client := testCluster(owned.DeepCopy(), other.DeepCopy())
+		r.cluster = func() (*cluster, error) { return c, nil }
+
+		if _, err := r.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		list, err := client.Resource(configMaps).Namespace("team").List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]int{"Delete": 1, "None": 2}[mode]
+		if len(list.Items) != want {
+			t.Errorf("%s: expected %d remaining configmaps, got %d", mode, want, len(list.Items))
+		}
+		os.RemoveAll(work)
+	}
+}
+
+// configMaps is the resource of ConfigMaps.
+var configMaps = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+// testCluster returns a cluster serving ConfigMaps and ClusterRoles, holding
+// objects.
+func testCluster(objects ...runtime.Object) (*cluster, *fake.FakeDynamicClient) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	return &cluster{
+		client: client,
+		mapper: mapper,
+		resources: func() ([]resourceType, error) {
+			return []resourceType{
+				{gvr: configMaps, namespaced: true},
+				{gvr: clusterRoles},
+			}, nil
+		},
+	}, client
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package syncwindow evaluates sync windows, i.e. recurring periods of time
+// during which runs of a GitOpsConfig are allowed or denied.
+package syncwindow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/cron"
+	"github.com/ghodss/yaml"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Supported values of SyncWindow.Kind.
+const (
+	KindAllow = "Allow"
+	KindDeny  = "Deny"
+)
+
+// maxSteps limits the search for the next open window, so that windows which
+// never open (e.g. an always active Deny window) don't loop forever.
+const maxSteps = 10000
+
+var log = logf.Log.WithName("syncwindow").WithValues("filename", "syncwindow.go")
+
+// globalWindows are the cluster-wide sync windows, applied to every GitOpsConfig.
+var globalWindows []v1alpha1.SyncWindow
+
+// InitializeGlobalWindows reads the cluster-wide sync windows from a YAML file
+// containing a list of SyncWindow objects. It must be called at controller boot
+// time, before any Set is built with ForConfig.
+func InitializeGlobalWindows(fileName string) error {
+	text, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		log.Error(err, "error reading sync windows file", "filename", fileName)
+		return fmt.Errorf("error reading sync windows file %q: %w", fileName, err)
+	}
+	windows := []v1alpha1.SyncWindow{}
+	err = yaml.Unmarshal(text, &windows)
+	if err != nil {
+		log.Error(err, "error parsing sync windows file", "filename", fileName)
+		return fmt.Errorf("error parsing sync windows file %q: %w", fileName, err)
+	}
+	// Validate the windows early, so that a broken file is detected at boot time.
+	_, err = Compile(windows)
+	if err != nil {
+		return fmt.Errorf("invalid sync window in file %q: %w", fileName, err)
+	}
+	globalWindows = windows
+	return nil
+}
+
+// window is a compiled v1alpha1.SyncWindow.
+type window struct {
+	kind     string
+	schedule *cron.Schedule
+	duration time.Duration
+	location *time.Location
+}
+
+// activeUntil reports whether an occurrence of the window covers t, and if so,
+// when this occurrence ends. Occurrences cover the time range [start, end).
+func (w *window) activeUntil(t time.Time) (time.Time, bool) {
+	start := w.schedule.Next(t.In(w.location).Add(-w.duration))
+	if start.IsZero() || start.After(t) {
+		return time.Time{}, false
+	}
+	return start.Add(w.duration), true
+}
+
+// Set is a collection of compiled sync windows.
+type Set struct {
+	windows []window
+}
+
+// Compile validates and compiles the given sync windows into a Set.
+func Compile(windows []v1alpha1.SyncWindow) (*Set, error) {
+	set := &Set{}
+	for _, w := range windows {
+		if w.Kind != KindAllow && w.Kind != KindDeny {
+			return nil, fmt.Errorf("unsupported sync window kind %q", w.Kind)
+		}
+		schedule, err := cron.Parse(w.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sync window schedule: %w", err)
+		}
+		duration, err := time.ParseDuration(w.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sync window duration %q: %w", w.Duration, err)
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("sync window duration %q must be positive", w.Duration)
+		}
+		location := time.UTC
+		if w.TimeZone != "" {
+			location, err = time.LoadLocation(w.TimeZone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sync window time zone %q: %w", w.TimeZone, err)
+			}
+		}
+		set.windows = append(set.windows, window{
+			kind:     w.Kind,
+			schedule: schedule,
+			duration: duration,
+			location: location,
+		})
+	}
+	return set, nil
+}
+
+// ForConfig compiles the cluster-wide sync windows together with the ones
+// defined in the spec of instance.
+func ForConfig(instance *v1alpha1.GitOpsConfig) (*Set, error) {
+	windows := make([]v1alpha1.SyncWindow, 0, len(globalWindows)+len(instance.Spec.SyncWindows))
+	windows = append(windows, globalWindows...)
+	windows = append(windows, instance.Spec.SyncWindows...)
+	return Compile(windows)
+}
+
+// Empty returns true if the set contains no windows, i.e. is always open.
+func (s *Set) Empty() bool {
+	return len(s.windows) == 0
+}
+
+// Open reports whether new runs may be started at time t. This is the case
+// when no Deny window is active, and either there are no Allow windows, or at
+// least one of them is active.
+func (s *Set) Open(t time.Time) bool {
+	hasAllow, allowed := false, false
+	for i := range s.windows {
+		w := &s.windows[i]
+		_, active := w.activeUntil(t)
+		switch w.kind {
+		case KindDeny:
+			if active {
+				return false
+			}
+		case KindAllow:
+			hasAllow = true
+			allowed = allowed || active
+		}
+	}
+	return !hasAllow || allowed
+}
+
+// NextOpen returns the earliest time not before t at which the set is open.
+// It returns false if no such time could be found.
+func (s *Set) NextOpen(t time.Time) (time.Time, bool) {
+	for i := 0; i < maxSteps; i++ {
+		if s.Open(t) {
+			return t, true
+		}
+		t = s.NextChange(t)
+		if t.IsZero() {
+			break
+		}
+	}
+	return time.Time{}, false
+}
+
+// NextChange returns the earliest time after t at which any of the windows
+// starts or ends, i.e. when the result of Open may change. It returns a zero
+// time if the set is empty.
+func (s *Set) NextChange(t time.Time) time.Time {
+	next := time.Time{}
+	earliest := func(c time.Time) {
+		if !c.IsZero() && (next.IsZero() || c.Before(next)) {
+			next = c
+		}
+	}
+	for i := range s.windows {
+		w := &s.windows[i]
+		if end, active := w.activeUntil(t); active {
+			earliest(end)
+		}
+		earliest(w.schedule.Next(t.In(w.location)))
+	}
+	return next
+}
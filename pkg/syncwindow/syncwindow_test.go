@@ -0,0 +1,171 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncwindow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+// Black Friday weekend freeze, and a daily business-hours allow window.
+var (
+	freeze = v1alpha1.SyncWindow{Kind: KindDeny, Schedule: "0 0 26 11 *", Duration: "96h"}
+	daily  = v1alpha1.SyncWindow{Kind: KindAllow, Schedule: "0 9 * * mon-fri", Duration: "8h"}
+)
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		comment string
+		windows []v1alpha1.SyncWindow
+		at      string
+		want    bool
+	}{
+		{"no windows", nil, "2021-11-27T12:00:00Z", true},
+		{"inside deny", []v1alpha1.SyncWindow{freeze}, "2021-11-27T12:00:00Z", false},
+		{"deny start is inclusive", []v1alpha1.SyncWindow{freeze}, "2021-11-26T00:00:00Z", false},
+		{"deny end is exclusive", []v1alpha1.SyncWindow{freeze}, "2021-11-30T00:00:00Z", true},
+		{"outside deny", []v1alpha1.SyncWindow{freeze}, "2021-12-01T12:00:00Z", true},
+		{"inside allow", []v1alpha1.SyncWindow{daily}, "2021-03-10T12:00:00Z", true},
+		{"outside allow", []v1alpha1.SyncWindow{daily}, "2021-03-10T18:00:00Z", false},
+		{"allow on weekend", []v1alpha1.SyncWindow{daily}, "2021-03-13T12:00:00Z", false},
+		{"deny wins over allow", []v1alpha1.SyncWindow{daily, freeze}, "2021-11-26T12:00:00Z", false},
+	}
+	for _, tt := range tests {
+		set, err := Compile(tt.windows)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.comment, err)
+		}
+		if got := set.Open(mustTime(t, tt.at)); got != tt.want {
+			t.Errorf("%s: expected Open(%s)=%v, got %v", tt.comment, tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestNextOpen(t *testing.T) {
+	tests := []struct {
+		comment string
+		windows []v1alpha1.SyncWindow
+		at      string
+		want    string
+	}{
+		{"already open", []v1alpha1.SyncWindow{freeze}, "2021-03-10T12:00:00Z", "2021-03-10T12:00:00Z"},
+		{"end of deny", []v1alpha1.SyncWindow{freeze}, "2021-11-27T12:00:00Z", "2021-11-30T00:00:00Z"},
+		{"start of next allow", []v1alpha1.SyncWindow{daily}, "2021-03-12T18:00:00Z", "2021-03-15T09:00:00Z"},
+		{"allow after deny", []v1alpha1.SyncWindow{daily, freeze}, "2021-11-26T10:00:00Z", "2021-11-30T09:00:00Z"},
+	}
+	for _, tt := range tests {
+		set, err := Compile(tt.windows)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.comment, err)
+		}
+		got, ok := set.NextOpen(mustTime(t, tt.at))
+		if want := mustTime(t, tt.want); !ok || !got.Equal(want) {
+			t.Errorf("%s: expected NextOpen(%s)=%s, got %s (ok=%v)", tt.comment, tt.at, want, got, ok)
+		}
+	}
+}
+
+func TestNextOpenNever(t *testing.T) {
+	set, err := Compile([]v1alpha1.SyncWindow{{Kind: KindDeny, Schedule: "* * * * *", Duration: "1h"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := set.NextOpen(mustTime(t, "2021-03-10T12:00:00Z")); ok {
+		t.Errorf("expected window to never open, got %s", got)
+	}
+}
+
+func TestTimeZone(t *testing.T) {
+	if _, err := time.LoadLocation("America/Chicago"); err != nil {
+		t.Skip("timezone database not available:", err)
+	}
+	set, err := Compile([]v1alpha1.SyncWindow{
+		{Kind: KindAllow, Schedule: "0 9 * * *", Duration: "1h", TimeZone: "America/Chicago"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Open(mustTime(t, "2021-03-10T09:30:00Z")) {
+		t.Error("expected window to be closed at 09:30 UTC")
+	}
+	if !set.Open(mustTime(t, "2021-03-10T15:30:00Z")) {
+		t.Error("expected window to be open at 15:30 UTC")
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, w := range []v1alpha1.SyncWindow{
+		{Kind: "Maybe", Schedule: "* * * * *", Duration: "1h"},
+		{Kind: KindDeny, Schedule: "* * *", Duration: "1h"},
+		{Kind: KindDeny, Schedule: "* * * * *", Duration: "forever"},
+		{Kind: KindDeny, Schedule: "* * * * *", Duration: "-1h"},
+		{Kind: KindDeny, Schedule: "* * * * *", Duration: "1h", TimeZone: "Nowhere/Special"},
+	} {
+		if _, err := Compile([]v1alpha1.SyncWindow{w}); err == nil {
+			t.Errorf("expected error for %+v", w)
+		}
+	}
+}
+
+func TestGlobalWindows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncwindow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "windows.yaml")
+	err = ioutil.WriteFile(fileName, []byte(`
+- kind: Deny
+  schedule: "0 0 26 11 *"
+  duration: 96h
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = InitializeGlobalWindows(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { globalWindows = nil }()
+
+	instance := &v1alpha1.GitOpsConfig{}
+	instance.Spec.SyncWindows = []v1alpha1.SyncWindow{daily}
+	set, err := ForConfig(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Open(mustTime(t, "2021-11-26T12:00:00Z")) {
+		t.Error("expected cluster-wide deny window to apply")
+	}
+	if set.Open(mustTime(t, "2021-03-10T18:00:00Z")) {
+		t.Error("expected GitOpsConfig allow window to apply")
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/fsnotify.v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// templatePollInterval is the interval at which the template files are
+	// checked for modifications when they can't be watched.
+	templatePollInterval = 10 * time.Second
+	// templateReloadDelay is the delay between a modification of the template
+	// files and their reload, so that the files being written or swapped (like
+	// the ones of a mounted ConfigMap) are reloaded at once.
+	templateReloadDelay = time.Second
+)
+
+var templateInfo = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "eunomia",
+		Name:      "job_template_info",
+		Help:      "A metric with a constant '1' value labeled by the version (hash of the content) of the job and cronjob templates in use.",
+	},
+	[]string{"template", "version"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(templateInfo)
+}
+
+// recordTemplateVersions updates the templateInfo metric.
+func recordTemplateVersions(versions TemplateVersions) {
+	templateInfo.Reset()
+	templateInfo.WithLabelValues("job", versions.Job).Set(1)
+	templateInfo.WithLabelValues("cronjob", versions.CronJob).Set(1)
+}
+
+// TemplateWatcher reloads the job and cronjob templates initialized by
+// InitializeTemplates when their files are modified, e.g. when a mounted
+// ConfigMap is updated. Modified templates are checked like at boot time;
+// invalid ones are rejected, and the last valid ones are kept. It implements
+// manager.Runnable.
+type TemplateWatcher struct {
+	// OnReload, if set, is called with the versions of the templates in use
+	// when the watcher is started and after each reload. err is the reason
+	// why modified templates were rejected, if any.
+	OnReload func(versions TemplateVersions, err error)
+
+	// rejected is the error of the last rejected templates, which isn't
+	// reported again until the files are modified.
+	rejected string
+}
+
+// Start watches the template files until stop is closed. It falls back to
+// polling them if they can't be watched.
+func (w *TemplateWatcher) Start(stop <-chan struct{}) error {
+	w.notify(CurrentTemplateVersions(), nil)
+
+	templates.RLock()
+	files := []string{templates.jobFile, templates.cronJobFile}
+	templates.RUnlock()
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	var poll <-chan time.Time
+	watcher, err := watchTemplateDirs(files)
+	if err != nil {
+		log.Error(err, "unable to watch the template files, polling them instead", "interval", templatePollInterval.String())
+		ticker := time.NewTicker(templatePollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	} else {
+		defer watcher.Close()
+		events = watcher.Events
+		watchErrors = watcher.Errors
+	}
+
+	reload := time.NewTimer(0)
+	<-reload.C
+	defer reload.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case event := <-events:
+			log.V(1).Info("template directory modified", "event", event.String())
+			reload.Reset(templateReloadDelay)
+		case err := <-watchErrors:
+			log.Error(err, "error watching the template files")
+		case <-poll:
+			w.reload()
+		case <-reload.C:
+			w.reload()
+		}
+	}
+}
+
+// watchTemplateDirs watches the directories of files, rather than the files
+// themselves, as mounted ConfigMaps are updated by swapping a symlink.
+func watchTemplateDirs(files []string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		err = watcher.Add(filepath.Dir(file))
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	return watcher, nil
+}
+
+// reload reloads the templates if their files were modified.
+func (w *TemplateWatcher) reload() {
+	versions, changed, err := reloadTemplates()
+	if err != nil {
+		if err.Error() != w.rejected {
+			w.rejected = err.Error()
+			log.Error(err, "unable to reload the job templates, keeping the loaded ones")
+			w.notify(CurrentTemplateVersions(), err)
+		}
+		return
+	}
+	w.rejected = ""
+	if changed {
+		log.Info("Reloaded the job templates", "job", versions.Job, "cronjob", versions.CronJob)
+		w.notify(versions, nil)
+	}
+}
+
+func (w *TemplateWatcher) notify(versions TemplateVersions, err error) {
+	if w.OnReload != nil {
+		w.OnReload(versions, err)
+	}
+}
+
+// reloadTemplates loads the template files again if their content changed.
+// It returns the versions of the files, and whether they were loaded.
+func reloadTemplates() (TemplateVersions, bool, error) {
+	templates.RLock()
+	jobFile, cronJobFile, current := templates.jobFile, templates.cronJobFile, templates.versions
+	templates.RUnlock()
+
+	jobText, cronJobText, err := readTemplates(jobFile, cronJobFile)
+	if err != nil {
+		return TemplateVersions{}, false, err
+	}
+	versions := TemplateVersions{Job: templateVersion(jobText), CronJob: templateVersion(cronJobText)}
+	if versions == current {
+		return versions, false, nil
+	}
+	job, cronJob, loaded, err := loadTemplates(jobFile, cronJobFile)
+	if err != nil {
+		return versions, false, err
+	}
+
+	templates.Lock()
+	defer templates.Unlock()
+	templates.job = job
+	templates.cronJob = cronJob
+	templates.versions = loaded
+	recordTemplateVersions(loaded)
+	return loaded, true, nil
+}
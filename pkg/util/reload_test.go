@@ -0,0 +1,178 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cronJobTemplateFile string = "../../build/job-templates/cronjob.yaml"
+
+// writeTemplates writes the default job template, with an additional label,
+// and the default cronjob template to dir.
+func writeTemplates(t *testing.T, dir, label string) (string, string) {
+	t.Helper()
+	jobText, err := ioutil.ReadFile(templateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cronJobText, err := ioutil.ReadFile(cronJobTemplateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobText = []byte(strings.Replace(string(jobText), "  labels:\n", "  labels:\n    version: "+label+"\n", 1))
+	jobFile, cronJobFile := filepath.Join(dir, "job.yaml"), filepath.Join(dir, "cronjob.yaml")
+	if err := ioutil.WriteFile(jobFile, jobText, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cronJobFile, cronJobText, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return jobFile, cronJobFile
+}
+
+func TestInitializeTemplatesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		job  string
+	}{
+		{"syntax error", "{{ .Config"},
+		{"execution error", "{{ .Missing }}"},
+		{"not a manifest", "- a list"},
+		{"no name", "kind: Job"},
+	}
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "templates")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		jobFile, cronJobFile := writeTemplates(t, dir, "v1")
+		if err := ioutil.WriteFile(jobFile, []byte(tt.job), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := InitializeTemplates(jobFile, cronJobFile); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+	if err := InitializeTemplates("missing.yaml", cronJobTemplateFile); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestReloadTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jobFile, cronJobFile := writeTemplates(t, dir, "v1")
+	if err := InitializeTemplates(jobFile, cronJobFile); err != nil {
+		t.Fatal(err)
+	}
+	label := func() string {
+		t.Helper()
+		job, err := CreateJob(fullconfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job.Labels["version"]
+	}
+	initial := CurrentTemplateVersions()
+
+	// Unmodified files aren't loaded again
+	if _, changed, err := reloadTemplates(); err != nil || changed {
+		t.Errorf("expected no reload, got %v, %v", changed, err)
+	}
+
+	// Invalid templates are rejected
+	if err := ioutil.WriteFile(jobFile, []byte("{{ .Config"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := reloadTemplates(); err == nil {
+		t.Error("expected the invalid template to be rejected")
+	}
+	if CurrentTemplateVersions() != initial || label() != "v1" {
+		t.Errorf("expected the last valid template to be kept")
+	}
+
+	// Valid ones are loaded
+	writeTemplates(t, dir, "v2")
+	versions, changed, err := reloadTemplates()
+	if err != nil || !changed {
+		t.Fatalf("expected a reload, got %v, %v", changed, err)
+	}
+	if versions.Job == initial.Job || versions.CronJob != initial.CronJob || CurrentTemplateVersions() != versions {
+		t.Errorf("unexpected versions %+v, initial %+v", versions, initial)
+	}
+	if label() != "v2" {
+		t.Errorf("expected the new template to be used")
+	}
+}
+
+func TestTemplateWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jobFile, cronJobFile := writeTemplates(t, dir, "v1")
+	if err := InitializeTemplates(jobFile, cronJobFile); err != nil {
+		t.Fatal(err)
+	}
+	type reload struct {
+		versions TemplateVersions
+		err      error
+	}
+	reloads := make(chan reload, 10)
+	watcher := &TemplateWatcher{OnReload: func(versions TemplateVersions, err error) {
+		reloads <- reload{versions, err}
+	}}
+	stop := make(chan struct{})
+	defer close(stop)
+	go watcher.Start(stop) //nolint:errcheck
+	next := func() reload {
+		t.Helper()
+		select {
+		case r := <-reloads:
+			return r
+		case <-time.After(15 * time.Second):
+			t.Fatal("timed out waiting for a reload")
+		}
+		return reload{}
+	}
+
+	initial := next()
+	if initial.err != nil || initial.versions != CurrentTemplateVersions() {
+		t.Errorf("expected the initial versions, got %+v", initial)
+	}
+	if err := ioutil.WriteFile(jobFile, []byte("{{ .Config"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.err == nil || r.versions != initial.versions {
+		t.Errorf("expected the invalid template to be rejected, got %+v", r)
+	}
+	writeTemplates(t, dir, "v2")
+	if r := next(); r.err != nil || r.versions.Job == initial.versions.Job {
+		t.Errorf("expected the new template to be loaded, got %+v", r)
+	}
+}
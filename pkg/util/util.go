@@ -18,8 +18,12 @@ package util
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"sync"
 	"text/template"
 
 	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
@@ -27,13 +31,29 @@ import (
 	"github.com/ghodss/yaml"
 	batch "k8s.io/api/batch/v1"
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-var jobTemplate *template.Template
-var cronJobTemplate *template.Template
 var log = logf.Log.WithName("util").WithValues("filename", "util.go")
 
+// templates are the operator's job and cronjob templates, loaded from files
+// by InitializeTemplates and reloaded by a TemplateWatcher.
+var templates = struct {
+	sync.RWMutex
+	jobFile     string
+	cronJobFile string
+	job         *template.Template
+	cronJob     *template.Template
+	versions    TemplateVersions
+}{}
+
+// TemplateVersions identify the content of the job and cronjob templates.
+type TemplateVersions struct {
+	Job     string
+	CronJob string
+}
+
 // JobMergeData is the structs that will be used to merge with the job template
 type JobMergeData struct {
 	Config v1alpha1.GitOpsConfig `json:"config,omitempty"`
@@ -42,31 +62,124 @@ type JobMergeData struct {
 	Action string `json:"action,omitempty"`
 }
 
-// InitializeTemplates initializes the templates needed by this controller, it must be called at controller boot time
+// sampleMergeData is used to check that the templates produce valid manifests.
+var sampleMergeData = JobMergeData{
+	Action: "create",
+	Config: v1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "sample"},
+		Spec: v1alpha1.GitOpsConfigSpec{
+			TemplateSource:         v1alpha1.GitConfig{URI: "https://github.com/KohlsTechnology/eunomia", Ref: "master", ContextDir: "."},
+			ParameterSource:        v1alpha1.GitConfig{URI: "https://github.com/KohlsTechnology/eunomia", Ref: "master", ContextDir: "."},
+			Triggers:               []v1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}},
+			ServiceAccountRef:      "default",
+			TemplateProcessorImage: "quay.io/kohlstechnology/eunomia-base:latest",
+			ResourceHandlingMode:   "Apply",
+			ResourceDeletionMode:   "Delete",
+		},
+	},
+}
+
+// InitializeTemplates initializes the templates needed by this controller, it must be called at controller boot time.
+// The templates are checked against a sample GitOpsConfig, so that a broken template is detected at boot time.
 func InitializeTemplates(jobTemplateFileName string, cronJobTemplateFileName string) error {
-	text, err := ioutil.ReadFile(jobTemplateFileName)
+	job, cronJob, versions, err := loadTemplates(jobTemplateFileName, cronJobTemplateFileName)
+	if err != nil {
+		return err
+	}
+	templates.Lock()
+	defer templates.Unlock()
+	templates.jobFile = jobTemplateFileName
+	templates.cronJobFile = cronJobTemplateFileName
+	templates.job = job
+	templates.cronJob = cronJob
+	templates.versions = versions
+	recordTemplateVersions(versions)
+	return nil
+}
+
+// CurrentTemplateVersions returns the versions of the job and cronjob
+// templates in use.
+func CurrentTemplateVersions() TemplateVersions {
+	templates.RLock()
+	defer templates.RUnlock()
+	return templates.versions
+}
+
+// templateVersion returns the version of a template, i.e. a short hash of its
+// text.
+func templateVersion(text []byte) string {
+	hash := sha256.Sum256(text)
+	return hex.EncodeToString(hash[:])[:12]
+}
+
+// readTemplates reads the text of the job and cronjob template files.
+func readTemplates(jobTemplateFileName string, cronJobTemplateFileName string) ([]byte, []byte, error) {
+	jobText, err := ioutil.ReadFile(jobTemplateFileName)
 	if err != nil {
 		log.Error(err, "error reading job template file", "filename", jobTemplateFileName)
-		return fmt.Errorf("error reading job template file %q: %w", jobTemplateFileName, err)
+		return nil, nil, fmt.Errorf("error reading job template file %q: %w", jobTemplateFileName, err)
+	}
+	cronJobText, err := ioutil.ReadFile(cronJobTemplateFileName)
+	if err != nil {
+		log.Error(err, "error reading cron job template file", "filename", cronJobTemplateFileName)
+		return nil, nil, fmt.Errorf("error reading cron job template file %q: %w", cronJobTemplateFileName, err)
+	}
+	return jobText, cronJobText, nil
+}
+
+// loadTemplates reads, parses and checks the job and cronjob template files.
+func loadTemplates(jobTemplateFileName string, cronJobTemplateFileName string) (*template.Template, *template.Template, TemplateVersions, error) {
+	versions := TemplateVersions{}
+	jobText, cronJobText, err := readTemplates(jobTemplateFileName, cronJobTemplateFileName)
+	if err != nil {
+		return nil, nil, versions, err
+	}
+	job, err := ParseJobTemplate(string(jobText))
+	if err != nil {
+		return nil, nil, versions, fmt.Errorf("invalid job template file %q: %w", jobTemplateFileName, err)
 	}
-	jobTemplate = template.New("Job").Funcs(template.FuncMap{
+	sampleJob, err := ExecuteJobTemplate(job, sampleMergeData)
+	if err == nil && sampleJob.Name == "" {
+		err = errors.New("job has no name")
+	}
+	if err != nil {
+		return nil, nil, versions, fmt.Errorf("invalid job template file %q: %w", jobTemplateFileName, err)
+	}
+	cronJob, err := ParseCronJobTemplate(string(cronJobText))
+	if err != nil {
+		return nil, nil, versions, fmt.Errorf("invalid cron job template file %q: %w", cronJobTemplateFileName, err)
+	}
+	sampleCronJob, err := ExecuteCronJobTemplate(cronJob, sampleMergeData)
+	if err == nil && sampleCronJob.Name == "" {
+		err = errors.New("cron job has no name")
+	}
+	if err != nil {
+		return nil, nil, versions, fmt.Errorf("invalid cron job template file %q: %w", cronJobTemplateFileName, err)
+	}
+	versions.Job = templateVersion(jobText)
+	versions.CronJob = templateVersion(cronJobText)
+	return job, cronJob, versions, nil
+}
+
+// ParseJobTemplate parses the text of a job template, with the functions
+// available to the job templates.
+func ParseJobTemplate(text string) (*template.Template, error) {
+	t, err := template.New("Job").Funcs(template.FuncMap{
 		"getID": func() string {
 			return uniuri.NewLenChars(6, []byte("abcdefghijklmnopqrstuvwxyz0123456789"))
 		},
-	})
-
-	jobTemplate, err = jobTemplate.Parse(string(text))
+	}).Parse(text)
 	if err != nil {
 		log.Error(err, "error parsing template", "template", text)
-		return fmt.Errorf("error parsing template: %w", err)
+		return nil, fmt.Errorf("error parsing template: %w", err)
 	}
+	return t, nil
+}
 
-	text, err = ioutil.ReadFile(cronJobTemplateFileName)
-	if err != nil {
-		log.Error(err, "error reading cron job template file", "filename", cronJobTemplateFileName)
-		return fmt.Errorf("error reading cron job template file %q: %w", cronJobTemplateFileName, err)
-	}
-	cronJobTemplate = template.New("Job").Funcs(template.FuncMap{
+// ParseCronJobTemplate parses the text of a cron job template, with the
+// functions available to the cron job templates.
+func ParseCronJobTemplate(text string) (*template.Template, error) {
+	t, err := template.New("Job").Funcs(template.FuncMap{
 		"getCron": func(config v1alpha1.GitOpsConfig) string {
 			for _, trigger := range config.Spec.Triggers {
 				if trigger.Type == "Periodic" {
@@ -75,21 +188,31 @@ func InitializeTemplates(jobTemplateFileName string, cronJobTemplateFileName str
 			}
 			return ""
 		},
-	})
-
-	cronJobTemplate, err = cronJobTemplate.Parse(string(text))
+	}).Parse(text)
 	if err != nil {
 		log.Error(err, "error parsing cron job template", "template", text)
-		return fmt.Errorf("error parsing cron job template: %w", err)
+		return nil, fmt.Errorf("error parsing cron job template: %w", err)
 	}
-	return nil
+	return t, nil
 }
 
 // CreateJob returns a Job type from a template merge data
 func CreateJob(jobmergedata JobMergeData) (batch.Job, error) {
+	templates.RLock()
+	t := templates.job
+	templates.RUnlock()
+	if t == nil {
+		return batch.Job{}, errors.New("job template is not initialized")
+	}
+	return ExecuteJobTemplate(t, jobmergedata)
+}
+
+// ExecuteJobTemplate returns a Job type from a template merge data, using the
+// passed job template (see ParseJobTemplate)
+func ExecuteJobTemplate(t *template.Template, jobmergedata JobMergeData) (batch.Job, error) {
 	job := batch.Job{}
 	var b bytes.Buffer
-	err := jobTemplate.Execute(&b, &jobmergedata)
+	err := t.Execute(&b, &jobmergedata)
 	if err != nil {
 		log.Error(err, "error executing job template from a template merge data")
 		return job, fmt.Errorf("error executing job template from a template merge data: %w", err)
@@ -104,9 +227,21 @@ func CreateJob(jobmergedata JobMergeData) (batch.Job, error) {
 
 // CreateCronJob returns a Job type from a template merge data
 func CreateCronJob(jobmergedata JobMergeData) (batchv1beta1.CronJob, error) {
+	templates.RLock()
+	t := templates.cronJob
+	templates.RUnlock()
+	if t == nil {
+		return batchv1beta1.CronJob{}, errors.New("cron job template is not initialized")
+	}
+	return ExecuteCronJobTemplate(t, jobmergedata)
+}
+
+// ExecuteCronJobTemplate returns a CronJob type from a template merge data,
+// using the passed cron job template (see ParseCronJobTemplate)
+func ExecuteCronJobTemplate(t *template.Template, jobmergedata JobMergeData) (batchv1beta1.CronJob, error) {
 	cronjob := batchv1beta1.CronJob{}
 	var b bytes.Buffer
-	err := cronJobTemplate.Execute(&b, &jobmergedata)
+	err := t.Execute(&b, &jobmergedata)
 	if err != nil {
 		log.Error(err, "error executing cron job template from a template merge data")
 		return cronjob, fmt.Errorf("error executing cron job template from a template merge data: %w", err)
@@ -71,6 +71,7 @@ build_image() {
 build_image build/ eunomia-operator
 
 # building and pushing base template processor images
+cp build/_output/bin/eunomia-runner template-processors/base/bin/eunomia-runner
 build_image template-processors/base/ eunomia-base
 
 # building and pushing helm template processor images